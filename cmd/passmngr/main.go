@@ -1,14 +1,34 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"passwordManager/internal/agent"
 	"passwordManager/internal/backend"
 	"passwordManager/internal/backend/dbInterface"
 	"passwordManager/internal/cli"
+	"passwordManager/internal/server"
 )
 
 func main() {
+	//browsers start the native messaging host directly, with their own arguments
+	if agent.IsNativeMessagingLaunch(os.Args[1:]) {
+		os.Args = append([]string{os.Args[0], "native-messaging"}, os.Args[1:]...)
+	}
+	if len(os.Args) > 1 && agent.IsClientCommand(os.Args[1]) {
+		if err := agent.RunCommand(os.Args[1], os.Args[2:]); err != nil {
+			var exitCode agent.ExitCode
+			if errors.As(err, &exitCode) {
+				os.Exit(int(exitCode))
+			}
+			fmt.Fprintln(os.Stderr, os.Args[1], "failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	file, err := os.OpenFile("passwordmanagerlogs.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		panic(err)
@@ -16,10 +36,28 @@ func main() {
 
 	logger := slog.New(slog.NewTextHandler(file, nil))
 	backend.SetLogger(logger)
+	agent.SetLogger(logger)
 
 	dbInterface.OpenDb()
 	if err := dbInterface.OpenDb(); err != nil {
 		panic(err)
 	}
+
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := server.Run(os.Args[2:]); err != nil {
+			logger.Error("api server stopped:", "error", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		if err := agent.Start(os.Args[2:]); err != nil {
+			logger.Error("agent stopped:", "error", err)
+			fmt.Println("agent failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
 	cli.RunCLI()
 }
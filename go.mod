@@ -6,4 +6,6 @@ require github.com/mattn/go-sqlite3 v1.14.30 // direct
 
 require golang.org/x/crypto v0.40.0 // direct
 
+require golang.org/x/net v0.42.0 // direct
+
 require golang.org/x/sys v0.34.0 // indirect
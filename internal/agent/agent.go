@@ -0,0 +1,283 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"passwordManager/internal/backend"
+	"passwordManager/internal/userType"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	//how long the key is held after an unlock when no timeout is given
+	DEFAULT_TIMEOUT = 15 * time.Minute
+
+	//largest request accepted from a client
+	MAX_REQUEST_SIZE = 64 << 10
+)
+
+var ErrAgentRunning = errors.New("an agent is already listening on this socket")
+
+var logger *slog.Logger
+
+func SetLogger(mainLogger *slog.Logger) {
+	logger = mainLogger
+}
+
+// keyHolder is the unlocked state of the agent. The key is dropped, and cleared, on lock, on timeout and on shutdown.
+type keyHolder struct {
+	mutex     sync.Mutex
+	user      userType.User
+	masterKey []byte
+	expiresAt time.Time
+	timer     *time.Timer
+	timeout   time.Duration
+}
+
+func (holder *keyHolder) lock() {
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	holder.lockLocked()
+}
+
+func (holder *keyHolder) lockLocked() {
+	if holder.timer != nil {
+		holder.timer.Stop()
+		holder.timer = nil
+	}
+	clear(holder.masterKey)
+	holder.masterKey = nil
+	holder.user = userType.User{}
+	holder.expiresAt = time.Time{}
+}
+
+func (holder *keyHolder) unlock(username string, password string, keyFile string) (Response, error) {
+	//runs the key derivation once, every later request is served with the derived key until it is dropped
+	if len(username) == 0 || len(password) == 0 {
+		return Response{}, fmt.Errorf("username and password cannot be empty")
+	}
+	user, masterKey, err := backend.LogUserIn(username, password, keyFile)
+	if err != nil {
+		return Response{}, err
+	}
+
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	holder.lockLocked()
+	holder.user = user
+	holder.masterKey = masterKey
+	holder.expiresAt = time.Now().Add(holder.timeout)
+	holder.timer = time.AfterFunc(holder.timeout, holder.lock)
+	return Response{Username: user.Name, ExpiresAt: holder.expiresAt}, nil
+}
+
+func (holder *keyHolder) serve(request Request) (Response, error) {
+	switch request.Op {
+	case OP_UNLOCK:
+		return holder.unlock(request.Username, request.Password, request.KeyFile)
+	case OP_LOCK:
+		holder.lock()
+		return Response{Locked: true}, nil
+	}
+
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	if holder.masterKey == nil {
+		if request.Op == OP_STATUS {
+			return Response{Locked: true}, nil
+		}
+		return Response{Locked: true}, ErrAgentLocked
+	}
+
+	switch request.Op {
+	case OP_STATUS:
+		return Response{Username: holder.user.Name, ExpiresAt: holder.expiresAt}, nil
+
+	case OP_LIST:
+		summaries, err := backend.GetUserAccountSummaries(holder.user, strings.ToLower(request.Folder), request.Tags)
+		if err != nil {
+			return Response{}, err
+		}
+		entries := make([]Entry, 0, len(summaries))
+		for _, summary := range summaries {
+			entries = append(entries, Entry{Name: summary.Name, Username: summary.Username, Folder: summary.Folder, Tags: summary.Tags})
+		}
+		return Response{Username: holder.user.Name, Entries: entries}, nil
+
+	case OP_GET:
+		name := strings.ToLower(request.Name)
+		if len(name) == 0 {
+			return Response{}, fmt.Errorf("account name cannot be empty")
+		}
+		username, password, err := backend.GetUserAccount(holder.user, name, holder.masterKey)
+		if err != nil {
+			return Response{}, err
+		}
+		fields, err := backend.GetEntryFields(holder.user, name, holder.masterKey)
+		if err != nil {
+			return Response{}, err
+		}
+		return Response{Username: holder.user.Name, Entry: &Entry{Name: name, Username: username, Password: password, Fields: fields}}, nil
+
+	case OP_OTP:
+		code, err := backend.GetEntryOTPCode(holder.user, strings.ToLower(request.Name), holder.masterKey)
+		if err != nil {
+			return Response{}, err
+		}
+		return Response{Username: holder.user.Name, Code: code.Code}, nil
+
+	case OP_OTP_PEEK:
+		code, err := backend.PeekEntryOTPCode(holder.user, strings.ToLower(request.Name), holder.masterKey)
+		if err != nil {
+			return Response{}, err
+		}
+		return Response{Username: holder.user.Name, Code: code.Code, CounterBased: code.Kind == backend.OTP_KIND_HOTP, Counter: code.Counter}, nil
+
+	case OP_OTP_COMMIT:
+		err := backend.CommitEntryOTPCounter(holder.user, strings.ToLower(request.Name), request.Counter)
+		return Response{Username: holder.user.Name}, err
+
+	case OP_RESOLVE:
+		value, err := backend.ResolveSecretReference(holder.user, request.Name, holder.masterKey)
+		if err != nil {
+			return Response{}, err
+		}
+		return Response{Username: holder.user.Name, Value: value}, nil
+
+	case OP_MATCH:
+		matches, err := backend.MatchAccountsByOrigin(holder.user, request.Name, holder.masterKey)
+		if err != nil {
+			return Response{}, err
+		}
+		entries := make([]Entry, 0, len(matches))
+		for _, match := range matches {
+			entries = append(entries, Entry{Name: match.Account.Name, Username: match.Account.Username, Password: match.Password, ExactHost: match.ExactHost, Folder: match.Account.Folder})
+		}
+		return Response{Username: holder.user.Name, Entries: entries}, nil
+
+	case OP_SAVE_LOGIN:
+		name, created, err := backend.SaveOriginLogin(holder.user, request.Name, request.Username, request.Password, holder.masterKey)
+		if err != nil {
+			return Response{}, err
+		}
+		return Response{Username: holder.user.Name, Value: name, Created: created}, nil
+
+	case OP_SET:
+		name := strings.ToLower(request.Name)
+		if len(name) == 0 || len(request.Username) == 0 || len(request.Password) == 0 {
+			return Response{}, fmt.Errorf("account name, username and password cannot be empty")
+		}
+		if _, _, err := backend.GetUserAccount(holder.user, name, holder.masterKey); err == nil {
+			_, err = backend.UpdateUserAccount(holder.user, name, request.Username, request.Password, holder.masterKey)
+			return Response{Username: holder.user.Name}, err
+		}
+		_, _, err := backend.AddUserAccount(holder.user, name, request.Username, request.Password, holder.masterKey)
+		return Response{Username: holder.user.Name}, err
+
+	case OP_REMOVE:
+		name := strings.ToLower(request.Name)
+		if _, _, err := backend.GetUserAccount(holder.user, name, holder.masterKey); err != nil {
+			return Response{}, err
+		}
+		_, err := backend.RemoveUserAccount(name, holder.user)
+		return Response{Username: holder.user.Name}, err
+
+	default:
+		return Response{}, fmt.Errorf("unknown request %q", request.Op)
+	}
+}
+
+func handleConn(conn net.Conn, holder *keyHolder) {
+	defer conn.Close()
+
+	//only processes of the user running the agent get an answer
+	uid, err := peerUid(conn)
+	if err != nil || uid != os.Getuid() {
+		logger.Warn("agent refused a connection from another user", "uid", uid, "error", err)
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(CALL_TIMEOUT))
+	var request Request
+	if err := json.NewDecoder(io.LimitReader(conn, MAX_REQUEST_SIZE)).Decode(&request); err != nil {
+		json.NewEncoder(conn).Encode(Response{Error: "invalid request"})
+		return
+	}
+
+	response, err := holder.serve(request)
+	if err != nil {
+		response.Error = err.Error()
+		response.NotFound = errors.Is(err, backend.ErrAccountNotFound)
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+func prepareSocket(socketPath string) error {
+	//creates the socket directory for the current user only, and removes the socket of an agent that is gone
+	dir := filepath.Dir(socketPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	//MkdirAll keeps a directory someone else created before us
+	if err := checkSocketDir(dir); err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(socketPath); err == nil {
+		if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+			conn.Close()
+			return ErrAgentRunning
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Serve(socketPath string, timeout time.Duration) error {
+	//holds the key of one user and answers clients on the socket until SIGTERM or SIGINT
+	if timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	if err := prepareSocket(socketPath); err != nil {
+		return err
+	}
+	listener, err := listenUnix(socketPath)
+	if err != nil {
+		return err
+	}
+
+	holder := &keyHolder{timeout: timeout}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		holder.lock()
+		listener.Close()
+	}()
+
+	logger.Info("agent started", "socket", socketPath)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			holder.lock()
+			if errors.Is(err, net.ErrClosed) {
+				logger.Info("agent stopped", "socket", socketPath)
+				return nil
+			}
+			return err
+		}
+		go handleConn(conn, holder)
+	}
+}
@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"passwordManager/internal/backend"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ClientCommands run from the shell, outside of the REPL, against a running agent.
+// They never open the vault themselves, so they work from any directory.
+var ClientCommands = []string{"unlock", "lock", "status", "get", "list", "git-credential", "run", "inject", "native-messaging"}
+
+func IsClientCommand(cmd string) bool {
+	for _, command := range ClientCommands {
+		if command == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+func RunCommand(cmd string, args []string) error {
+	switch cmd {
+	case "unlock":
+		return unlockAgent(args)
+	case "lock":
+		if _, err := Call(DefaultSocketPath(), Request{Op: OP_LOCK}); err != nil {
+			return err
+		}
+		fmt.Println("Agent locked.")
+	case "status":
+		response, err := Call(DefaultSocketPath(), Request{Op: OP_STATUS})
+		if err != nil {
+			return err
+		}
+		if response.Locked {
+			fmt.Println("Agent is locked.")
+			return nil
+		}
+		fmt.Printf("Agent is unlocked for %s until %s\n", response.Username, response.ExpiresAt.Local().Format(time.TimeOnly))
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: get <account_name | glk://reference>")
+		}
+		if backend.IsSecretReference(args[0]) {
+			//a reference names a single value, which is printed alone so scripts can capture it
+			value, err := Resolve(DefaultSocketPath(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(value)
+			return nil
+		}
+		entry, err := GetEntry(DefaultSocketPath(), args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Account: %s\nUsername: %s\nPassword: %s\n", entry.Name, entry.Username, entry.Password)
+		for _, field := range entry.Fields {
+			fmt.Printf("%s: %s\n", field.Name, field.Value)
+		}
+	case "list":
+		return listEntries(args)
+	case "git-credential":
+		return gitCredentialCommand(args)
+	case "run":
+		return runWithSecrets(args)
+	case "inject":
+		return injectSecrets(args)
+	case "native-messaging":
+		return nativeMessagingCommand(args)
+	default:
+		return fmt.Errorf("unknown command %s", cmd)
+	}
+	return nil
+}
+
+func Start(args []string) error {
+	//starts the agent in the background, or in the foreground with --foreground
+	flags := flag.NewFlagSet("agent", flag.ContinueOnError)
+	socketPath := flags.String("socket", DefaultSocketPath(), "unix socket to listen on")
+	timeout := flags.Duration("timeout", DEFAULT_TIMEOUT, "how long the key is held after an unlock")
+	foreground := flags.Bool("foreground", false, "stay attached to the terminal")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *foreground {
+		return Serve(*socketPath, *timeout)
+	}
+	if err := prepareSocket(*socketPath); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	child := exec.Command(executable, "agent", "--foreground", "--socket", *socketPath, "--timeout", timeout.String())
+	child.SysProcAttr = detachedProcAttr()
+	if err := child.Start(); err != nil {
+		return err
+	}
+	pid := child.Process.Pid
+	child.Process.Release()
+
+	//the agent is ready once its socket answers
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if _, err := Call(*socketPath, Request{Op: OP_STATUS}); err == nil {
+			fmt.Printf("Agent started, pid %d\n", pid)
+			fmt.Printf("%s=%s; export %s\n", SOCKET_ENV, *socketPath, SOCKET_ENV)
+			return nil
+		}
+	}
+	return fmt.Errorf("the agent did not start, see the log for details")
+}
+
+func unlockAgent(args []string) error {
+	usage := fmt.Errorf("usage: unlock <username> [--keyfile <path>]")
+	if len(args) != 1 && len(args) != 3 {
+		return usage
+	}
+	username := args[0]
+	keyFile := ""
+	if len(args) == 3 {
+		if args[1] != "--keyfile" {
+			return usage
+		}
+		//the agent runs from another directory, it gets an absolute path
+		path, err := filepath.Abs(args[2])
+		if err != nil {
+			return err
+		}
+		keyFile = path
+	}
+
+	//the password is read from stdin so it stays out of the shell history and the process list
+	fmt.Print("Master password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(password) == 0 {
+		return fmt.Errorf("no password given")
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	response, err := Call(DefaultSocketPath(), Request{Op: OP_UNLOCK, Username: username, Password: password, KeyFile: keyFile})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Agent unlocked for %s until %s\n", response.Username, response.ExpiresAt.Local().Format(time.TimeOnly))
+	return nil
+}
+
+func listEntries(args []string) error {
+	request := Request{Op: OP_LIST}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return fmt.Errorf("usage: list [--folder <folder_path>] [--tag <tag>]...")
+		}
+		switch args[i] {
+		case "--folder":
+			request.Folder = args[i+1]
+		case "--tag":
+			request.Tags = append(request.Tags, strings.ToLower(args[i+1]))
+		default:
+			return fmt.Errorf("usage: list [--folder <folder_path>] [--tag <tag>]...")
+		}
+	}
+
+	response, err := Call(DefaultSocketPath(), request)
+	if err != nil {
+		return err
+	}
+	for _, entry := range response.Entries {
+		fmt.Printf("%s (%s)\n", entry.Name, entry.Username)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// git-credential implements the git credential helper protocol on top of the agent:
+// git writes key=value lines describing the remote on stdin, ended by an empty line,
+// and for get reads the username and password back in the same format.
+// Configure it with: git config credential.helper 'passmngr git-credential'
+
+type gitCredential struct {
+	protocol string
+	host     string
+	path     string
+	username string
+	password string
+}
+
+func readGitCredential(input io.Reader) (gitCredential, error) {
+	var credential gitCredential
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			break
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return gitCredential{}, fmt.Errorf("invalid credential line %q", line)
+		}
+		switch key {
+		case "protocol":
+			credential.protocol = value
+		case "host":
+			credential.host = value
+		case "path":
+			credential.path = value
+		case "username":
+			credential.username = value
+		case "password":
+			credential.password = value
+		case "url":
+			//url is sent by some tools in place of the attributes it contains
+			parsed, err := url.Parse(value)
+			if err != nil {
+				return gitCredential{}, fmt.Errorf("invalid credential url: %w", err)
+			}
+			credential.protocol = parsed.Scheme
+			credential.host = parsed.Host
+			credential.path = strings.TrimPrefix(parsed.Path, "/")
+			if parsed.User != nil {
+				credential.username = parsed.User.Username()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return gitCredential{}, err
+	}
+	if len(credential.host) == 0 {
+		return gitCredential{}, fmt.Errorf("credential has no host")
+	}
+	return credential, nil
+}
+
+func (credential gitCredential) entryNames() []string {
+	//returns the entry names the remote can be stored under, most specific first:
+	//protocol://host/path, protocol://host, host/path and host
+	host := strings.ToLower(credential.host)
+	path := strings.Trim(credential.path, "/")
+	names := make([]string, 0, 4)
+	if len(credential.protocol) != 0 {
+		prefix := strings.ToLower(credential.protocol) + "://"
+		if len(path) != 0 {
+			names = append(names, prefix+host+"/"+path)
+		}
+		names = append(names, prefix+host)
+	}
+	if len(path) != 0 {
+		names = append(names, host+"/"+path)
+	}
+	return append(names, host)
+}
+
+func findGitEntry(socketPath string, credential gitCredential) (Entry, error) {
+	//returns the most specific entry for the remote, skipping entries for another username when git asks for a specific one
+	for _, name := range credential.entryNames() {
+		entry, err := GetEntry(socketPath, name)
+		if errors.Is(err, ErrEntryNotFound) {
+			continue
+		}
+		if err != nil {
+			return Entry{}, err
+		}
+		if len(credential.username) != 0 && entry.Username != credential.username {
+			continue
+		}
+		return entry, nil
+	}
+	return Entry{}, ErrEntryNotFound
+}
+
+func runGitCredential(args []string, input io.Reader, output io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: git-credential <get|store|erase>")
+	}
+	credential, err := readGitCredential(input)
+	if err != nil {
+		return err
+	}
+	socketPath := DefaultSocketPath()
+
+	switch args[0] {
+	case "get":
+		entry, err := findGitEntry(socketPath, credential)
+		if errors.Is(err, ErrEntryNotFound) {
+			//nothing is written, git goes on to its other helpers or prompts
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(entry.Username+entry.Password, "\n\x00") {
+			return fmt.Errorf("entry %s cannot be passed to git, it contains a newline", entry.Name)
+		}
+		fmt.Fprintf(output, "username=%s\npassword=%s\n", entry.Username, entry.Password)
+
+	case "store":
+		if len(credential.username) == 0 || len(credential.password) == 0 {
+			return nil
+		}
+		//an existing entry for the remote and username is updated, otherwise the most specific free name is used
+		entry, err := findGitEntry(socketPath, credential)
+		if err == nil {
+			if entry.Password == credential.password {
+				return nil
+			}
+			_, err = Call(socketPath, Request{Op: OP_SET, Name: entry.Name, Username: credential.username, Password: credential.password})
+			return err
+		}
+		if !errors.Is(err, ErrEntryNotFound) {
+			return err
+		}
+		for _, name := range credential.entryNames() {
+			_, err := GetEntry(socketPath, name)
+			if errors.Is(err, ErrEntryNotFound) {
+				_, err = Call(socketPath, Request{Op: OP_SET, Name: name, Username: credential.username, Password: credential.password})
+				return err
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("every entry name for %s is taken by another username", credential.host)
+
+	case "erase":
+		//git erases credentials the remote rejected, only an entry holding exactly those is removed
+		entry, err := findGitEntry(socketPath, credential)
+		if errors.Is(err, ErrEntryNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.Username != credential.username || entry.Password != credential.password {
+			return nil
+		}
+		_, err = Call(socketPath, Request{Op: OP_REMOVE, Name: entry.Name})
+		return err
+
+	default:
+		//git may add operations in the future, helpers are expected to ignore the ones they do not know
+	}
+	return nil
+}
+
+func gitCredentialCommand(args []string) error {
+	err := runGitCredential(args, os.Stdin, os.Stdout)
+	if errors.Is(err, ErrAgentNotRunning) || errors.Is(err, ErrAgentLocked) {
+		//git prompts for the credentials instead, the note goes to stderr so it does not mix with the protocol
+		fmt.Fprintln(os.Stderr, "passmngr:", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"passwordManager/internal/backend"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// inject renders a text/template with secrets from the agent, for example
+//
+//	password: {{ vault "prod-db" "password" }}
+//	token: {{ vault "glk://alice/prod/prod-db/token" }}
+//	code: {{ otp "prod-db" }}
+//
+// Every reference is resolved before anything is written, an unresolved one fails the whole render.
+// A code used twice renders the same both times, counter based codes are only spent once the render succeeded.
+
+type injectResolver struct {
+	socketPath string
+	entries    map[string]Entry
+	codes      map[string]Response
+}
+
+func (resolver *injectResolver) vault(args ...string) (string, error) {
+	//takes either a secret reference, or an entry name and one of username, password or the name of a custom field
+	if len(args) == 1 && backend.IsSecretReference(args[0]) {
+		return Resolve(resolver.socketPath, args[0])
+	}
+	if len(args) != 2 {
+		return "", fmt.Errorf("expected a glk:// reference, or an entry name and a field")
+	}
+	name, field := args[0], args[1]
+
+	entry, cached := resolver.entries[name]
+	if !cached {
+		var err error
+		entry, err = GetEntry(resolver.socketPath, name)
+		if err != nil {
+			return "", fmt.Errorf("%q: %w", name, err)
+		}
+		resolver.entries[name] = entry
+	}
+
+	switch strings.ToLower(field) {
+	case "username":
+		return entry.Username, nil
+	case "password":
+		return entry.Password, nil
+	}
+	for _, entryField := range entry.Fields {
+		if strings.EqualFold(entryField.Name, field) {
+			return entryField.Value, nil
+		}
+	}
+	return "", fmt.Errorf("%q has no field %q", name, field)
+}
+
+func (resolver *injectResolver) otp(name string) (string, error) {
+	//the agent ignores the case of entry names, so does the cache
+	name = strings.ToLower(name)
+	code, cached := resolver.codes[name]
+	if !cached {
+		var err error
+		code, err = PeekOTPCode(resolver.socketPath, name)
+		if err != nil {
+			return "", fmt.Errorf("%q: %w", name, err)
+		}
+		resolver.codes[name] = code
+	}
+	return code.Code, nil
+}
+
+func (resolver *injectResolver) commitCodes() error {
+	//spends the counter based codes of a successful render, a code handed out elsewhere in the meantime fails it
+	for name, code := range resolver.codes {
+		if !code.CounterBased {
+			continue
+		}
+		if err := CommitOTPCounter(resolver.socketPath, name, code.Counter); err != nil {
+			return fmt.Errorf("%q: %w, render again", name, err)
+		}
+	}
+	return nil
+}
+
+func renderTemplate(name string, text string, socketPath string) ([]byte, error) {
+	resolver := &injectResolver{socketPath: socketPath, entries: make(map[string]Entry), codes: make(map[string]Response)}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"vault": resolver.vault,
+		"otp":   resolver.otp,
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, nil); err != nil {
+		return nil, err
+	}
+	if err := resolver.commitCodes(); err != nil {
+		return nil, err
+	}
+	return rendered.Bytes(), nil
+}
+
+func writeSecretFile(path string, data []byte) error {
+	//writes the file readable by its owner only, through a temporary file so a failed write leaves the old one intact
+	//an existing file that others can read is not overwritten, it may be picked up by something expecting it to stay public
+	if info, err := os.Lstat(path); err == nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("refusing to overwrite %s, it is not a regular file", path)
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			return fmt.Errorf("refusing to overwrite %s, its mode %04o lets others read it, chmod 600 it first", path, info.Mode().Perm())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".inject-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Chmod(0600); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func injectSecrets(args []string) error {
+	usage := fmt.Errorf("usage: inject [-i <template>] [-o <output>]")
+	inputPath, outputPath := "", ""
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return usage
+		}
+		switch args[i] {
+		case "-i", "--in":
+			inputPath = args[i+1]
+		case "-o", "--out":
+			outputPath = args[i+1]
+		default:
+			return usage
+		}
+	}
+
+	//the template is read from stdin and the result written to stdout when no file is given
+	var text []byte
+	var err error
+	name := "stdin"
+	if len(inputPath) == 0 || inputPath == "-" {
+		text, err = io.ReadAll(os.Stdin)
+	} else {
+		name = filepath.Base(inputPath)
+		text, err = os.ReadFile(inputPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderTemplate(name, string(text), DefaultSocketPath())
+	if err != nil {
+		return err
+	}
+
+	if len(outputPath) == 0 || outputPath == "-" {
+		_, err = os.Stdout.Write(rendered)
+		return err
+	}
+	if err := writeSecretFile(outputPath, rendered); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Rendered", outputPath)
+	return nil
+}
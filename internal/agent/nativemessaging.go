@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The native messaging host lets a browser extension use the unlocked agent for autofill.
+// Browsers start the host themselves and exchange JSON messages over its stdin and stdout,
+// each one preceded by its length as a 32 bit integer in native byte order.
+
+const (
+	NATIVE_HOST_NAME = "passmngr.native_host"
+
+	//browsers refuse messages from the host above 1MiB, the same limit is kept for messages to it
+	MAX_NATIVE_MESSAGE_SIZE = 1 << 20
+)
+
+var ErrNativeMessageTooLarge = errors.New("native message exceeds 1MiB")
+
+type nativeRequest struct {
+	// Id is echoed back so the extension can match responses to requests
+	Id       json.RawMessage `json:"id,omitempty"`
+	Type     string          `json:"type"`
+	Origin   string          `json:"origin,omitempty"`
+	Username string          `json:"username,omitempty"`
+	Password string          `json:"password,omitempty"`
+}
+
+type nativeCredential struct {
+	Name      string `json:"name"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	ExactHost bool   `json:"exact_host"`
+}
+
+type nativeResponse struct {
+	Id          json.RawMessage    `json:"id,omitempty"`
+	Type        string             `json:"type"`
+	Ok          bool               `json:"ok"`
+	Error       string             `json:"error,omitempty"`
+	Locked      bool               `json:"locked,omitempty"`
+	Username    string             `json:"username,omitempty"`
+	Credentials []nativeCredential `json:"credentials,omitempty"`
+	Name        string             `json:"name,omitempty"`
+	Created     bool               `json:"created,omitempty"`
+}
+
+func IsNativeMessagingLaunch(args []string) bool {
+	//chrome starts the host with the origin of the extension, firefox with the path of the manifest and the extension id
+	if len(args) == 0 {
+		return false
+	}
+	return strings.HasPrefix(args[0], "chrome-extension://") || (len(args) == 2 && strings.HasSuffix(args[0], ".json"))
+}
+
+func readNativeMessage(input io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(input, binary.NativeEndian, &length); err != nil {
+		return nil, err
+	}
+	if length > MAX_NATIVE_MESSAGE_SIZE {
+		return nil, ErrNativeMessageTooLarge
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(input, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func writeNativeMessage(output io.Writer, message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if len(data) > MAX_NATIVE_MESSAGE_SIZE {
+		return ErrNativeMessageTooLarge
+	}
+	if err := binary.Write(output, binary.NativeEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = output.Write(data)
+	return err
+}
+
+func answerNativeRequest(socketPath string, request nativeRequest) nativeResponse {
+	response := nativeResponse{Id: request.Id, Type: request.Type}
+	var err error
+	switch request.Type {
+	case "status":
+		var agentResponse Response
+		agentResponse, err = Call(socketPath, Request{Op: OP_STATUS})
+		response.Locked = agentResponse.Locked
+		response.Username = agentResponse.Username
+
+	case "lookup":
+		var agentResponse Response
+		agentResponse, err = Call(socketPath, Request{Op: OP_MATCH, Name: request.Origin})
+		for _, entry := range agentResponse.Entries {
+			response.Credentials = append(response.Credentials, nativeCredential{Name: entry.Name, Username: entry.Username, Password: entry.Password, ExactHost: entry.ExactHost})
+		}
+
+	case "save":
+		var agentResponse Response
+		agentResponse, err = Call(socketPath, Request{Op: OP_SAVE_LOGIN, Name: request.Origin, Username: request.Username, Password: request.Password})
+		response.Name = agentResponse.Value
+		response.Created = agentResponse.Created
+
+	default:
+		err = fmt.Errorf("unknown message type %q", request.Type)
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+		response.Locked = errors.Is(err, ErrAgentLocked)
+		return response
+	}
+	response.Ok = true
+	return response
+}
+
+func serveNativeMessaging(input io.Reader, output io.Writer) error {
+	//answers messages until the browser closes stdin, which it does when the extension disconnects
+	socketPath := DefaultSocketPath()
+	for {
+		message, err := readNativeMessage(input)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var request nativeRequest
+		var response nativeResponse
+		if err := json.Unmarshal(message, &request); err != nil {
+			response = nativeResponse{Type: "error", Error: "invalid message: " + err.Error()}
+		} else {
+			response = answerNativeRequest(socketPath, request)
+		}
+
+		err = writeNativeMessage(output, response)
+		if errors.Is(err, ErrNativeMessageTooLarge) {
+			err = writeNativeMessage(output, nativeResponse{Id: request.Id, Type: request.Type, Error: "too many matching credentials"})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func printNativeManifest(browser string, extensionId string) error {
+	//prints the manifest registering this binary as the native messaging host of the extension
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	manifest := map[string]any{
+		"name":        NATIVE_HOST_NAME,
+		"description": "passmngr vault autofill",
+		"path":        executable,
+		"type":        "stdio",
+	}
+	switch browser {
+	case "chrome", "chromium":
+		manifest["allowed_origins"] = []string{"chrome-extension://" + extensionId + "/"}
+	case "firefox":
+		manifest["allowed_extensions"] = []string{extensionId}
+	default:
+		return fmt.Errorf("browser must be one of: chrome, chromium, firefox")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+func nativeMessagingCommand(args []string) error {
+	if IsNativeMessagingLaunch(args) || len(args) == 0 {
+		return serveNativeMessaging(os.Stdin, os.Stdout)
+	}
+
+	usage := fmt.Errorf("usage: native-messaging [--manifest chrome|chromium|firefox --extension-id <id>]")
+	browser, extensionId := "", ""
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return usage
+		}
+		switch args[i] {
+		case "--manifest":
+			browser = args[i+1]
+		case "--extension-id":
+			extensionId = args[i+1]
+		default:
+			return usage
+		}
+	}
+	if len(browser) == 0 || len(extensionId) == 0 {
+		return usage
+	}
+	return printNativeManifest(browser, extensionId)
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+var ErrPeerCredUnsupported = errors.New("the agent needs peer credentials, which are only checked on linux")
+
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+func peerUid(conn net.Conn) (int, error) {
+	return -1, ErrPeerCredUnsupported
+}
+
+func fileOwnerUid(info os.FileInfo) (int, error) {
+	return -1, ErrPeerCredUnsupported
+}
+
+func listenUnix(socketPath string) (net.Listener, error) {
+	return nil, ErrPeerCredUnsupported
+}
+
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"passwordManager/internal/userType"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Clients talk to the agent with one JSON request per connection, answered by one JSON response.
+
+const (
+	//overrides the default socket path, for clients and for the agent itself
+	SOCKET_ENV = "PASSMNGR_AGENT_SOCK"
+
+	//how long a client waits for the agent to answer
+	CALL_TIMEOUT = 10 * time.Second
+)
+
+const (
+	OP_UNLOCK = "unlock"
+	OP_LOCK   = "lock"
+	OP_STATUS = "status"
+	OP_LIST   = "list"
+	OP_GET    = "get"
+	OP_OTP    = "otp"
+	// OP_OTP_PEEK returns the current code without spending a counter based one, OP_OTP_COMMIT spends it by its counter
+	OP_OTP_PEEK   = "otp_peek"
+	OP_OTP_COMMIT = "otp_commit"
+	// OP_RESOLVE returns the value of the secret reference given as the name
+	OP_RESOLVE = "resolve"
+	// OP_MATCH returns the entries stored for the site of the origin given as the name, with their passwords
+	OP_MATCH = "match"
+	// OP_SAVE_LOGIN stores a login for the origin given as the name, updating the entry already holding its username
+	OP_SAVE_LOGIN = "save_login"
+	// OP_SET adds the entry, or changes the username and password of an existing one
+	OP_SET    = "set"
+	OP_REMOVE = "remove"
+)
+
+var (
+	ErrAgentNotRunning = errors.New("the agent is not running, start it with: passmngr agent")
+	ErrAgentLocked     = errors.New("the agent is locked, unlock it with: passmngr unlock <username>")
+	ErrEntryNotFound   = errors.New("no entry of that name in the vault")
+	ErrForeignSocket   = errors.New("the agent socket belongs to another user")
+)
+
+type Request struct {
+	Op       string   `json:"op"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	KeyFile  string   `json:"key_file,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Folder   string   `json:"folder,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Counter  uint64   `json:"counter,omitempty"`
+}
+
+type Entry struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	// ExactHost is set by OP_MATCH for entries stored for the very host of the origin
+	ExactHost bool                  `json:"exact_host,omitempty"`
+	Folder    string                `json:"folder,omitempty"`
+	Tags      []string              `json:"tags,omitempty"`
+	Fields    []userType.EntryField `json:"fields,omitempty"`
+}
+
+type Response struct {
+	Error string `json:"error,omitempty"`
+	// Locked is set on every response from a locked agent
+	Locked bool `json:"locked"`
+	// NotFound is set when the requested entry does not exist
+	NotFound  bool      `json:"not_found,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Entries   []Entry   `json:"entries,omitempty"`
+	Entry     *Entry    `json:"entry,omitempty"`
+	// Code is the current one time code of an entry
+	Code string `json:"code,omitempty"`
+	// CounterBased is set by OP_OTP_PEEK for codes that are only spent once committed with Counter
+	CounterBased bool   `json:"counter_based,omitempty"`
+	Counter      uint64 `json:"counter,omitempty"`
+	// Value is what a secret reference resolved to
+	Value string `json:"value,omitempty"`
+	// Created is set when OP_SAVE_LOGIN added a new entry, named in Value
+	Created bool `json:"created,omitempty"`
+}
+
+func DefaultSocketPath() string {
+	//returns the socket of the current users agent, inside a directory only they can access
+	if path := os.Getenv(SOCKET_ENV); len(path) != 0 {
+		return path
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); len(runtimeDir) != 0 {
+		return filepath.Join(runtimeDir, "passmngr", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), "passmngr-"+strconv.Itoa(os.Getuid()), "agent.sock")
+}
+
+func checkSocketDir(dir string) error {
+	//the socket directory has to belong to the current user and be closed to everyone else
+	//otherwise another user could have placed their own socket in it, for example below /tmp
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	uid, err := fileOwnerUid(info)
+	if err != nil {
+		return err
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("%w: %s is owned by uid %d", ErrForeignSocket, dir, uid)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("socket directory %s must only be accessible by its owner", dir)
+	}
+	return nil
+}
+
+func Call(socketPath string, request Request) (Response, error) {
+	//sends the request to the agent and returns its response, an error response is returned as an error
+	//requests carry the master password, so they are only sent to an agent of the current user
+	if err := checkSocketDir(filepath.Dir(socketPath)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Response{}, ErrAgentNotRunning
+		}
+		return Response{}, err
+	}
+	conn, err := net.DialTimeout("unix", socketPath, CALL_TIMEOUT)
+	if err != nil {
+		return Response{}, ErrAgentNotRunning
+	}
+	defer conn.Close()
+	if uid, err := peerUid(conn); err != nil || uid != os.Getuid() {
+		return Response{}, ErrForeignSocket
+	}
+	conn.SetDeadline(time.Now().Add(CALL_TIMEOUT))
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return Response{}, fmt.Errorf("failed to reach the agent: %w", err)
+	}
+	var response Response
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return Response{}, fmt.Errorf("invalid response from the agent: %w", err)
+	}
+	if len(response.Error) != 0 {
+		if response.Locked {
+			return response, ErrAgentLocked
+		}
+		if response.NotFound {
+			return response, ErrEntryNotFound
+		}
+		return response, errors.New(response.Error)
+	}
+	return response, nil
+}
+
+func GetEntry(socketPath string, name string) (Entry, error) {
+	//returns the named entry with its password and fields from the unlocked agent
+	response, err := Call(socketPath, Request{Op: OP_GET, Name: name})
+	if err != nil {
+		return Entry{}, err
+	}
+	if response.Entry == nil {
+		return Entry{}, fmt.Errorf("invalid response from the agent")
+	}
+	return *response.Entry, nil
+}
+
+func GetOTPCode(socketPath string, name string) (string, error) {
+	//returns the current one time code of the named entry, counter based codes are only handed out once
+	response, err := Call(socketPath, Request{Op: OP_OTP, Name: name})
+	if err != nil {
+		return "", err
+	}
+	return response.Code, nil
+}
+
+func PeekOTPCode(socketPath string, name string) (Response, error) {
+	//returns the current one time code of the named entry, a counter based one stays unspent until CommitOTPCounter
+	return Call(socketPath, Request{Op: OP_OTP_PEEK, Name: name})
+}
+
+func CommitOTPCounter(socketPath string, name string, counter uint64) error {
+	//spends the counter based code PeekOTPCode returned
+	_, err := Call(socketPath, Request{Op: OP_OTP_COMMIT, Name: name, Counter: counter})
+	return err
+}
+
+func Resolve(socketPath string, reference string) (string, error) {
+	//returns the value of a glk:// secret reference
+	response, err := Call(socketPath, Request{Op: OP_RESOLVE, Name: reference})
+	if err != nil {
+		return "", err
+	}
+	return response.Value, nil
+}
@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"passwordManager/internal/backend"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const SECRET_MASK = "<concealed by passmngr>"
+
+// ExitCode is returned when the child of run exits unsuccessfully, the caller exits with the same code.
+type ExitCode int
+
+func (code ExitCode) Error() string {
+	return fmt.Sprintf("command exited with status %d", int(code))
+}
+
+// maskingWriter replaces every secret written through it with SECRET_MASK.
+// A write ending in what could be the start of a secret holds that part back until the next write shows how it goes on.
+type maskingWriter struct {
+	mutex   sync.Mutex
+	out     io.Writer
+	secrets [][]byte
+	pending []byte
+}
+
+func newMaskingWriter(out io.Writer, secrets []string) *maskingWriter {
+	writer := &maskingWriter{out: out}
+	for _, secret := range secrets {
+		if len(secret) != 0 {
+			writer.secrets = append(writer.secrets, []byte(secret))
+		}
+	}
+	//a secret containing another one is replaced first, so it is not left partly visible
+	sort.Slice(writer.secrets, func(i, j int) bool { return len(writer.secrets[i]) > len(writer.secrets[j]) })
+	return writer
+}
+
+func (writer *maskingWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	buffer := append(writer.pending, data...)
+	for _, secret := range writer.secrets {
+		buffer = bytes.ReplaceAll(buffer, secret, []byte(SECRET_MASK))
+	}
+
+	hold := 0
+	for _, secret := range writer.secrets {
+		for length := min(len(secret)-1, len(buffer)); length > hold; length-- {
+			if bytes.HasSuffix(buffer, secret[:length]) {
+				hold = length
+				break
+			}
+		}
+	}
+
+	if _, err := writer.out.Write(buffer[:len(buffer)-hold]); err != nil {
+		return 0, err
+	}
+	writer.pending = append([]byte(nil), buffer[len(buffer)-hold:]...)
+	return len(data), nil
+}
+
+func (writer *maskingWriter) Flush() error {
+	//writes out what was held back, once the child is done no secret can be completed anymore
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	_, err := writer.out.Write(writer.pending)
+	writer.pending = nil
+	return err
+}
+
+func parseRunArgs(args []string) (map[string]string, []string, error) {
+	//returns the variables to set, by the entry they are read from, and the command to run
+	usage := fmt.Errorf("usage: run --env <VARIABLE>=<account_name | glk://reference>... -- <command> [args...]")
+	variables := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--":
+			if i+1 >= len(args) || len(variables) == 0 {
+				return nil, nil, usage
+			}
+			return variables, args[i+1:], nil
+		case "--env":
+			if i+1 >= len(args) {
+				return nil, nil, usage
+			}
+			name, account, found := strings.Cut(args[i+1], "=")
+			if !found || len(name) == 0 || len(account) == 0 || strings.ContainsAny(name, "=\x00") {
+				return nil, nil, fmt.Errorf("invalid --env %q, expected <VARIABLE>=<account_name | glk://reference>", args[i+1])
+			}
+			variables[name] = account
+			i++
+		default:
+			return nil, nil, usage
+		}
+	}
+	return nil, nil, usage
+}
+
+func runWithSecrets(args []string) error {
+	variables, command, err := parseRunArgs(args)
+	if err != nil {
+		return err
+	}
+
+	socketPath := DefaultSocketPath()
+	environment := os.Environ()
+	secrets := make([]string, 0, len(variables))
+	for name, source := range variables {
+		//a variable is set to the password of the named entry, or to the value of a secret reference
+		var value string
+		if backend.IsSecretReference(source) {
+			value, err = Resolve(socketPath, source)
+		} else {
+			var entry Entry
+			entry, err = GetEntry(socketPath, source)
+			value = entry.Password
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		environment = append(environment, name+"="+value)
+		secrets = append(secrets, value)
+	}
+
+	stdout := newMaskingWriter(os.Stdout, secrets)
+	stderr := newMaskingWriter(os.Stderr, secrets)
+	child := exec.Command(command[0], command[1:]...)
+	child.Env = environment
+	child.Stdin = os.Stdin
+	child.Stdout = stdout
+	child.Stderr = stderr
+
+	//signals are caught before the child starts, so none of them can stop run while it is unable to pass them on
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	if err := child.Start(); err != nil {
+		return err
+	}
+	go func() {
+		for received := range signals {
+			child.Process.Signal(received)
+		}
+	}()
+
+	err = child.Wait()
+	stdout.Flush()
+	stderr.Flush()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		//a child killed by a signal exits like a shell reports it, with 128 plus the signal number
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return ExitCode(128 + int(status.Signal()))
+		}
+		return ExitCode(exitErr.ExitCode())
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/userType"
+)
+
+func IsAge(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(crypto.AGE_INTRO+"\n"))
+}
+
+func ExportUserAccountsAge(user userType.User, writer io.Writer, recipients []string, passphrase string, masterKey []byte) (int, error) {
+	//writes every entry of the user as an age encrypted json document, for the X25519 recipients or for the passphrase
+	//the decrypted content is the same document a vault bundle carries
+	//returns the number of exported entries, or a possible error
+	var keys [][]byte
+	for _, recipient := range recipients {
+		key, err := crypto.ParseAgeRecipient(recipient)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", err, recipient)
+		}
+		keys = append(keys, key)
+	}
+
+	payload, count, err := marshalBundlePayload(user, masterKey)
+	if err != nil {
+		return 0, err
+	}
+
+	encrypted, err := crypto.EncryptAge(payload, keys, passphrase)
+	if errors.Is(err, crypto.ErrNoAgeRecipients) || errors.Is(err, crypto.ErrAgeScryptNotAlone) || errors.Is(err, crypto.ErrInvalidAgeRecipient) {
+		return 0, err
+	}
+	if err != nil {
+		logger.Error("age encryption failed:", "error", err)
+		return 0, fmt.Errorf("internal error when writing the export")
+	}
+
+	if _, err := writer.Write(encrypted); err != nil {
+		return 0, err
+	}
+
+	logger.Info("Exported age file", "username", user.Name, "count", count, "recipients", len(keys))
+	return count, nil
+}
@@ -0,0 +1,316 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	BACKUP_MANIFEST_FORMAT    = "passmngr-backup"
+	BACKUP_MANIFEST_EXTENSION = ".manifest"
+
+	//the live database is copied here before a restore replaces it
+	PRE_RESTORE_BACKUP_PATH = dbInterface.DB_PATH + ".pre-restore"
+)
+
+var (
+	ErrBackupExists           = errors.New("backup file already exists, pass --keep to rotate existing backups")
+	ErrInvalidBackupRotation  = errors.New("number of backups to keep must be at least 1")
+	ErrMissingBackupManifest  = errors.New("backup manifest is missing or unreadable")
+	ErrBackupChecksumMismatch = errors.New("backup does not match its manifest, it was modified or is incomplete")
+	ErrBackupSchemaMismatch   = errors.New("backup schema version does not match its manifest")
+	ErrBackupUserNotFound     = errors.New("the backup has no user of this name")
+	ErrBackupOtherPassword    = errors.New("the backup knows this user with another master password or key file")
+)
+
+func backupManifestPath(path string) string {
+	return path + BACKUP_MANIFEST_EXTENSION
+}
+
+func numberedBackupPath(path string, number int) string {
+	//the newest backup keeps the given path, older ones are suffixed .1, .2, ...
+	if number == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(number)
+}
+
+func copyFileHashed(dst io.Writer, path string) (string, int64, error) {
+	//copies the file into dst and returns the hex sha256 and size of what was copied
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, hash), file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+func writeBackupManifest(path string, manifest userType.BackupManifest) error {
+	//written next to the backup through a rename, so a manifest is never half written
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := backupManifestPath(path) + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, backupManifestPath(path))
+}
+
+func readBackupManifest(path string) (userType.BackupManifest, error) {
+	var manifest userType.BackupManifest
+	data, err := os.ReadFile(backupManifestPath(path))
+	if err != nil {
+		return manifest, ErrMissingBackupManifest
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Format != BACKUP_MANIFEST_FORMAT {
+		return manifest, ErrMissingBackupManifest
+	}
+	return manifest, nil
+}
+
+func rotateBackups(path string, keep int) error {
+	//drops the oldest backup and shifts the others up by one, freeing the unnumbered path
+	for number := keep - 1; number >= 0; number-- {
+		from := numberedBackupPath(path, number)
+		if _, err := os.Stat(from); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if number == keep-1 {
+			os.Remove(backupManifestPath(from))
+			if err := os.Remove(from); err != nil {
+				return err
+			}
+			continue
+		}
+		to := numberedBackupPath(path, number+1)
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		//a backup without its manifest cannot be restored, so a missing manifest is not an error here
+		os.Rename(backupManifestPath(from), backupManifestPath(to))
+	}
+	return nil
+}
+
+func BackupVault(path string, keep int) (userType.BackupManifest, error) {
+	//copies the whole database to path and writes a checksum manifest next to it
+	//with keep 0 an existing backup is never touched, otherwise up to keep numbered backups are kept
+	//returns the manifest of the new backup, or a possible error
+	if keep < 0 {
+		return userType.BackupManifest{}, ErrInvalidBackupRotation
+	}
+	if _, err := os.Stat(path); err == nil && keep == 0 {
+		return userType.BackupManifest{}, ErrBackupExists
+	}
+
+	//the backup is made and verified under a temporary name, so a failed backup never replaces a good one
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+	defer os.Remove(tmpPath)
+	if err := dbInterface.BackupDb(tmpPath); err != nil {
+		logger.Error("database backup failed:", "error", err)
+		return userType.BackupManifest{}, fmt.Errorf("backup failed: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		return userType.BackupManifest{}, err
+	}
+
+	version, err := dbInterface.VerifyDbFile(tmpPath)
+	if err != nil {
+		logger.Error("backup verification failed:", "error", err)
+		return userType.BackupManifest{}, err
+	}
+	checksum, size, err := copyFileHashed(io.Discard, tmpPath)
+	if err != nil {
+		return userType.BackupManifest{}, err
+	}
+
+	if keep > 0 {
+		if err := rotateBackups(path, keep); err != nil {
+			logger.Error("backup rotation failed:", "error", err)
+			return userType.BackupManifest{}, fmt.Errorf("backup rotation failed: %w", err)
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return userType.BackupManifest{}, err
+	}
+
+	manifest := userType.BackupManifest{
+		Format:        BACKUP_MANIFEST_FORMAT,
+		CreatedAt:     time.Now().UTC(),
+		SchemaVersion: version,
+		Size:          size,
+		SHA256:        checksum,
+	}
+	if err := writeBackupManifest(path, manifest); err != nil {
+		return userType.BackupManifest{}, err
+	}
+
+	logger.Info("Database backed up", "path", path, "size", size, "sha256", checksum)
+	return manifest, nil
+}
+
+func onlyUser(usernames []string, username string) bool {
+	for _, name := range usernames {
+		if name != username {
+			return false
+		}
+	}
+	return true
+}
+
+func RestoreVault(user userType.User, masterPassword string, keyFile string, path string, vaultKey []byte) (userType.BackupManifest, bool, error) {
+	//verifies the backup at path against its manifest and sqlites integrity check, then restores it, the master password is asked again
+	//when the live database and the backup hold no other user, the live database is replaced with the backup,
+	//otherwise only the entries of the user are restored, other users data needs their own master password
+	//returns the manifest and whether the whole database was replaced, in which case callers should drop any session
+	//the live database is copied to PRE_RESTORE_BACKUP_PATH first
+	if _, _, err := authenticateUser(user.Name, masterPassword, keyFile); err != nil {
+		return userType.BackupManifest{}, false, err
+	}
+
+	manifest, err := readBackupManifest(path)
+	if err != nil {
+		return manifest, false, err
+	}
+
+	//the copy is what gets verified and installed, so the backup cannot change between the check and the swap
+	tmpFile, err := os.CreateTemp(filepath.Dir(dbInterface.DB_PATH), ".restore-*.db")
+	if err != nil {
+		return manifest, false, err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	checksum, size, err := copyFileHashed(tmpFile, path)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return manifest, false, err
+	}
+	if checksum != manifest.SHA256 || size != manifest.Size {
+		logger.Error("backup checksum mismatch:", "path", path, "expected", manifest.SHA256, "got", checksum)
+		return manifest, false, ErrBackupChecksumMismatch
+	}
+
+	version, err := dbInterface.VerifyDbFile(tmpPath)
+	if err != nil {
+		logger.Error("backup verification failed:", "error", err)
+		return manifest, false, err
+	}
+	if version != manifest.SchemaVersion {
+		return manifest, false, ErrBackupSchemaMismatch
+	}
+
+	backupVault, err := dbInterface.OpenVault(tmpPath)
+	if err != nil {
+		logger.Error("backup opening failed:", "error", err)
+		return manifest, false, err
+	}
+	backupUsers, err := backupVault.FetchUsernames()
+	if err != nil {
+		backupVault.Close()
+		logger.Error("db error:", "error", err)
+		return manifest, false, fmt.Errorf("internal error, try again later")
+	}
+	liveUsers, err := dbInterface.LocalVault().FetchUsernames()
+	if err != nil {
+		backupVault.Close()
+		logger.Error("db error:", "error", err)
+		return manifest, false, fmt.Errorf("internal error, try again later")
+	}
+	wholeDatabase := onlyUser(backupUsers, user.Name) && onlyUser(liveUsers, user.Name)
+
+	var records []dbInterface.EntryRecord
+	if !wholeDatabase {
+		records, err = backupEntryRecords(backupVault, user, masterPassword, keyFile, vaultKey)
+	}
+	backupVault.Close()
+	if err != nil {
+		return manifest, false, err
+	}
+
+	os.Remove(PRE_RESTORE_BACKUP_PATH)
+	if err := dbInterface.BackupDb(PRE_RESTORE_BACKUP_PATH); err != nil {
+		logger.Error("pre restore backup failed:", "error", err)
+		return manifest, false, fmt.Errorf("could not save the current database before restoring: %w", err)
+	}
+	os.Chmod(PRE_RESTORE_BACKUP_PATH, 0600)
+
+	if !wholeDatabase {
+		if err := dbInterface.ReplaceUserEntries(user.Uid, records); err != nil {
+			logger.Error("entry restore failed:", "error", err)
+			return manifest, false, fmt.Errorf("restore failed, nothing was changed")
+		}
+		logger.Info("User entries restored", "username", user.Name, "path", path, "created_at", manifest.CreatedAt, "count", len(records))
+		names := make([]string, 0, len(records))
+		for _, record := range records {
+			names = append(names, record.Name)
+		}
+		return manifest, false, refreshEntryShares(user, names, vaultKey)
+	}
+
+	if err := dbInterface.ReplaceDb(tmpPath); err != nil {
+		logger.Error("database restore failed:", "error", err)
+		return manifest, false, fmt.Errorf("restore failed: %w", err)
+	}
+
+	logger.Info("Database restored", "path", path, "created_at", manifest.CreatedAt, "sha256", checksum)
+	return manifest, true, nil
+}
+
+func backupEntryRecords(backupVault dbInterface.Vault, user userType.User, masterPassword string, keyFile string, vaultKey []byte) ([]dbInterface.EntryRecord, error) {
+	//returns the entries of the user in the backup, readable with their current vault key
+	backupUser, err := backupVault.FetchUser(user.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBackupUserNotFound
+	}
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+	backupKey, err := otherVaultKey(user, backupUser, masterPassword, keyFile, vaultKey)
+	if err != nil {
+		if errors.Is(err, ErrSyncInvalidPassword) {
+			return nil, ErrBackupOtherPassword
+		}
+		return nil, err
+	}
+
+	records, err := backupVault.FetchEntryRecords(backupUser.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+	for i, record := range records {
+		if records[i], err = reencryptRecord(record, backupKey, vaultKey); err != nil {
+			logger.Error("backup entry decryption failed:", "error", err)
+			return nil, fmt.Errorf("internal error, try again later")
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/userType"
+	"time"
+)
+
+const (
+	//identifies a portable vault bundle, and the version of its layout
+	BUNDLE_FORMAT  = "passmngr-bundle"
+	BUNDLE_VERSION = 1
+
+	BUNDLE_KDF = "argon2id"
+
+	//a bundle leaves the machine, so its passphrase is stretched harder than the login password
+	BUNDLE_ARGON_TIME    = 3
+	BUNDLE_ARGON_MEM     = 64 * 1024
+	BUNDLE_ARGON_THREADS = 4
+	BUNDLE_SALT_SIZE     = 32
+
+	//refuse bundles asking for more than 1 GiB or 100 passes, a crafted header should not be able to exhaust memory or hang the import
+	BUNDLE_MAX_ARGON_MEM  = 1024 * 1024
+	BUNDLE_MAX_ARGON_TIME = 100
+)
+
+var (
+	ErrNotABundle            = errors.New("file is not a vault bundle")
+	ErrUnsupportedBundle     = errors.New("vault bundle version is not supported")
+	ErrBundleInvalidPassword = errors.New("wrong passphrase or tampered bundle")
+)
+
+// bundleKdf records how the bundle key was derived, so bundles stay readable if the defaults change.
+type bundleKdf struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"`
+	Threads   uint8  `json:"threads"`
+}
+
+// bundleFile is the outer, plaintext json document. Everything but the kdf parameters is in the ciphertext.
+type bundleFile struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	Kdf        bundleKdf `json:"kdf"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// bundlePayload is sealed with XChaCha20-Poly1305 under the key derived from the export passphrase.
+type bundlePayload struct {
+	Format     string                `json:"format"`
+	Version    int                   `json:"version"`
+	Username   string                `json:"username"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Count      int                   `json:"count"`
+	Entries    []userType.VaultEntry `json:"entries"`
+}
+
+func IsBundle(data []byte) bool {
+	var file bundleFile
+	return json.Unmarshal(data, &file) == nil && file.Format == BUNDLE_FORMAT
+}
+
+func marshalBundlePayload(user userType.User, masterKey []byte) ([]byte, int, error) {
+	//returns the plaintext json document holding every entry of the user and the number of entries in it
+	entries, err := ExportUserAccounts(user, masterKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	payload, err := json.MarshalIndent(bundlePayload{
+		Format:     BUNDLE_FORMAT,
+		Version:    BUNDLE_VERSION,
+		Username:   user.Name,
+		ExportedAt: time.Now().UTC(),
+		Count:      len(entries),
+		Entries:    entries,
+	}, "", "  ")
+	if err != nil {
+		logger.Error("bundle payload encoding failed:", "error", err)
+		return nil, 0, fmt.Errorf("internal error when writing the export")
+	}
+	return payload, len(entries), nil
+}
+
+func ExportUserAccountsBundle(user userType.User, writer io.Writer, passphrase string, masterKey []byte) (int, error) {
+	//writes every entry of the user with all of its metadata into a bundle protected by the passphrase
+	//returns the number of exported entries, or a possible error
+	if len(passphrase) == 0 {
+		return 0, fmt.Errorf("export passphrase cannot be empty")
+	}
+
+	payload, count, err := marshalBundlePayload(user, masterKey)
+	if err != nil {
+		return 0, err
+	}
+
+	kdf := bundleKdf{
+		Algorithm: BUNDLE_KDF,
+		Salt:      []byte(crypto.GenerateRandomString(BUNDLE_SALT_SIZE)),
+		Time:      BUNDLE_ARGON_TIME,
+		Memory:    BUNDLE_ARGON_MEM,
+		Threads:   BUNDLE_ARGON_THREADS,
+	}
+	key, err := crypto.GenkeyWithParams([]byte(passphrase), kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads)
+	if err != nil {
+		logger.Error("bundle key derivation failed:", "error", err)
+		return 0, fmt.Errorf("internal error when writing the bundle")
+	}
+
+	ciphertext, err := crypto.EncryptPassword(payload, key)
+	if err != nil {
+		logger.Error("bundle encryption failed:", "error", err)
+		return 0, fmt.Errorf("internal error when writing the bundle")
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(bundleFile{Format: BUNDLE_FORMAT, Version: BUNDLE_VERSION, Kdf: kdf, Ciphertext: ciphertext})
+	if err != nil {
+		return 0, err
+	}
+
+	logger.Info("Exported vault bundle", "username", user.Name, "count", count)
+	return count, nil
+}
+
+func ParseBundle(reader io.Reader, passphrase string) ([]userType.VaultEntry, error) {
+	//decrypts and verifies a bundle, the entries can then be passed to ImportUserAccounts
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("bundle passphrase cannot be empty")
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var file bundleFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil || file.Format != BUNDLE_FORMAT {
+		return nil, ErrNotABundle
+	}
+	if len(file.Ciphertext) < crypto.CIPHERTEXT_OVERHEAD {
+		return nil, ErrNotABundle
+	}
+	if file.Version != BUNDLE_VERSION || file.Kdf.Algorithm != BUNDLE_KDF || file.Kdf.Memory > BUNDLE_MAX_ARGON_MEM || file.Kdf.Time > BUNDLE_MAX_ARGON_TIME {
+		return nil, ErrUnsupportedBundle
+	}
+
+	key, err := crypto.GenkeyWithParams([]byte(passphrase), file.Kdf.Salt, file.Kdf.Time, file.Kdf.Memory, file.Kdf.Threads)
+	if err != nil {
+		logger.Error("bundle key derivation failed:", "error", err)
+		return nil, ErrNotABundle
+	}
+
+	//poly1305 authenticates the ciphertext, a wrong passphrase and a modified file look the same
+	plaintext, err := crypto.DecryptPassword(file.Ciphertext, key)
+	if err != nil {
+		logger.Error("bundle decryption failed:", "error", err)
+		return nil, ErrBundleInvalidPassword
+	}
+
+	var payload bundlePayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		logger.Error("bundle payload decoding failed:", "error", err)
+		return nil, ErrNotABundle
+	}
+	//the outer header is not authenticated, so the copies inside the ciphertext are what counts
+	if payload.Format != BUNDLE_FORMAT || payload.Version != BUNDLE_VERSION || payload.Count != len(payload.Entries) {
+		return nil, ErrNotABundle
+	}
+
+	logger.Info("Read vault bundle", "exported_by", payload.Username, "exported_at", payload.ExportedAt, "count", payload.Count)
+	return payload.Entries, nil
+}
@@ -0,0 +1,233 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encryption to the age v1 file format, see https://age-encryption.org/v1.
+// Files written here can be decrypted with the age and rage command line tools.
+
+const (
+	AGE_INTRO = "age-encryption.org/v1"
+
+	//bech32 human readable part of X25519 recipients
+	AGE_RECIPIENT_HRP = "age"
+
+	AGE_X25519_LABEL = "age-encryption.org/v1/X25519"
+	AGE_SCRYPT_LABEL = "age-encryption.org/v1/scrypt"
+
+	//scrypt work factor used by the age tool, about a second on a laptop
+	AGE_SCRYPT_LOG_N     = 18
+	AGE_SCRYPT_SALT_SIZE = 16
+
+	AGE_FILE_KEY_SIZE      = 16
+	AGE_PAYLOAD_NONCE_SIZE = 16
+	AGE_CHUNK_SIZE         = 64 * 1024
+
+	//stanza bodies are wrapped at 64 base64 characters
+	AGE_COLUMNS_PER_LINE = 64
+)
+
+var (
+	ErrInvalidAgeRecipient = errors.New("invalid age recipient, expected an age1... X25519 public key")
+	ErrNoAgeRecipients     = errors.New("no age recipient or passphrase given")
+	ErrAgeScryptNotAlone   = errors.New("an age passphrase cannot be combined with other recipients")
+)
+
+var ageBase64 = base64.RawStdEncoding
+
+type ageStanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+func ParseAgeRecipient(recipient string) ([]byte, error) {
+	//returns the X25519 public key encoded in an age1... recipient string
+	hrp, key, err := Bech32Decode(recipient)
+	if err != nil || hrp != AGE_RECIPIENT_HRP || len(key) != curve25519.PointSize {
+		return nil, ErrInvalidAgeRecipient
+	}
+	return key, nil
+}
+
+func ageWrapFileKey(wrapKey []byte, fileKey []byte) ([]byte, error) {
+	//every recipient type seals the file key with chacha20poly1305 under an all zero nonce, the wrap key is single use
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil), nil
+}
+
+func ageX25519Stanza(fileKey []byte, recipient []byte) (ageStanza, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(ephemeral); err != nil {
+		return ageStanza{}, err
+	}
+	share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	//fails on low order points, which would give an all zero shared secret
+	shared, err := curve25519.X25519(ephemeral, recipient)
+	if err != nil {
+		return ageStanza{}, ErrInvalidAgeRecipient
+	}
+
+	salt := append(append([]byte{}, share...), recipient...)
+	wrapKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(AGE_X25519_LABEL)), wrapKey); err != nil {
+		return ageStanza{}, err
+	}
+
+	body, err := ageWrapFileKey(wrapKey, fileKey)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	return ageStanza{Type: "X25519", Args: []string{ageBase64.EncodeToString(share)}, Body: body}, nil
+}
+
+func ageScryptStanza(fileKey []byte, passphrase string, logN int) (ageStanza, error) {
+	salt := make([]byte, AGE_SCRYPT_SALT_SIZE)
+	if _, err := rand.Read(salt); err != nil {
+		return ageStanza{}, err
+	}
+
+	wrapKey, err := scrypt.Key([]byte(passphrase), append([]byte(AGE_SCRYPT_LABEL), salt...), 1<<logN, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return ageStanza{}, err
+	}
+
+	body, err := ageWrapFileKey(wrapKey, fileKey)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	return ageStanza{Type: "scrypt", Args: []string{ageBase64.EncodeToString(salt), strconv.Itoa(logN)}, Body: body}, nil
+}
+
+func writeAgeStanza(buffer *bytes.Buffer, stanza ageStanza) {
+	buffer.WriteString("-> " + stanza.Type)
+	if len(stanza.Args) > 0 {
+		buffer.WriteString(" " + strings.Join(stanza.Args, " "))
+	}
+	buffer.WriteByte('\n')
+
+	//the last body line is always shorter than a full line, so a body of a multiple of 48 bytes ends with an empty line
+	body := ageBase64.EncodeToString(stanza.Body)
+	for len(body) >= AGE_COLUMNS_PER_LINE {
+		buffer.WriteString(body[:AGE_COLUMNS_PER_LINE] + "\n")
+		body = body[AGE_COLUMNS_PER_LINE:]
+	}
+	buffer.WriteString(body + "\n")
+}
+
+func ageStreamKey(fileKey []byte, nonce []byte) ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	_, err := io.ReadFull(hkdf.New(sha256.New, fileKey, nonce, []byte("payload")), key)
+	return key, err
+}
+
+func ageSealPayload(buffer *bytes.Buffer, fileKey []byte, plaintext []byte) error {
+	//the STREAM construction, 64 KiB chunks with a big endian counter nonce whose last byte marks the final chunk
+	nonce := make([]byte, AGE_PAYLOAD_NONCE_SIZE)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	buffer.Write(nonce)
+
+	streamKey, err := ageStreamKey(fileKey, nonce)
+	if err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.New(streamKey)
+	if err != nil {
+		return err
+	}
+
+	chunkNonce := make([]byte, chacha20poly1305.NonceSize)
+	for counter := uint64(0); ; counter++ {
+		size := min(len(plaintext), AGE_CHUNK_SIZE)
+		chunk := plaintext[:size]
+		plaintext = plaintext[size:]
+
+		//only an empty file may have an empty chunk, and then only as its single final chunk
+		last := len(plaintext) == 0
+		binary.BigEndian.PutUint64(chunkNonce[3:11], counter)
+		chunkNonce[11] = 0
+		if last {
+			chunkNonce[11] = 1
+		}
+		buffer.Write(aead.Seal(nil, chunkNonce, chunk, nil))
+		if last {
+			return nil
+		}
+	}
+}
+
+func EncryptAge(plaintext []byte, recipients [][]byte, passphrase string) ([]byte, error) {
+	//returns the plaintext as an age v1 file, readable by any of the X25519 recipients
+	//or, when a passphrase is given instead, by the passphrase through an scrypt stanza
+	if len(recipients) == 0 && len(passphrase) == 0 {
+		return nil, ErrNoAgeRecipients
+	}
+	if len(recipients) > 0 && len(passphrase) > 0 {
+		return nil, ErrAgeScryptNotAlone
+	}
+
+	fileKey := make([]byte, AGE_FILE_KEY_SIZE)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	var stanzas []ageStanza
+	for _, recipient := range recipients {
+		stanza, err := ageX25519Stanza(fileKey, recipient)
+		if err != nil {
+			return nil, err
+		}
+		stanzas = append(stanzas, stanza)
+	}
+	if len(passphrase) > 0 {
+		stanza, err := ageScryptStanza(fileKey, passphrase, AGE_SCRYPT_LOG_N)
+		if err != nil {
+			return nil, err
+		}
+		stanzas = append(stanzas, stanza)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(AGE_INTRO + "\n")
+	for _, stanza := range stanzas {
+		writeAgeStanza(&out, stanza)
+	}
+
+	//the header mac covers everything up to and including the "---" of the last line
+	out.WriteString("---")
+	macKey := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, fileKey, nil, []byte("header")), macKey); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(out.Bytes())
+	out.WriteString(" " + ageBase64.EncodeToString(mac.Sum(nil)) + "\n")
+
+	if err := ageSealPayload(&out, fileKey, plaintext); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
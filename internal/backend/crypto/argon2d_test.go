@@ -0,0 +1,36 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestArgon2dRFC9106(t *testing.T) {
+	//section 5.1 of RFC 9106, the only vector using a secret and associated data, which Argon2dKey leaves empty
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+	want := "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"
+
+	got := argon2DeriveKey(argon2d, password, salt, secret, data, 3, 32, 4, 32)
+	if hex.EncodeToString(got) != want {
+		t.Errorf("got %x, want %s", got, want)
+	}
+}
+
+func TestArgon2idMatchesXCrypto(t *testing.T) {
+	//the id mode shares every step but the addressing with the d mode, matching x/crypto checks the common code
+	password := []byte("password")
+	salt := []byte("somesaltsomesalt")
+	for _, threads := range []uint8{1, 4} {
+		got := argon2DeriveKey(argon2id, password, salt, nil, nil, 2, 64, threads, 32)
+		want := argon2.IDKey(password, salt, 2, 64, threads, 32)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d threads: got %x, want %x", threads, got, want)
+		}
+	}
+}
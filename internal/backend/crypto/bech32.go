@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"errors"
+	"strings"
+)
+
+// Bech32 as specified by BIP 173, which age uses to encode its X25519 recipients.
+
+const BECH32_CHARSET = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var ErrInvalidBech32 = errors.New("invalid bech32 string")
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, value := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	//regroups the data from words of fromBits into words of toBits
+	var converted []byte
+	acc, bits := uint32(0), uint(0)
+	maxValue := uint32(1)<<toBits - 1
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, ErrInvalidBech32
+		}
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			converted = append(converted, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			converted = append(converted, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, ErrInvalidBech32
+	}
+	return converted, nil
+}
+
+func Bech32Encode(hrp string, data []byte) (string, error) {
+	//returns the lowercase bech32 encoding of the data with the human readable part
+	words, err := bech32ConvertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	values := append(bech32HrpExpand(hrp), words...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var encoded strings.Builder
+	encoded.WriteString(strings.ToLower(hrp))
+	encoded.WriteByte('1')
+	for _, word := range words {
+		encoded.WriteByte(BECH32_CHARSET[word])
+	}
+	for i := 0; i < 6; i++ {
+		encoded.WriteByte(BECH32_CHARSET[polymod>>(5*(5-i))&31])
+	}
+	return encoded.String(), nil
+}
+
+func Bech32Decode(encoded string) (string, []byte, error) {
+	//returns the human readable part and the decoded data, mixed case strings are rejected
+	if strings.ToLower(encoded) != encoded && strings.ToUpper(encoded) != encoded {
+		return "", nil, ErrInvalidBech32
+	}
+	encoded = strings.ToLower(encoded)
+
+	separator := strings.LastIndexByte(encoded, '1')
+	if separator < 1 || separator+7 > len(encoded) {
+		return "", nil, ErrInvalidBech32
+	}
+	hrp := encoded[:separator]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, ErrInvalidBech32
+		}
+	}
+
+	words := make([]byte, 0, len(encoded)-separator-1)
+	for i := separator + 1; i < len(encoded); i++ {
+		index := strings.IndexByte(BECH32_CHARSET, encoded[i])
+		if index < 0 {
+			return "", nil, ErrInvalidBech32
+		}
+		words = append(words, byte(index))
+	}
+	if bech32Polymod(append(bech32HrpExpand(hrp), words...)) != 1 {
+		return "", nil, ErrInvalidBech32
+	}
+
+	data, err := bech32ConvertBits(words[:len(words)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
@@ -25,12 +25,18 @@ const (
 
 	//length of a min salt in bytes
 	MIN_SALT_LEN = 16
+
+	//what EncryptPassword adds to the plaintext, its nonce and the poly1305 tag
+	CIPHERTEXT_OVERHEAD = chacha20poly1305.NonceSizeX + chacha20poly1305.Overhead
 )
 
 var (
-	Err0LengthPassword = errors.New("0 length password given")
-	ErrInvalidSalt     = errors.New("given salt is too short, need at least 16 bytes")
-	Err0LengthKey      = errors.New("shake: input key is empty")
+	Err0LengthPassword  = errors.New("0 length password given")
+	ErrInvalidSalt      = errors.New("given salt is too short, need at least 16 bytes")
+	Err0LengthKey       = errors.New("shake: input key is empty")
+	ErrInvalidKdfParams = errors.New("invalid argon2id parameters")
+	ErrInvalidKey       = errors.New("cipher creation failed, invalid key")
+	ErrShortCiphertext  = errors.New("decrypt: ciphertext too short")
 )
 
 func Genkey(password []byte, salt []byte) ([]byte, error) {
@@ -50,6 +56,26 @@ func Genkey(password []byte, salt []byte) ([]byte, error) {
 	return key, nil
 }
 
+func GenkeyWithParams(password []byte, salt []byte, time uint32, memory uint32, threads uint8) ([]byte, error) {
+	//like Genkey, but with explicit argon2id cost parameters, for files that record the parameters they were written with
+
+	if len(password) == 0 {
+		return []byte{}, Err0LengthPassword
+	}
+
+	if len(salt) < MIN_SALT_LEN {
+		return nil, ErrInvalidSalt
+	}
+
+	if time < 1 || threads < 1 || memory < 8*uint32(threads) {
+		return nil, ErrInvalidKdfParams
+	}
+
+	key := argon2.IDKey(password, salt, time, memory, threads, KEY_LEN)
+
+	return key, nil
+}
+
 func HashPassword(key []byte) ([]byte, error) {
 	//use sha3 to hash a given securely generated key
 	//pretty redundant, since we can store argon2id output in db,
@@ -75,7 +101,7 @@ func EncryptPassword(password []byte, key []byte) ([]byte, error) {
 
 	aead, err := chacha20poly1305.NewX(key)
 	if err != nil {
-		panic("cipher creation failed")
+		return []byte{}, ErrInvalidKey
 	}
 
 	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(password)+aead.Overhead())
@@ -88,15 +114,16 @@ func EncryptPassword(password []byte, key []byte) ([]byte, error) {
 
 func DecryptPassword(encryptedPassword []byte, key []byte) ([]byte, error) {
 	//use chacha20 to decrpyt a given password using the securely created key
+	//the key and ciphertext may come from files or other users, so bad ones are errors rather than panics
 	aead, err := chacha20poly1305.NewX(key)
 	if err != nil {
-		panic("cipher creation failed")
+		return []byte{}, ErrInvalidKey
 	}
 
 	nsize := aead.NonceSize()
 
-	if len(encryptedPassword) < nsize {
-		panic("decrypt: ciphertext too short")
+	if len(encryptedPassword) < nsize+aead.Overhead() {
+		return []byte{}, ErrShortCiphertext
 	}
 
 	nonce, ciphertext := encryptedPassword[:nsize], encryptedPassword[nsize:]
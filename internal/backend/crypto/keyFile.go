@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+)
+
+// A key file is a second factor next to the master password: the SHA-256 of its content is appended
+// to the password before key derivation, so the master key cannot be derived without both.
+// Any file works, generated ones hold random bytes written out as hex so they survive being copied as text.
+
+const KEY_FILE_RANDOM_SIZE = 32
+
+var ErrEmptyKeyFile = errors.New("key file is empty")
+
+func HashKeyFile(path string) ([]byte, error) {
+	//returns the SHA-256 of the content of the key file
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, ErrEmptyKeyFile
+	}
+	return hash.Sum(nil), nil
+}
+
+func GenerateKeyFile(path string) error {
+	//writes a new random key file readable only by its owner, an existing file is never overwritten
+	raw := make([]byte, KEY_FILE_RANDOM_SIZE)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	defer clear(raw)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(hex.EncodeToString(raw) + "\n"); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
+
+func GenkeyWithKeyFile(password []byte, keyFileHash []byte, salt []byte) ([]byte, error) {
+	//like Genkey, with the hash of the key file mixed into the argon2id input when one is given
+	if len(keyFileHash) == 0 {
+		return Genkey(password, salt)
+	}
+	if len(password) == 0 {
+		return []byte{}, Err0LengthPassword
+	}
+	//the hash has a fixed length, so no two password and key file pairs give the same input
+	input := make([]byte, 0, len(password)+len(keyFileHash))
+	input = append(append(input, password...), keyFileHash...)
+	defer clear(input)
+	return Genkey(input, salt)
+}
@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Sealed boxes encrypt to an X25519 public key: an ephemeral key pair is generated per message,
+// its public half is prepended to the ciphertext, and the shared secret is stretched with HKDF-SHA256
+// into the key of an EncryptPassword ciphertext. Only the holder of the private key can open them.
+
+const SEAL_LABEL = "passmngr/v1/sealed-box"
+
+var (
+	ErrInvalidPublicKey = errors.New("invalid X25519 public key")
+	ErrInvalidSealedBox = errors.New("sealed box is malformed or not addressed to this key")
+)
+
+func GenerateSymmetricKey() ([]byte, error) {
+	//returns a random key for EncryptPassword
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func GenerateKeyPair() ([]byte, []byte, error) {
+	//returns a new X25519 public key and its private key
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(private); err != nil {
+		return nil, nil, err
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	return public, private, nil
+}
+
+func sealKey(shared []byte, share []byte, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte{}, share...), recipient...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(SEAL_LABEL)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func SealToPublicKey(plaintext []byte, recipient []byte) ([]byte, error) {
+	//returns the plaintext encrypted so only the private key of the recipient opens it
+	if len(recipient) != curve25519.PointSize {
+		return nil, ErrInvalidPublicKey
+	}
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(ephemeral); err != nil {
+		return nil, err
+	}
+	defer clear(ephemeral)
+	share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	//fails on low order points, which would give an all zero shared secret
+	shared, err := curve25519.X25519(ephemeral, recipient)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	key, err := sealKey(shared, share, recipient)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	ciphertext, err := EncryptPassword(plaintext, key)
+	if err != nil {
+		return nil, err
+	}
+	return append(share, ciphertext...), nil
+}
+
+func OpenSealed(sealed []byte, private []byte) ([]byte, error) {
+	//returns the plaintext of a box sealed to the public key of the private key
+	if len(sealed) <= curve25519.PointSize {
+		return nil, ErrInvalidSealedBox
+	}
+	share := sealed[:curve25519.PointSize]
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(private, share)
+	if err != nil {
+		return nil, ErrInvalidSealedBox
+	}
+
+	key, err := sealKey(shared, share, public)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	plaintext, err := DecryptPassword(sealed[curve25519.PointSize:], key)
+	if err != nil {
+		return nil, ErrInvalidSealedBox
+	}
+	return plaintext, nil
+}
+
+func KeyFingerprint(public []byte) string {
+	//returns a short hex digest of the public key, for users to compare out of band
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,135 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+)
+
+const (
+	//hash functions allowed by RFC 6238 for the HMAC
+	OTP_ALGORITHM_SHA1   = "SHA1"
+	OTP_ALGORITHM_SHA256 = "SHA256"
+	OTP_ALGORITHM_SHA512 = "SHA512"
+
+	//defaults used by practically every issuer, and assumed by otpauth URIs without parameters
+	DEFAULT_OTP_ALGORITHM = OTP_ALGORITHM_SHA1
+	DEFAULT_OTP_DIGITS    = 6
+	DEFAULT_OTP_PERIOD    = 30
+
+	//the only code lengths RFC 4226 and RFC 6238 define
+	OTP_DIGITS_SHORT = 6
+	OTP_DIGITS_LONG  = 8
+)
+
+var (
+	Err0LengthOTPSecret        = errors.New("0 length otp secret given")
+	ErrUnsupportedOTPAlgorithm = errors.New("otp algorithm must be one of SHA1, SHA256, SHA512")
+	ErrInvalidOTPDigits        = fmt.Errorf("otp digits must be %d or %d", OTP_DIGITS_SHORT, OTP_DIGITS_LONG)
+	ErrInvalidOTPPeriod        = errors.New("otp period must be a positive number of seconds")
+)
+
+func otpHashFunc(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case OTP_ALGORITHM_SHA1:
+		return sha1.New, nil
+	case OTP_ALGORITHM_SHA256:
+		return sha256.New, nil
+	case OTP_ALGORITHM_SHA512:
+		return sha512.New, nil
+	default:
+		return nil, ErrUnsupportedOTPAlgorithm
+	}
+}
+
+func hotpTruncate(secret []byte, counter uint64, algorithm string) (uint32, error) {
+	//HMAC the big endian counter and apply the dynamic truncation of RFC 4226 section 5.3
+	hashFunc, err := otpHashFunc(algorithm)
+	if err != nil {
+		return 0, err
+	}
+
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+
+	mac := hmac.New(hashFunc, secret)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	return binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff, nil
+}
+
+func GenerateHOTP(secret []byte, counter uint64, digits int, algorithm string) (string, error) {
+	//returns the RFC 4226 code for the given counter, zero padded to the requested number of digits
+	if len(secret) == 0 {
+		return "", Err0LengthOTPSecret
+	}
+	if digits != OTP_DIGITS_SHORT && digits != OTP_DIGITS_LONG {
+		return "", ErrInvalidOTPDigits
+	}
+
+	truncated, err := hotpTruncate(secret, counter, algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	modulo := uint32(1)
+	for range digits {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, truncated%modulo), nil
+}
+
+func GenerateTOTP(secret []byte, at time.Time, period int, digits int, algorithm string) (string, int, error) {
+	//returns the RFC 6238 code valid at the given time, and the number of seconds it stays valid for
+	if period <= 0 {
+		return "", 0, ErrInvalidOTPPeriod
+	}
+
+	unix := at.Unix()
+	counter := uint64(unix / int64(period))
+	remaining := period - int(unix%int64(period))
+
+	code, err := GenerateHOTP(secret, counter, digits, algorithm)
+	if err != nil {
+		return "", 0, err
+	}
+	return code, remaining, nil
+}
+
+// STEAM_GUARD_CHARS is the alphabet of Steam Guard codes, which drops vowels and lookalike characters.
+var STEAM_GUARD_CHARS = []byte("23456789BCDFGHJKMNPQRTVWXY")
+
+// STEAM_GUARD_LENGTH is the fixed number of characters of a Steam Guard code.
+const STEAM_GUARD_LENGTH = 5
+
+func GenerateSteamGuard(secret []byte, at time.Time) (string, int, error) {
+	//Steam Guard is a SHA1 TOTP with a 30 second period, whose truncated value is written in the steam alphabet
+	//returns the code valid at the given time, and the number of seconds it stays valid for
+	if len(secret) == 0 {
+		return "", 0, Err0LengthOTPSecret
+	}
+
+	unix := at.Unix()
+	counter := uint64(unix / DEFAULT_OTP_PERIOD)
+	remaining := DEFAULT_OTP_PERIOD - int(unix%DEFAULT_OTP_PERIOD)
+
+	truncated, err := hotpTruncate(secret, counter, OTP_ALGORITHM_SHA1)
+	if err != nil {
+		return "", 0, err
+	}
+
+	code := make([]byte, STEAM_GUARD_LENGTH)
+	for i := range code {
+		code[i] = STEAM_GUARD_CHARS[truncated%uint32(len(STEAM_GUARD_CHARS))]
+		truncated /= uint32(len(STEAM_GUARD_CHARS))
+	}
+	return string(code), remaining, nil
+}
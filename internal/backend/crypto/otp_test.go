@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateHOTPRFC4226(t *testing.T) {
+	//appendix D of RFC 4226
+	secret := []byte("12345678901234567890")
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, want := range expected {
+		got, err := GenerateHOTP(secret, uint64(counter), 6, OTP_ALGORITHM_SHA1)
+		if err != nil {
+			t.Fatalf("counter %d: %v", counter, err)
+		}
+		if got != want {
+			t.Errorf("counter %d: got %s, want %s", counter, got, want)
+		}
+	}
+}
+
+func TestGenerateTOTPRFC6238(t *testing.T) {
+	//appendix B of RFC 6238, the seed of every algorithm is as long as its hash output
+	secrets := map[string][]byte{
+		OTP_ALGORITHM_SHA1:   []byte("12345678901234567890"),
+		OTP_ALGORITHM_SHA256: []byte("12345678901234567890123456789012"),
+		OTP_ALGORITHM_SHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	vectors := []struct {
+		unix      int64
+		algorithm string
+		want      string
+	}{
+		{59, OTP_ALGORITHM_SHA1, "94287082"},
+		{59, OTP_ALGORITHM_SHA256, "46119246"},
+		{59, OTP_ALGORITHM_SHA512, "90693936"},
+		{1111111109, OTP_ALGORITHM_SHA1, "07081804"},
+		{1111111109, OTP_ALGORITHM_SHA256, "68084774"},
+		{1111111109, OTP_ALGORITHM_SHA512, "25091201"},
+		{1111111111, OTP_ALGORITHM_SHA1, "14050471"},
+		{1111111111, OTP_ALGORITHM_SHA256, "67062674"},
+		{1111111111, OTP_ALGORITHM_SHA512, "99943326"},
+		{1234567890, OTP_ALGORITHM_SHA1, "89005924"},
+		{1234567890, OTP_ALGORITHM_SHA256, "91819424"},
+		{1234567890, OTP_ALGORITHM_SHA512, "93441116"},
+		{2000000000, OTP_ALGORITHM_SHA1, "69279037"},
+		{2000000000, OTP_ALGORITHM_SHA256, "90698825"},
+		{2000000000, OTP_ALGORITHM_SHA512, "38618901"},
+		{20000000000, OTP_ALGORITHM_SHA1, "65353130"},
+		{20000000000, OTP_ALGORITHM_SHA256, "77737706"},
+		{20000000000, OTP_ALGORITHM_SHA512, "47863826"},
+	}
+
+	for _, vector := range vectors {
+		got, remaining, err := GenerateTOTP(secrets[vector.algorithm], time.Unix(vector.unix, 0), 30, 8, vector.algorithm)
+		if err != nil {
+			t.Fatalf("%s at %d: %v", vector.algorithm, vector.unix, err)
+		}
+		if got != vector.want {
+			t.Errorf("%s at %d: got %s, want %s", vector.algorithm, vector.unix, got, vector.want)
+		}
+		if want := 30 - int(vector.unix%30); remaining != want {
+			t.Errorf("%s at %d: %d seconds remaining, want %d", vector.algorithm, vector.unix, remaining, want)
+		}
+	}
+}
+
+func TestGenerateHOTPDigits(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	for _, digits := range []int{0, 5, 7, 9} {
+		if _, err := GenerateHOTP(secret, 0, digits, OTP_ALGORITHM_SHA1); err != ErrInvalidOTPDigits {
+			t.Errorf("%d digits: got %v, want %v", digits, err, ErrInvalidOTPDigits)
+		}
+	}
+}
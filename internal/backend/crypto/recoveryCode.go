@@ -0,0 +1,45 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+)
+
+const (
+	// RECOVERY_CODE_BYTES gives recovery codes 160 bits of entropy
+	RECOVERY_CODE_BYTES = 20
+	// RECOVERY_CODE_GROUP is the number of characters between dashes, for reading the code off paper
+	RECOVERY_CODE_GROUP = 4
+)
+
+var ErrInvalidRecoveryCode = errors.New("recovery code is malformed")
+
+func GenerateRecoveryCode() (string, error) {
+	//returns a random code in dash separated groups, like ABCD-EFGH-...
+	raw := make([]byte, RECOVERY_CODE_BYTES)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+
+	var code strings.Builder
+	for i := 0; i < len(encoded); i += RECOVERY_CODE_GROUP {
+		if i != 0 {
+			code.WriteByte('-')
+		}
+		code.WriteString(encoded[i:min(i+RECOVERY_CODE_GROUP, len(encoded))])
+	}
+	return code.String(), nil
+}
+
+func NormalizeRecoveryCode(code string) ([]byte, error) {
+	//returns the bytes of the code, ignoring case, dashes and spaces so a code typed back by hand still matches
+	cleaned := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(cleaned)
+	if err != nil || len(raw) != RECOVERY_CODE_BYTES {
+		return nil, ErrInvalidRecoveryCode
+	}
+	return raw, nil
+}
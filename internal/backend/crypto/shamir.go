@@ -0,0 +1,133 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// Shamir secret sharing over GF(256), byte by byte: every byte of the secret is the constant term of a random
+// polynomial of degree threshold-1, and a share holds the values of all those polynomials at its own x.
+// Any threshold shares determine the polynomials, fewer reveal nothing about the secret.
+// Shares are laid out as their x coordinate followed by one value per secret byte.
+
+const MAX_SHAMIR_SHARES = 255
+
+var (
+	ErrInvalidThreshold    = errors.New("threshold must be at least 2 and no more than the number of shares, which is at most 255")
+	ErrTooFewShares        = errors.New("not enough shares to reconstruct the secret")
+	ErrShareLengthMismatch = errors.New("shares have different lengths")
+	ErrDuplicateShare      = errors.New("the same share was given twice")
+	ErrInvalidShare        = errors.New("share is malformed")
+)
+
+// gf256Exp and gf256Log are the powers and logarithms of the generator 3 in GF(2^8) modulo x^8+x^4+x^3+x+1,
+// exp is doubled so a sum of two logarithms never needs reducing
+var (
+	gf256Exp [510]byte
+	gf256Log [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gf256Exp[i] = x
+		gf256Exp[i+255] = x
+		gf256Log[x] = byte(i)
+		//multiplying by 3 is x xor 2x, with 2x reduced by the field polynomial when it overflows
+		double := x << 1
+		if x&0x80 != 0 {
+			double ^= 0x1b
+		}
+		x ^= double
+	}
+}
+
+func gf256Mul(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+int(gf256Log[b])]
+}
+
+func gf256Div(a byte, b byte) byte {
+	//b is never 0, the x coordinates of shares are distinct and non zero
+	if a == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+255-int(gf256Log[b])]
+}
+
+func SplitSecret(secret []byte, threshold int, shares int) ([][]byte, error) {
+	//returns shares of the secret, any threshold of which reconstruct it
+	if threshold < 2 || threshold > shares || shares > MAX_SHAMIR_SHARES {
+		return nil, ErrInvalidThreshold
+	}
+	if len(secret) == 0 {
+		return nil, ErrInvalidShare
+	}
+
+	coefficients := make([]byte, threshold)
+	defer clear(coefficients)
+	result := make([][]byte, shares)
+	for i := range result {
+		result[i] = make([]byte, len(secret)+1)
+		result[i][0] = byte(i + 1)
+	}
+
+	for position, secretByte := range secret {
+		coefficients[0] = secretByte
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range result {
+			//horner evaluation at the x coordinate of the share
+			x := share[0]
+			var y byte
+			for degree := threshold - 1; degree >= 0; degree-- {
+				y = gf256Mul(y, x) ^ coefficients[degree]
+			}
+			share[position+1] = y
+		}
+	}
+	return result, nil
+}
+
+func CombineShares(shares [][]byte) ([]byte, error) {
+	//returns the secret interpolated from the shares, which must be at least as many as the threshold they were split with
+	//too few shares give a wrong secret rather than an error, callers check the result against something they know
+	if len(shares) < 2 {
+		return nil, ErrTooFewShares
+	}
+	length := len(shares[0])
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != length {
+			return nil, ErrShareLengthMismatch
+		}
+		if length < 2 || share[0] == 0 {
+			return nil, ErrInvalidShare
+		}
+		if seen[share[0]] {
+			return nil, ErrDuplicateShare
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, length-1)
+	for i, share := range shares {
+		//the lagrange basis polynomial of this share evaluated at 0, subtraction is xor in GF(2^8)
+		numerator, denominator := byte(1), byte(1)
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+			numerator = gf256Mul(numerator, other[0])
+			denominator = gf256Mul(denominator, share[0]^other[0])
+		}
+		basis := gf256Div(numerator, denominator)
+		for position := range secret {
+			secret[position] ^= gf256Mul(share[position+1], basis)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,184 @@
+package dbInterface
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var ErrIntegrityCheckFailed = errors.New("database integrity check failed")
+
+func BackupDb(destPath string) error {
+	//copies the live database into a new file at destPath with sqlites online backup api
+	//the copy is consistent even while other connections keep using the database
+	dest, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			backup, err := destDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			//-1 copies every page in one step, so the copy is a single snapshot of the source
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+func VerifyDbFile(path string) (int, error) {
+	//runs sqlites integrity check on the database file without modifying it
+	//returns the schema version of the file, or a possible error
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	file, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var result string
+	if err := file.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrIntegrityCheckFailed, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%w: %s", ErrIntegrityCheckFailed, result)
+	}
+
+	//a file without a users table is a sqlite database, but not a vault
+	var tables int
+	if err := file.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&tables); err != nil || tables != 1 {
+		return 0, fmt.Errorf("%w: not a vault database", ErrIntegrityCheckFailed)
+	}
+
+	var version int
+	if err := file.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	if version > SCHEMA_VERSION {
+		return 0, fmt.Errorf("database schema version %d is newer than supported version %d", version, SCHEMA_VERSION)
+	}
+	return version, nil
+}
+
+func ReplaceDb(path string) error {
+	//atomically replaces the live database with the file at path and reopens it, migrating it if it is older
+	//the file is moved, the caller hands over ownership of it
+	if err := db.Close(); err != nil {
+		return err
+	}
+	//rename is atomic within a filesystem, the database is either the old or the new file, never a mix
+	if err := os.Rename(path, DB_PATH); err != nil {
+		if reopenErr := OpenDb(); reopenErr != nil {
+			return fmt.Errorf("%w, reopening the database also failed: %w", err, reopenErr)
+		}
+		return err
+	}
+	//a journal left by the old file would be replayed into the new one
+	os.Remove(DB_PATH + "-journal")
+	return OpenDb()
+}
+
+func (vault Vault) FetchUsernames() ([]string, error) {
+	//returns the names of every user of the vault
+	rows, err := vault.conn.Query("SELECT username FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usernames := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+func ReplaceUserEntries(uid int64, records []EntryRecord) error {
+	//makes the entries of the user exactly the given records, matched by uuid, in a single transaction
+	//entries without a record are deleted and tombstoned, the others are overwritten in place so their shares survive
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	keep := make(map[string]bool, len(records))
+	for _, record := range records {
+		keep[record.UUID] = true
+	}
+
+	rows, err := tx.Query("SELECT uuid FROM entries WHERE user_id = ?", uid)
+	if err != nil {
+		return err
+	}
+	removed := make([]string, 0)
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			rows.Close()
+			return err
+		}
+		if !keep[uuid] {
+			removed = append(removed, uuid)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, uuid := range removed {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO entry_tombstones (user_id, uuid, deleted_at) VALUES (?, ?, `+SQL_NOW_MS+`)`, uid, uuid)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM entries WHERE user_id = ? AND uuid = ?", uid, uuid); err != nil {
+			return err
+		}
+	}
+
+	//kept entries may trade names with each other, they are moved out of the way before any is overwritten
+	if _, err := tx.Exec("UPDATE entries SET name = char(0) || uuid WHERE user_id = ?", uid); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := upsertEntryRecord(tx, uid, record); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM entry_tombstones WHERE user_id = ? AND uuid = ?", uid, record.UUID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
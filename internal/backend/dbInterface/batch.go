@@ -0,0 +1,224 @@
+package dbInterface
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type EntryRecord struct {
+	// UUID and ModifiedAt are filled in by the database for new entries, a sync sets them to the peers values
+	UUID          string
+	ModifiedAt    int64
+	Name          string
+	Username      string
+	EncryptedData []byte
+	Folder        string
+	Tags          []string
+	Fields        []FieldRecord
+	EncryptedOTP  []byte
+	OTPCounter    uint64
+	// Replace overwrites an existing entry of the same name, with everything attached to it, instead of inserting
+	Replace bool
+}
+
+func insertEntryRecord(tx *sql.Tx, uid int64, record EntryRecord) error {
+	var entryId int64
+	if record.Replace {
+		err := tx.QueryRow("SELECT id FROM entries WHERE user_id = ? AND name = ?", uid, record.Name).Scan(&entryId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	return writeEntryRecord(tx, uid, record, entryId)
+}
+
+func upsertEntryRecord(tx *sql.Tx, uid int64, record EntryRecord) error {
+	//writes the record over the entry with the same uuid, or adds it
+	var entryId int64
+	err := tx.QueryRow("SELECT id FROM entries WHERE user_id = ? AND uuid = ?", uid, record.UUID).Scan(&entryId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return writeEntryRecord(tx, uid, record, entryId)
+}
+
+func writeEntryRecord(tx *sql.Tx, uid int64, record EntryRecord, entryId int64) error {
+	//inserts the record, or overwrites the entry with the given id when it is not 0
+	//the same checks as InsertUserAccount, a batch cannot store what a single insert refuses
+	if len(record.Name) == 0 {
+		return Err0LengthUserAccname
+	}
+	if len(record.Username) == 0 {
+		return Err0LengthUserAccUsername
+	}
+
+	var folderId sql.NullInt64
+	if len(record.Folder) != 0 {
+		id, err := ensureFolder(tx, uid, record.Folder)
+		if err != nil {
+			return err
+		}
+		folderId = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	var uuid sql.NullString
+	if len(record.UUID) != 0 {
+		uuid = sql.NullString{String: record.UUID, Valid: true}
+	}
+	if entryId == 0 {
+		result, err := tx.Exec("INSERT INTO entries (user_id, name, acc_username, encrypted_data, folder_id, uuid, modified_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			uid, record.Name, record.Username, record.EncryptedData, folderId, uuid, record.ModifiedAt)
+		if err != nil {
+			return err
+		}
+		if entryId, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	} else {
+		//the row is kept, so shares and everything else pointing at its id survive the overwrite
+		_, err := tx.Exec("UPDATE entries SET name = ?, acc_username = ?, encrypted_data = ?, folder_id = ?, uuid = COALESCE(?, uuid) WHERE id = ?",
+			record.Name, record.Username, record.EncryptedData, folderId, uuid, entryId)
+		if err != nil {
+			return err
+		}
+		for _, table := range []string{"entry_fields", "entry_tags", "entry_otp"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE entry_id = ?", entryId); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, field := range record.Fields {
+		_, err := tx.Exec(`INSERT INTO entry_fields (entry_id, name, field_type, encrypted_data) VALUES (?, ?, ?, ?)
+			ON CONFLICT (entry_id, name) DO UPDATE SET field_type = excluded.field_type, encrypted_data = excluded.encrypted_data`,
+			entryId, field.Name, field.FieldType, field.EncryptedData)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tagName := range record.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (user_id, name) VALUES (?, ?)", uid, tagName); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT OR IGNORE INTO entry_tags (entry_id, tag_id)
+			SELECT ?, id FROM tags WHERE user_id = ? AND name = ?`, entryId, uid, tagName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(record.EncryptedOTP) != 0 {
+		_, err := tx.Exec("INSERT INTO entry_otp (entry_id, encrypted_data, counter) VALUES (?, ?, ?)", entryId, record.EncryptedOTP, int64(record.OTPCounter))
+		if err != nil {
+			return err
+		}
+	}
+
+	//inserting the fields, tags and otp secret moved modified_at to now, a synced entry keeps the time of its last real change
+	if uuid.Valid {
+		if _, err := tx.Exec("UPDATE entries SET modified_at = ? WHERE id = ?", record.ModifiedAt, entryId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func InsertUserAccountsBatch(uid int64, records []EntryRecord) (int, error) {
+	//inserts every record with its folder, tags, fields and otp secret in a single transaction
+	//returns the number of inserted entries, or the first error, in which case nothing is inserted
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, record := range records {
+		if err := insertEntryRecord(tx, uid, record); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+func FetchUserEntryRecords(uid int64) ([]EntryRecord, error) {
+	//returns every entry of the user with its folder, tags, fields and otp secret, sorted by name
+	return fetchUserEntryRecords(db, uid)
+}
+
+func fetchUserEntryRecords(conn *sql.DB, uid int64) ([]EntryRecord, error) {
+	rows, err := conn.Query(`SELECT e.id, e.uuid, e.modified_at, e.name, e.acc_username, e.encrypted_data, COALESCE(f.path, ''), o.encrypted_data, COALESCE(o.counter, 0)
+		FROM entries e
+		LEFT JOIN folders f ON f.id = e.folder_id
+		LEFT JOIN entry_otp o ON o.entry_id = e.id
+		WHERE e.user_id = ? ORDER BY e.name`, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]EntryRecord, 0)
+	positions := make(map[int64]int)
+	for rows.Next() {
+		var entryId, counter int64
+		record := EntryRecord{Tags: make([]string, 0), Fields: make([]FieldRecord, 0)}
+		if err := rows.Scan(&entryId, &record.UUID, &record.ModifiedAt, &record.Name, &record.Username, &record.EncryptedData, &record.Folder, &record.EncryptedOTP, &counter); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		record.OTPCounter = uint64(counter)
+		positions[entryId] = len(records)
+		records = append(records, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = conn.Query(`SELECT f.entry_id, f.name, f.field_type, f.encrypted_data FROM entry_fields f
+		JOIN entries e ON e.id = f.entry_id
+		WHERE e.user_id = ? ORDER BY f.name`, uid)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var entryId int64
+		var field FieldRecord
+		if err := rows.Scan(&entryId, &field.Name, &field.FieldType, &field.EncryptedData); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records[positions[entryId]].Fields = append(records[positions[entryId]].Fields, field)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = conn.Query(`SELECT et.entry_id, t.name FROM entry_tags et
+		JOIN tags t ON t.id = et.tag_id
+		WHERE t.user_id = ? ORDER BY t.name`, uid)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var entryId int64
+		var tagName string
+		if err := rows.Scan(&entryId, &tagName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records[positions[entryId]].Tags = append(records[positions[entryId]].Tags, tagName)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -22,6 +22,8 @@ var (
 	Err0LengthUserAccUsername = errors.New("given username for a user account name is length 0")
 )
 
+const DB_PATH = "passwordManagerDb.db"
+
 var db *sql.DB
 
 func OpenDb() error {
@@ -29,27 +31,37 @@ func OpenDb() error {
 	//returns a error in 2 cases: If the database fails to connect, or if the foreign key pragma cannot be established
 
 	var err error
-	db, err = sql.Open("sqlite3", "passwordManagerDb.db")
+	db, err = openVaultDb(DB_PATH)
+	return err
+}
+
+func openVaultDb(path string) (*sql.DB, error) {
+	//opens the vault database at path, creating and migrating its schema as needed
+
+	//the pragma in the dsn is applied to every pooled connection, the exec below only covers the first one
+	conn, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
 	if err != nil {
-		return fmt.Errorf("failed to open db connection: %w", err)
+		return nil, fmt.Errorf("failed to open db connection: %w", err)
 	}
 
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	_, err = conn.Exec("PRAGMA foreign_keys = ON")
 	if err != nil {
-		return fmt.Errorf("failed to enable foreign keys: %w", err)
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
 	}
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS users (
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS users (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		username TEXT NOT NULL UNIQUE,
 		salt BLOB NOT NULL,
 		key_hash BLOB NOT NULL
 	)`)
 	if err != nil {
-		return fmt.Errorf("failed to create users table: %w", err)
+		conn.Close()
+		return nil, fmt.Errorf("failed to create users table: %w", err)
 	}
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS entries (
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS entries (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INTEGER NOT NULL,
 		name TEXT NOT NULL,
@@ -58,13 +70,100 @@ func OpenDb() error {
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	)`)
 	if err != nil {
-		return fmt.Errorf("failed to create entries table: %w", err)
+		conn.Close()
+		return nil, fmt.Errorf("failed to create entries table: %w", err)
+	}
+
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS entry_fields (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entry_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		field_type TEXT NOT NULL,
+		encrypted_data BLOB NOT NULL,
+		UNIQUE (entry_id, name),
+		FOREIGN KEY (entry_id) REFERENCES entries(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create entry_fields table: %w", err)
+	}
+
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS folders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		UNIQUE (user_id, path),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create folders table: %w", err)
+	}
+
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		UNIQUE (user_id, name),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create tags table: %w", err)
+	}
+
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS entry_tags (
+		entry_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (entry_id, tag_id),
+		FOREIGN KEY (entry_id) REFERENCES entries(id) ON DELETE CASCADE,
+		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create entry_tags table: %w", err)
+	}
+
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS entry_otp (
+		entry_id INTEGER PRIMARY KEY,
+		encrypted_data BLOB NOT NULL,
+		FOREIGN KEY (entry_id) REFERENCES entries(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create entry_otp table: %w", err)
+	}
+
+	if err := migrate(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	if err := createSyncSchema(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create sync tables: %w", err)
+	}
+	if err := createSharingSchema(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create sharing tables: %w", err)
+	}
+	if err := createOrganizationSchema(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create organization tables: %w", err)
+	}
+	if err := createEmergencySchema(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create emergency access tables: %w", err)
+	}
+	if err := createRecoverySchema(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create recovery tables: %w", err)
 	}
 
-	return nil
+	return conn, nil
 }
 
-func InsertUser(username string, salt []byte, masterKeyHash []byte) (string, error) {
+func InsertUser(username string, salt []byte, masterKeyHash []byte, wrappedVaultKey []byte, usesKeyFile bool) (string, error) {
 	//returns the username of the user created, or 2 possible errors
 	//If the given username of the user is empty, or if the query prep fails
 
@@ -72,7 +171,7 @@ func InsertUser(username string, salt []byte, masterKeyHash []byte) (string, err
 		return "", Err0LengthUsername
 	}
 
-	statement, err := db.Prepare("INSERT INTO users (username, salt, key_hash) VALUES (?, ?, ?)")
+	statement, err := db.Prepare("INSERT INTO users (username, salt, key_hash, wrapped_vault_key, uses_key_file) VALUES (?, ?, ?, ?, ?)")
 
 	if err != nil {
 		return "", err
@@ -80,7 +179,7 @@ func InsertUser(username string, salt []byte, masterKeyHash []byte) (string, err
 
 	defer statement.Close()
 
-	_, err = statement.Exec(username, salt, masterKeyHash)
+	_, err = statement.Exec(username, salt, masterKeyHash, wrappedVaultKey, usesKeyFile)
 	if err != nil {
 		return "", err
 	}
@@ -115,18 +214,23 @@ func DeleteUserAccount(accountName string, uid int64) (string, error) {
 	if len(accountName) == 0 {
 		return "", Err0LengthUserAccUsername
 	}
-	statement, err := db.Prepare("DELETE FROM entries WHERE user_id = ? AND name = ?")
+	tx, err := db.Begin()
 	if err != nil {
 		return "", err
 	}
+	defer tx.Rollback()
 
-	defer statement.Close()
-
-	_, err = statement.Exec(uid, accountName)
+	if err := tombstoneEntry(tx, uid, accountName); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("DELETE FROM entries WHERE user_id = ? AND name = ?", uid, accountName)
 	if err != nil {
 		return "", err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
 	return accountName, nil
 }
 
@@ -138,10 +242,10 @@ func FetchUser(username string) (userType.User, error) {
 		return userType.User{}, Err0LengthUsername
 	}
 
-	row := db.QueryRow("SELECT id, username, salt, key_hash FROM users WHERE username = ?", username)
+	row := db.QueryRow("SELECT id, username, salt, key_hash, wrapped_vault_key, uses_key_file FROM users WHERE username = ?", username)
 
 	var fetchedUser userType.User = userType.User{}
-	err := row.Scan(&fetchedUser.Uid, &fetchedUser.Name, &fetchedUser.Salt, &fetchedUser.MasterKeyHash)
+	err := row.Scan(&fetchedUser.Uid, &fetchedUser.Name, &fetchedUser.Salt, &fetchedUser.MasterKeyHash, &fetchedUser.WrappedVaultKey, &fetchedUser.UsesKeyFile)
 	if err != nil {
 		return userType.User{}, err
 	}
@@ -170,7 +274,7 @@ func FetchUserAccount(uid int64, accountName string) (string, []byte, error) {
 
 func FetchUserAccounts(uid int64) ([]string, error) {
 	//function to fetch the names the accounts of a user stored. Not usernames of accounts, the names of the accounts
-	rows, err := db.Query("SELECT name FROM entries WHERE user_id = ?", uid)
+	rows, err := db.Query("SELECT name FROM entries WHERE user_id = ? ORDER BY name", uid)
 	accNames := make([]string, 0)
 	if err != nil {
 		return nil, err
@@ -217,3 +321,29 @@ func InsertUserAccount(uid int64, accountName string, accUsername string, encryp
 
 	return accountName, nil
 }
+
+func UpdateUserAccount(uid int64, accountName string, accUsername string, encryptedData []byte) (string, error) {
+	// returns the name of the updated account, or 3 possible errors
+	// If the given account name or acc_username is empty, if the account doesnt exist (sql.ErrNoRows), or if the query fails
+
+	if len(accountName) == 0 {
+		return "", Err0LengthUserAccname
+	}
+	if len(accUsername) == 0 {
+		return "", Err0LengthUserAccUsername
+	}
+
+	result, err := db.Exec("UPDATE entries SET acc_username = ?, encrypted_data = ? WHERE user_id = ? AND name = ?", accUsername, encryptedData, uid, accountName)
+	if err != nil {
+		return "", err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	return accountName, nil
+}
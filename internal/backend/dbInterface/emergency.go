@@ -0,0 +1,126 @@
+package dbInterface
+
+import (
+	"database/sql"
+)
+
+// An emergency contact holds the master key of the owner sealed to their public key.
+// The backend only opens it once the contact has requested access and the waiting period has passed
+// without the owner denying the request.
+
+var emergencySchema = []string{
+	`CREATE TABLE IF NOT EXISTS emergency_contacts (
+		owner_id INTEGER NOT NULL,
+		contact_id INTEGER NOT NULL,
+		wrapped_key BLOB NOT NULL,
+		wait_seconds INTEGER NOT NULL,
+		requested_at INTEGER,
+		PRIMARY KEY (owner_id, contact_id),
+		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (contact_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+}
+
+func createEmergencySchema(conn *sql.DB) error {
+	for _, statement := range emergencySchema {
+		if _, err := conn.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type EmergencyContactRecord struct {
+	Owner       string
+	Contact     string
+	WaitSeconds int64
+	// RequestedAt is in milliseconds, invalid while no access is requested
+	RequestedAt sql.NullInt64
+}
+
+type EmergencyAccessRecord struct {
+	WrappedKey  []byte
+	WaitSeconds int64
+	RequestedAt sql.NullInt64
+}
+
+func UpsertEmergencyContact(ownerId int64, contactId int64, wrappedKey []byte, waitSeconds int64) error {
+	//makes the user an emergency contact of the owner, an existing contact gets the new key and waiting period and loses a pending request
+	_, err := db.Exec(`INSERT INTO emergency_contacts (owner_id, contact_id, wrapped_key, wait_seconds) VALUES (?, ?, ?, ?)
+		ON CONFLICT (owner_id, contact_id) DO UPDATE SET wrapped_key = excluded.wrapped_key, wait_seconds = excluded.wait_seconds, requested_at = NULL`,
+		ownerId, contactId, wrappedKey, waitSeconds)
+	return err
+}
+
+func DeleteEmergencyContact(ownerId int64, contactId int64) error {
+	//returns sql.ErrNoRows if the user is not an emergency contact of the owner
+	return execAffectingOne("DELETE FROM emergency_contacts WHERE owner_id = ? AND contact_id = ?", ownerId, contactId)
+}
+
+func SetEmergencyRequest(ownerId int64, contactId int64) error {
+	//starts the waiting period, a request already pending keeps its start
+	//returns sql.ErrNoRows if the user is not an emergency contact of the owner
+	return execAffectingOne("UPDATE emergency_contacts SET requested_at = COALESCE(requested_at, "+SQL_NOW_MS+") WHERE owner_id = ? AND contact_id = ?", ownerId, contactId)
+}
+
+func ClearEmergencyRequest(ownerId int64, contactId int64) error {
+	//returns sql.ErrNoRows if the user is not an emergency contact of the owner
+	return execAffectingOne("UPDATE emergency_contacts SET requested_at = NULL WHERE owner_id = ? AND contact_id = ?", ownerId, contactId)
+}
+
+func execAffectingOne(query string, args ...any) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func FetchEmergencyAccess(ownerId int64, contactId int64) (EmergencyAccessRecord, error) {
+	//returns the sealed key of the owner as held by the contact, or sql.ErrNoRows if they are not a contact of the owner
+	var record EmergencyAccessRecord
+	err := db.QueryRow("SELECT wrapped_key, wait_seconds, requested_at FROM emergency_contacts WHERE owner_id = ? AND contact_id = ?", ownerId, contactId).
+		Scan(&record.WrappedKey, &record.WaitSeconds, &record.RequestedAt)
+	return record, err
+}
+
+func fetchEmergencyContacts(query string, uid int64) ([]EmergencyContactRecord, error) {
+	rows, err := db.Query(query, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := make([]EmergencyContactRecord, 0)
+	for rows.Next() {
+		var contact EmergencyContactRecord
+		if err := rows.Scan(&contact.Owner, &contact.Contact, &contact.WaitSeconds, &contact.RequestedAt); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+func FetchEmergencyContacts(ownerId int64) ([]EmergencyContactRecord, error) {
+	//returns the emergency contacts of the owner sorted by username
+	return fetchEmergencyContacts(`SELECT o.username, c.username, e.wait_seconds, e.requested_at FROM emergency_contacts e
+		JOIN users o ON o.id = e.owner_id
+		JOIN users c ON c.id = e.contact_id
+		WHERE e.owner_id = ? ORDER BY c.username`, ownerId)
+}
+
+func FetchEmergencyOwners(contactId int64) ([]EmergencyContactRecord, error) {
+	//returns every owner who made the user their emergency contact, sorted by username
+	return fetchEmergencyContacts(`SELECT o.username, c.username, e.wait_seconds, e.requested_at FROM emergency_contacts e
+		JOIN users o ON o.id = e.owner_id
+		JOIN users c ON c.id = e.contact_id
+		WHERE e.contact_id = ? ORDER BY o.username`, contactId)
+}
@@ -0,0 +1,177 @@
+package dbInterface
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	Err0LengthFieldName = errors.New("given field name is length 0")
+)
+
+type FieldRecord struct {
+	Name          string
+	FieldType     string
+	EncryptedData []byte
+}
+
+func fetchEntryId(uid int64, accountName string) (int64, error) {
+	//returns the id of the entry with the given name belonging to the user, or sql.ErrNoRows if there is none
+
+	row := db.QueryRow("SELECT id FROM entries WHERE user_id = ? AND name = ?", uid, accountName)
+
+	var entryId int64
+	if err := row.Scan(&entryId); err != nil {
+		return 0, err
+	}
+	return entryId, nil
+}
+
+func UpsertEntryField(uid int64, accountName string, fieldName string, fieldType string, encryptedData []byte) (string, error) {
+	//returns the name of the field that was set, or 3 possible errors
+	//If the given account name or field name is empty, if the account doesnt exist, or if the query fails
+	//an existing field with the same name on the same account is overwritten
+
+	if len(accountName) == 0 {
+		return "", Err0LengthUserAccname
+	}
+	if len(fieldName) == 0 {
+		return "", Err0LengthFieldName
+	}
+
+	entryId, err := fetchEntryId(uid, accountName)
+	if err != nil {
+		return "", err
+	}
+
+	statement, err := db.Prepare(`INSERT INTO entry_fields (entry_id, name, field_type, encrypted_data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (entry_id, name) DO UPDATE SET field_type = excluded.field_type, encrypted_data = excluded.encrypted_data`)
+	if err != nil {
+		return "", err
+	}
+
+	defer statement.Close()
+
+	_, err = statement.Exec(entryId, fieldName, fieldType, encryptedData)
+	if err != nil {
+		return "", err
+	}
+
+	return fieldName, nil
+}
+
+func FetchEntryField(uid int64, accountName string, fieldName string) (FieldRecord, error) {
+	//returns the field record, or 2 possible errors
+	//If the given account name or field name is empty, or if no rows with the given params were found
+
+	if len(accountName) == 0 {
+		return FieldRecord{}, Err0LengthUserAccname
+	}
+	if len(fieldName) == 0 {
+		return FieldRecord{}, Err0LengthFieldName
+	}
+
+	row := db.QueryRow(`SELECT f.name, f.field_type, f.encrypted_data FROM entry_fields f
+		JOIN entries e ON e.id = f.entry_id
+		WHERE e.user_id = ? AND e.name = ? AND f.name = ?`, uid, accountName, fieldName)
+
+	var record FieldRecord
+	err := row.Scan(&record.Name, &record.FieldType, &record.EncryptedData)
+	if err != nil {
+		return FieldRecord{}, err
+	}
+	return record, nil
+}
+
+func FetchEntryFields(uid int64, accountName string) ([]FieldRecord, error) {
+	//returns all custom fields stored on the given account, ordered by name
+
+	if len(accountName) == 0 {
+		return nil, Err0LengthUserAccname
+	}
+
+	rows, err := db.Query(`SELECT f.name, f.field_type, f.encrypted_data FROM entry_fields f
+		JOIN entries e ON e.id = f.entry_id
+		WHERE e.user_id = ? AND e.name = ? ORDER BY f.name`, uid, accountName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	records := make([]FieldRecord, 0)
+	for rows.Next() {
+		var record FieldRecord
+		if err := rows.Scan(&record.Name, &record.FieldType, &record.EncryptedData); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func DeleteEntryField(uid int64, accountName string, fieldName string) (string, error) {
+	//returns the name of the deleted field, or 3 possible errors
+	//If the given account name or field name is empty, if the account doesnt exist, or if the query fails
+
+	if len(accountName) == 0 {
+		return "", Err0LengthUserAccname
+	}
+	if len(fieldName) == 0 {
+		return "", Err0LengthFieldName
+	}
+
+	entryId, err := fetchEntryId(uid, accountName)
+	if err != nil {
+		return "", err
+	}
+
+	statement, err := db.Prepare("DELETE FROM entry_fields WHERE entry_id = ? AND name = ?")
+	if err != nil {
+		return "", err
+	}
+
+	defer statement.Close()
+
+	result, err := statement.Exec(entryId, fieldName)
+	if err != nil {
+		return "", err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	return fieldName, nil
+}
+
+func FetchUserFieldsOfType(uid int64, fieldType string) (map[string][]FieldRecord, error) {
+	//returns every field of the given type across all accounts of the user, keyed by account name
+
+	rows, err := db.Query(`SELECT e.name, f.name, f.field_type, f.encrypted_data FROM entry_fields f
+		JOIN entries e ON e.id = f.entry_id
+		WHERE e.user_id = ? AND f.field_type = ? ORDER BY e.name, f.name`, uid, fieldType)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	records := make(map[string][]FieldRecord)
+	for rows.Next() {
+		var accName string
+		var record FieldRecord
+		if err := rows.Scan(&accName, &record.Name, &record.FieldType, &record.EncryptedData); err != nil {
+			return nil, err
+		}
+		records[accName] = append(records[accName], record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,62 @@
+package dbInterface
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations holds the schema changes that cannot be expressed with CREATE TABLE IF NOT EXISTS,
+// such as new columns on existing tables. migrations[i] upgrades a database from version i to i+1,
+// the current version is kept in PRAGMA user_version.
+var migrations = []string{
+	`ALTER TABLE entries ADD COLUMN folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL`,
+	`ALTER TABLE entry_otp ADD COLUMN counter INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE entries ADD COLUMN uuid TEXT`,
+	//entries that predate sync are identified by their name, so two copies of an old vault agree on their ids
+	//names were never enforced unique, later entries of a duplicated name fall back to their row id
+	`UPDATE entries SET uuid = 'legacy-' || lower(hex(name)) ||
+		CASE WHEN id = (SELECT min(id) FROM entries other WHERE other.user_id = entries.user_id AND other.name = entries.name) THEN '' ELSE '-' || id END
+		WHERE uuid IS NULL`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS entries_user_uuid ON entries (user_id, uuid)`,
+	//0 marks an entry that was not modified since sync was introduced
+	`ALTER TABLE entries ADD COLUMN modified_at INTEGER NOT NULL DEFAULT 0`,
+	//users created before recovery codes have none, their vault key is the key derived from their master password
+	`ALTER TABLE users ADD COLUMN wrapped_vault_key BLOB`,
+	`ALTER TABLE users ADD COLUMN uses_key_file INTEGER NOT NULL DEFAULT 0`,
+}
+
+// SCHEMA_VERSION is the user_version of a database with every migration applied.
+var SCHEMA_VERSION = len(migrations)
+
+func migrate(conn *sql.DB) error {
+	//applies every migration newer than the databases user_version, each in its own transaction
+
+	var version int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > SCHEMA_VERSION {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, SCHEMA_VERSION)
+	}
+
+	for ; version < SCHEMA_VERSION; version++ {
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		//pragmas cannot take bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
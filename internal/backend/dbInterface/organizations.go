@@ -0,0 +1,422 @@
+package dbInterface
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Organizations group users into shared vaults. Entries of an organization live in its collections,
+// each collection has a random key of its own, sealed to the public key of every member.
+// The role of a member decides what they may do, it is checked by the backend.
+
+var (
+	Err0LengthOrganizationName = errors.New("given organization name is length 0")
+	Err0LengthCollectionName   = errors.New("given collection name is length 0")
+)
+
+var organizationSchema = []string{
+	`CREATE TABLE IF NOT EXISTS organizations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS org_members (
+		org_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		role TEXT NOT NULL CHECK (role IN ('read', 'write', 'manage')),
+		PRIMARY KEY (org_id, user_id),
+		FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS collections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		org_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		UNIQUE (org_id, name),
+		FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS collection_keys (
+		collection_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		wrapped_key BLOB NOT NULL,
+		PRIMARY KEY (collection_id, user_id),
+		FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS collection_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		collection_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		encrypted_data BLOB NOT NULL,
+		UNIQUE (collection_id, name),
+		FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
+	)`,
+}
+
+func IsUniqueViolation(err error) bool {
+	//returns true if the error comes from inserting a name that is already taken
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+func createOrganizationSchema(conn *sql.DB) error {
+	for _, statement := range organizationSchema {
+		if _, err := conn.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type OrganizationRecord struct {
+	Name string
+	Role string
+}
+
+type OrgMemberRecord struct {
+	UserId    int64
+	Username  string
+	Role      string
+	PublicKey []byte
+}
+
+type CollectionRecord struct {
+	Id      int64
+	Name    string
+	Entries int
+}
+
+type CollectionKeyRecord struct {
+	CollectionId int64
+	WrappedKey   []byte
+}
+
+type CollectionEntryRecord struct {
+	Name          string
+	EncryptedData []byte
+}
+
+// CollectionRekey holds every entry of a collection and every member key of it under a new collection key
+type CollectionRekey struct {
+	CollectionId int64
+	Entries      []CollectionEntryRecord
+	WrappedKeys  map[int64][]byte
+}
+
+func InsertOrganization(name string, uid int64, role string) (string, error) {
+	//creates the organization with the user as its first member
+	if len(name) == 0 {
+		return "", Err0LengthOrganizationName
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO organizations (name, created_at) VALUES (?, "+SQL_NOW_MS+")", name)
+	if err != nil {
+		return "", err
+	}
+	orgId, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)", orgId, uid, role); err != nil {
+		return "", err
+	}
+	return name, tx.Commit()
+}
+
+func FetchOrganizationId(name string) (int64, error) {
+	//returns the id of the named organization, or sql.ErrNoRows if there is none
+	if len(name) == 0 {
+		return 0, Err0LengthOrganizationName
+	}
+	var orgId int64
+	err := db.QueryRow("SELECT id FROM organizations WHERE name = ?", name).Scan(&orgId)
+	return orgId, err
+}
+
+func FetchMemberRole(orgId int64, uid int64) (string, error) {
+	//returns the role of the user in the organization, or sql.ErrNoRows if they are not a member
+	var role string
+	err := db.QueryRow("SELECT role FROM org_members WHERE org_id = ? AND user_id = ?", orgId, uid).Scan(&role)
+	return role, err
+}
+
+func FetchUserOrganizations(uid int64) ([]OrganizationRecord, error) {
+	//returns the organizations the user belongs to with their role, sorted by name
+	rows, err := db.Query(`SELECT o.name, m.role FROM org_members m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = ? ORDER BY o.name`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	organizations := make([]OrganizationRecord, 0)
+	for rows.Next() {
+		var organization OrganizationRecord
+		if err := rows.Scan(&organization.Name, &organization.Role); err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, organization)
+	}
+	return organizations, rows.Err()
+}
+
+func FetchOrgMembers(orgId int64) ([]OrgMemberRecord, error) {
+	//returns the members of the organization with their public keys, sorted by username
+	rows, err := db.Query(`SELECT m.user_id, u.username, m.role, k.public_key FROM org_members m
+		JOIN users u ON u.id = m.user_id
+		JOIN user_keys k ON k.user_id = m.user_id
+		WHERE m.org_id = ? ORDER BY u.username`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]OrgMemberRecord, 0)
+	for rows.Next() {
+		var member OrgMemberRecord
+		if err := rows.Scan(&member.UserId, &member.Username, &member.Role, &member.PublicKey); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func InsertOrgMember(orgId int64, uid int64, role string, wrappedKeys map[int64][]byte) error {
+	//adds the user to the organization along with their copy of every collection key
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)", orgId, uid, role); err != nil {
+		return err
+	}
+	for collectionId, wrappedKey := range wrappedKeys {
+		if _, err := tx.Exec("INSERT INTO collection_keys (collection_id, user_id, wrapped_key) VALUES (?, ?, ?)", collectionId, uid, wrappedKey); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func UpdateOrgMemberRole(orgId int64, uid int64, role string) error {
+	//returns sql.ErrNoRows if the user is not a member
+	result, err := db.Exec("UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?", role, orgId, uid)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func DeleteOrgMember(orgId int64, uid int64, rekeys []CollectionRekey) error {
+	//removes the user and their collection keys from the organization, sql.ErrNoRows if they were not a member
+	//the collections are rekeyed in the same transaction, none of them stays under a key the user still holds
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM org_members WHERE org_id = ? AND user_id = ?", orgId, uid)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("DELETE FROM collection_keys WHERE user_id = ? AND collection_id IN (SELECT id FROM collections WHERE org_id = ?)", uid, orgId); err != nil {
+		return err
+	}
+	for _, rekey := range rekeys {
+		if err := rekeyCollection(tx, rekey); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func CountOrgManagers(orgId int64) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM org_members WHERE org_id = ? AND role = 'manage'", orgId).Scan(&count)
+	return count, err
+}
+
+func InsertCollection(orgId int64, name string, wrappedKeys map[int64][]byte) (string, error) {
+	//creates the collection with its key wrapped for every given member
+	if len(name) == 0 {
+		return "", Err0LengthCollectionName
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO collections (org_id, name) VALUES (?, ?)", orgId, name)
+	if err != nil {
+		return "", err
+	}
+	collectionId, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	for uid, wrappedKey := range wrappedKeys {
+		if _, err := tx.Exec("INSERT INTO collection_keys (collection_id, user_id, wrapped_key) VALUES (?, ?, ?)", collectionId, uid, wrappedKey); err != nil {
+			return "", err
+		}
+	}
+	return name, tx.Commit()
+}
+
+func FetchCollections(orgId int64) ([]CollectionRecord, error) {
+	//returns the collections of the organization with their entry counts, sorted by name
+	rows, err := db.Query(`SELECT c.id, c.name, COUNT(e.id) FROM collections c
+		LEFT JOIN collection_entries e ON e.collection_id = c.id
+		WHERE c.org_id = ? GROUP BY c.id ORDER BY c.name`, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make([]CollectionRecord, 0)
+	for rows.Next() {
+		var collection CollectionRecord
+		if err := rows.Scan(&collection.Id, &collection.Name, &collection.Entries); err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
+
+func FetchCollectionKey(orgId int64, collectionName string, uid int64) (int64, []byte, error) {
+	//returns the id of the collection and its key wrapped for the user, or sql.ErrNoRows if there is no such collection
+	if len(collectionName) == 0 {
+		return 0, nil, Err0LengthCollectionName
+	}
+	var collectionId int64
+	var wrappedKey []byte
+	err := db.QueryRow(`SELECT c.id, k.wrapped_key FROM collections c
+		JOIN collection_keys k ON k.collection_id = c.id AND k.user_id = ?
+		WHERE c.org_id = ? AND c.name = ?`, uid, orgId, collectionName).Scan(&collectionId, &wrappedKey)
+	return collectionId, wrappedKey, err
+}
+
+func FetchOrgCollectionKeys(orgId int64, uid int64) ([]CollectionKeyRecord, error) {
+	//returns the key of every collection of the organization wrapped for the user
+	rows, err := db.Query(`SELECT k.collection_id, k.wrapped_key FROM collection_keys k
+		JOIN collections c ON c.id = k.collection_id
+		WHERE c.org_id = ? AND k.user_id = ?`, orgId, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]CollectionKeyRecord, 0)
+	for rows.Next() {
+		var key CollectionKeyRecord
+		if err := rows.Scan(&key.CollectionId, &key.WrappedKey); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func MoveEntryToCollection(uid int64, accountName string, collectionId int64, encryptedData []byte) error {
+	//puts the entry into the collection and removes it from the personal vault of the user in one go
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO collection_entries (collection_id, name, encrypted_data) VALUES (?, ?, ?)", collectionId, accountName, encryptedData); err != nil {
+		return err
+	}
+	if err := tombstoneEntry(tx, uid, accountName); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM entries WHERE user_id = ? AND name = ?", uid, accountName); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func FetchCollectionEntries(collectionId int64) ([]CollectionEntryRecord, error) {
+	//returns the entries of the collection sorted by name
+	rows, err := db.Query("SELECT name, encrypted_data FROM collection_entries WHERE collection_id = ? ORDER BY name", collectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]CollectionEntryRecord, 0)
+	for rows.Next() {
+		var entry CollectionEntryRecord
+		if err := rows.Scan(&entry.Name, &entry.EncryptedData); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func FetchCollectionEntry(collectionId int64, name string) ([]byte, error) {
+	//returns the encrypted entry, or sql.ErrNoRows if the collection has no entry by that name
+	var encryptedData []byte
+	err := db.QueryRow("SELECT encrypted_data FROM collection_entries WHERE collection_id = ? AND name = ?", collectionId, name).Scan(&encryptedData)
+	return encryptedData, err
+}
+
+func DeleteCollectionEntry(collectionId int64, name string) (string, error) {
+	//returns sql.ErrNoRows if the collection has no entry by that name
+	result, err := db.Exec("DELETE FROM collection_entries WHERE collection_id = ? AND name = ?", collectionId, name)
+	if err != nil {
+		return "", err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected == 0 {
+		return "", sql.ErrNoRows
+	}
+	return name, nil
+}
+
+func rekeyCollection(tx *sql.Tx, rekey CollectionRekey) error {
+	//replaces every entry and member key of the collection with ones under a new collection key
+	for _, entry := range rekey.Entries {
+		if _, err := tx.Exec("UPDATE collection_entries SET encrypted_data = ? WHERE collection_id = ? AND name = ?", entry.EncryptedData, rekey.CollectionId, entry.Name); err != nil {
+			return err
+		}
+	}
+	for uid, wrappedKey := range rekey.WrappedKeys {
+		if _, err := tx.Exec("UPDATE collection_keys SET wrapped_key = ? WHERE collection_id = ? AND user_id = ?", wrappedKey, rekey.CollectionId, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
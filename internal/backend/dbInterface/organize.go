@@ -0,0 +1,256 @@
+package dbInterface
+
+import (
+	"database/sql"
+	"errors"
+	"passwordManager/internal/userType"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	Err0LengthFolderPath = errors.New("given folder path is length 0")
+	Err0LengthTagName    = errors.New("given tag name is length 0")
+)
+
+// FOLDER_SEPARATOR separates the segments of a folder path, e.g. work/aws.
+const FOLDER_SEPARATOR = "/"
+
+func ensureFolder(tx *sql.Tx, uid int64, folderPath string) (int64, error) {
+	//creates the folder and all of its missing parents, returns the id of the folder itself
+
+	segments := strings.Split(folderPath, FOLDER_SEPARATOR)
+	for i := range segments {
+		_, err := tx.Exec("INSERT OR IGNORE INTO folders (user_id, path) VALUES (?, ?)", uid, strings.Join(segments[:i+1], FOLDER_SEPARATOR))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var folderId int64
+	err := tx.QueryRow("SELECT id FROM folders WHERE user_id = ? AND path = ?", uid, folderPath).Scan(&folderId)
+	if err != nil {
+		return 0, err
+	}
+	return folderId, nil
+}
+
+func InsertFolder(uid int64, folderPath string) (string, error) {
+	//returns the path of the created folder, parents are created as needed and existing folders are left alone
+
+	if len(folderPath) == 0 {
+		return "", Err0LengthFolderPath
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := ensureFolder(tx, uid, folderPath); err != nil {
+		return "", err
+	}
+
+	return folderPath, tx.Commit()
+}
+
+func UpdateEntryFolder(uid int64, accountName string, folderPath string) (string, error) {
+	//moves the account into the folder, creating it if needed. An empty path moves the account out of every folder
+	//returns the name of the moved account, or sql.ErrNoRows if the account doesnt exist
+
+	if len(accountName) == 0 {
+		return "", Err0LengthUserAccname
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var folderId sql.NullInt64
+	if len(folderPath) != 0 {
+		id, err := ensureFolder(tx, uid, folderPath)
+		if err != nil {
+			return "", err
+		}
+		folderId = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	result, err := tx.Exec("UPDATE entries SET folder_id = ? WHERE user_id = ? AND name = ?", folderId, uid, accountName)
+	if err != nil {
+		return "", err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	return accountName, tx.Commit()
+}
+
+func DeleteFolder(uid int64, folderPath string) (string, error) {
+	//deletes the folder and every folder below it, the entries inside are kept but no longer belong to a folder
+	//returns the path of the deleted folder, or sql.ErrNoRows if it doesnt exist
+	//substr counts characters, not bytes, so the prefix length is given in runes
+
+	if len(folderPath) == 0 {
+		return "", Err0LengthFolderPath
+	}
+
+	result, err := db.Exec("DELETE FROM folders WHERE user_id = ? AND (path = ? OR substr(path, 1, ?) = ?)",
+		uid, folderPath, utf8.RuneCountInString(folderPath+FOLDER_SEPARATOR), folderPath+FOLDER_SEPARATOR)
+	if err != nil {
+		return "", err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	return folderPath, nil
+}
+
+func FetchFolders(uid int64) ([]string, error) {
+	//returns the paths of every folder of the user, sorted so parents come before their children
+
+	rows, err := db.Query("SELECT path FROM folders WHERE user_id = ? ORDER BY path", uid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	paths := make([]string, 0)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+func InsertEntryTag(uid int64, accountName string, tagName string) (string, error) {
+	//attaches the tag to the account, creating the tag if needed. Tagging twice is not an error
+	//returns the tag name, or sql.ErrNoRows if the account doesnt exist
+
+	if len(accountName) == 0 {
+		return "", Err0LengthUserAccname
+	}
+	if len(tagName) == 0 {
+		return "", Err0LengthTagName
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var entryId int64
+	err = tx.QueryRow("SELECT id FROM entries WHERE user_id = ? AND name = ?", uid, accountName).Scan(&entryId)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO tags (user_id, name) VALUES (?, ?)", uid, tagName)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO entry_tags (entry_id, tag_id)
+		SELECT ?, id FROM tags WHERE user_id = ? AND name = ?`, entryId, uid, tagName)
+	if err != nil {
+		return "", err
+	}
+
+	return tagName, tx.Commit()
+}
+
+func DeleteEntryTag(uid int64, accountName string, tagName string) (string, error) {
+	//detaches the tag from the account, tags left without any account are dropped
+	//returns the tag name, or sql.ErrNoRows if the account didnt have the tag
+
+	if len(accountName) == 0 {
+		return "", Err0LengthUserAccname
+	}
+	if len(tagName) == 0 {
+		return "", Err0LengthTagName
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM entry_tags
+		WHERE entry_id = (SELECT id FROM entries WHERE user_id = ? AND name = ?)
+		AND tag_id = (SELECT id FROM tags WHERE user_id = ? AND name = ?)`, uid, accountName, uid, tagName)
+	if err != nil {
+		return "", err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	_, err = tx.Exec("DELETE FROM tags WHERE user_id = ? AND id NOT IN (SELECT tag_id FROM entry_tags)", uid)
+	if err != nil {
+		return "", err
+	}
+
+	return tagName, tx.Commit()
+}
+
+func FetchAccountSummaries(uid int64, folderPath string, tagNames []string) ([]userType.AccountSummary, error) {
+	//returns the accounts of the user with their folder and tags, sorted by folder then name
+	//an empty folder path matches every account, otherwise only accounts in the folder or below it are returned
+	//every given tag has to be present on an account for it to be returned
+
+	query := `SELECT e.name, e.acc_username, COALESCE(f.path, ''),
+		(SELECT group_concat(t.name, ',') FROM entry_tags et JOIN tags t ON t.id = et.tag_id WHERE et.entry_id = e.id)
+		FROM entries e LEFT JOIN folders f ON f.id = e.folder_id
+		WHERE e.user_id = ?`
+	params := []any{uid}
+
+	if len(folderPath) != 0 {
+		query += " AND (f.path = ? OR substr(f.path, 1, ?) = ?)"
+		params = append(params, folderPath, utf8.RuneCountInString(folderPath+FOLDER_SEPARATOR), folderPath+FOLDER_SEPARATOR)
+	}
+	for _, tagName := range tagNames {
+		query += " AND EXISTS (SELECT 1 FROM entry_tags et JOIN tags t ON t.id = et.tag_id WHERE et.entry_id = e.id AND t.name = ?)"
+		params = append(params, tagName)
+	}
+	query += " ORDER BY COALESCE(f.path, ''), e.name"
+
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	summaries := make([]userType.AccountSummary, 0)
+	for rows.Next() {
+		var summary userType.AccountSummary
+		var tags sql.NullString
+		if err := rows.Scan(&summary.Name, &summary.Username, &summary.Folder, &tags); err != nil {
+			return nil, err
+		}
+		summary.Tags = make([]string, 0)
+		if tags.Valid {
+			summary.Tags = strings.Split(tags.String, ",")
+		}
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
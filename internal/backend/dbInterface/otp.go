@@ -0,0 +1,128 @@
+package dbInterface
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrOTPCounterMoved = errors.New("the otp counter changed since it was read")
+
+func UpsertEntryOTP(uid int64, accountName string, encryptedData []byte, counter uint64) (string, error) {
+	//returns the name of the account the otp secret was stored on, or 3 possible errors
+	//If the given account name is empty, if the account doesnt exist, or if the query fails
+	//an account holds at most one otp secret, setting a new one replaces the old one and its counter
+	//the counter is only meaningful for counter based secrets, it is kept in plaintext so it can be incremented atomically
+
+	if len(accountName) == 0 {
+		return "", Err0LengthUserAccname
+	}
+
+	entryId, err := fetchEntryId(uid, accountName)
+	if err != nil {
+		return "", err
+	}
+
+	statement, err := db.Prepare(`INSERT INTO entry_otp (entry_id, encrypted_data, counter) VALUES (?, ?, ?)
+		ON CONFLICT (entry_id) DO UPDATE SET encrypted_data = excluded.encrypted_data, counter = excluded.counter`)
+	if err != nil {
+		return "", err
+	}
+
+	defer statement.Close()
+
+	_, err = statement.Exec(entryId, encryptedData, int64(counter))
+	if err != nil {
+		return "", err
+	}
+
+	return accountName, nil
+}
+
+func FetchEntryOTP(uid int64, accountName string) ([]byte, error) {
+	//returns the encrypted otp secret of the account, or sql.ErrNoRows if it has none
+
+	if len(accountName) == 0 {
+		return []byte{}, Err0LengthUserAccname
+	}
+
+	row := db.QueryRow(`SELECT o.encrypted_data FROM entry_otp o
+		JOIN entries e ON e.id = o.entry_id
+		WHERE e.user_id = ? AND e.name = ?`, uid, accountName)
+
+	var encryptedData []byte
+	if err := row.Scan(&encryptedData); err != nil {
+		return []byte{}, err
+	}
+	return encryptedData, nil
+}
+
+func IncrementEntryOTPCounter(uid int64, accountName string) (uint64, error) {
+	//atomically advances the counter of the accounts otp secret
+	//returns the counter value before the increment, which is the one to generate the code with, or sql.ErrNoRows if the account has no otp secret
+
+	if len(accountName) == 0 {
+		return 0, Err0LengthUserAccname
+	}
+
+	row := db.QueryRow(`UPDATE entry_otp SET counter = counter + 1
+		WHERE entry_id = (SELECT id FROM entries WHERE user_id = ? AND name = ?)
+		RETURNING counter - 1`, uid, accountName)
+
+	var counter int64
+	if err := row.Scan(&counter); err != nil {
+		return 0, err
+	}
+	return uint64(counter), nil
+}
+
+func FetchEntryOTPCounter(uid int64, accountName string) (uint64, error) {
+	//returns the counter the next code of the accounts otp secret is generated with, or sql.ErrNoRows if the account has no otp secret
+
+	if len(accountName) == 0 {
+		return 0, Err0LengthUserAccname
+	}
+
+	var counter int64
+	err := db.QueryRow(`SELECT o.counter FROM entry_otp o
+		JOIN entries e ON e.id = o.entry_id
+		WHERE e.user_id = ? AND e.name = ?`, uid, accountName).Scan(&counter)
+	return uint64(counter), err
+}
+
+func AdvanceEntryOTPCounter(uid int64, accountName string, counter uint64) error {
+	//moves the counter past the given value, if it still is that value
+	//returns ErrOTPCounterMoved if another code was handed out since the counter was read
+
+	if len(accountName) == 0 {
+		return Err0LengthUserAccname
+	}
+
+	result, err := db.Exec(`UPDATE entry_otp SET counter = counter + 1
+		WHERE entry_id = (SELECT id FROM entries WHERE user_id = ? AND name = ?) AND counter = ?`, uid, accountName, int64(counter))
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrOTPCounterMoved
+	}
+	return nil
+}
+
+func DeleteEntryOTP(uid int64, accountName string) (string, error) {
+	//returns the name of the account the otp secret was removed from, or sql.ErrNoRows if it had none
+
+	if len(accountName) == 0 {
+		return "", Err0LengthUserAccname
+	}
+
+	result, err := db.Exec(`DELETE FROM entry_otp
+		WHERE entry_id = (SELECT id FROM entries WHERE user_id = ? AND name = ?)`, uid, accountName)
+	if err != nil {
+		return "", err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	return accountName, nil
+}
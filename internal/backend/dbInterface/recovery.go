@@ -0,0 +1,86 @@
+package dbInterface
+
+import (
+	"database/sql"
+)
+
+// A recovery code wraps the vault key of its user independently of the master password,
+// so a forgotten master password can be replaced without losing the vault.
+
+var recoverySchema = []string{
+	`CREATE TABLE IF NOT EXISTS user_recovery (
+		user_id INTEGER PRIMARY KEY,
+		salt BLOB NOT NULL,
+		wrapped_vault_key BLOB NOT NULL,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+}
+
+func createRecoverySchema(conn *sql.DB) error {
+	for _, statement := range recoverySchema {
+		if _, err := conn.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertRecovery(tx *sql.Tx, uid int64, salt []byte, wrappedVaultKey []byte) error {
+	_, err := tx.Exec(`INSERT INTO user_recovery (user_id, salt, wrapped_vault_key, created_at) VALUES (?, ?, ?, `+SQL_NOW_MS+`)
+		ON CONFLICT (user_id) DO UPDATE SET salt = excluded.salt, wrapped_vault_key = excluded.wrapped_vault_key, created_at = excluded.created_at`,
+		uid, salt, wrappedVaultKey)
+	return err
+}
+
+func UpsertRecovery(uid int64, salt []byte, wrappedVaultKey []byte) error {
+	//stores the recovery code of the user, replacing the previous one
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := upsertRecovery(tx, uid, salt, wrappedVaultKey); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func FetchRecovery(uid int64) ([]byte, []byte, error) {
+	//returns the salt and the wrapped vault key of the recovery code of the user, or sql.ErrNoRows if they have none
+	var salt, wrappedVaultKey []byte
+	err := db.QueryRow("SELECT salt, wrapped_vault_key FROM user_recovery WHERE user_id = ?", uid).Scan(&salt, &wrappedVaultKey)
+	return salt, wrappedVaultKey, err
+}
+
+func RecoverUser(uid int64, salt []byte, masterKeyHash []byte, wrappedVaultKey []byte, recoverySalt []byte, recoveryWrappedKey []byte) error {
+	//sets the new master password of the user and replaces the used recovery code in one go
+	//the key file requirement is dropped, as the key file may be lost along with the password
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET salt = ?, key_hash = ?, wrapped_vault_key = ?, uses_key_file = 0 WHERE id = ?", salt, masterKeyHash, wrappedVaultKey, uid)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	if err := upsertRecovery(tx, uid, recoverySalt, recoveryWrappedKey); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func UpdateUserCredentials(uid int64, salt []byte, masterKeyHash []byte, wrappedVaultKey []byte, usesKeyFile bool) error {
+	//replaces what unlocks the vault key of the user, the vault key itself stays the same
+	return execAffectingOne("UPDATE users SET salt = ?, key_hash = ?, wrapped_vault_key = ?, uses_key_file = ? WHERE id = ?", salt, masterKeyHash, wrappedVaultKey, usesKeyFile, uid)
+}
@@ -0,0 +1,250 @@
+package dbInterface
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Sharing gives every user an X25519 key pair, the private key encrypted with their master key.
+// A shared entry gets a key of its own: the owner keeps it encrypted with their master key,
+// every recipient gets it sealed to their public key, and a copy of the entry is kept encrypted with it.
+
+var ErrNoUserKeys = errors.New("user has no key pair yet")
+
+var sharingSchema = []string{
+	`CREATE TABLE IF NOT EXISTS user_keys (
+		user_id INTEGER PRIMARY KEY,
+		public_key BLOB NOT NULL,
+		encrypted_private_key BLOB NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS entry_shares (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entry_id INTEGER NOT NULL UNIQUE,
+		owner_key BLOB NOT NULL,
+		encrypted_data BLOB NOT NULL,
+		FOREIGN KEY (entry_id) REFERENCES entries(id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS share_recipients (
+		share_id INTEGER NOT NULL,
+		recipient_id INTEGER NOT NULL,
+		wrapped_key BLOB NOT NULL,
+		shared_at INTEGER NOT NULL,
+		PRIMARY KEY (share_id, recipient_id),
+		FOREIGN KEY (share_id) REFERENCES entry_shares(id) ON DELETE CASCADE,
+		FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+}
+
+func createSharingSchema(conn *sql.DB) error {
+	for _, statement := range sharingSchema {
+		if _, err := conn.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type EntryShareRecord struct {
+	Id            int64
+	OwnerKey      []byte
+	EncryptedData []byte
+}
+
+type ShareRecipientRecord struct {
+	RecipientId int64
+	Username    string
+	PublicKey   []byte
+	SharedAt    int64
+}
+
+type IncomingShareRecord struct {
+	Owner         string
+	Name          string
+	WrappedKey    []byte
+	EncryptedData []byte
+	SharedAt      int64
+}
+
+type OutgoingShareRecord struct {
+	Name      string
+	Recipient string
+	SharedAt  int64
+}
+
+func InsertUserKeys(uid int64, publicKey []byte, encryptedPrivateKey []byte) error {
+	//stores the key pair of the user, a user that already has one keeps it
+	_, err := db.Exec("INSERT OR IGNORE INTO user_keys (user_id, public_key, encrypted_private_key) VALUES (?, ?, ?)", uid, publicKey, encryptedPrivateKey)
+	return err
+}
+
+func FetchUserKeys(uid int64) ([]byte, []byte, error) {
+	//returns the public key and the encrypted private key of the user, or ErrNoUserKeys
+	var publicKey, encryptedPrivateKey []byte
+	err := db.QueryRow("SELECT public_key, encrypted_private_key FROM user_keys WHERE user_id = ?", uid).Scan(&publicKey, &encryptedPrivateKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrNoUserKeys
+	}
+	return publicKey, encryptedPrivateKey, err
+}
+
+func FetchPublicKey(username string) (int64, []byte, error) {
+	//returns the id and public key of the named user, sql.ErrNoRows if there is no such user, ErrNoUserKeys if they have no key pair
+	if len(username) == 0 {
+		return 0, nil, Err0LengthUsername
+	}
+	var uid int64
+	var publicKey []byte
+	err := db.QueryRow("SELECT u.id, k.public_key FROM users u LEFT JOIN user_keys k ON k.user_id = u.id WHERE u.username = ?", username).Scan(&uid, &publicKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	if publicKey == nil {
+		return 0, nil, ErrNoUserKeys
+	}
+	return uid, publicKey, nil
+}
+
+func FetchEntryShare(uid int64, accountName string) (EntryShareRecord, error) {
+	//returns the share of the named entry of the user, or sql.ErrNoRows if it is not shared
+	var record EntryShareRecord
+	err := db.QueryRow(`SELECT s.id, s.owner_key, s.encrypted_data FROM entry_shares s
+		JOIN entries e ON e.id = s.entry_id
+		WHERE e.user_id = ? AND e.name = ?`, uid, accountName).Scan(&record.Id, &record.OwnerKey, &record.EncryptedData)
+	return record, err
+}
+
+func InsertEntryShare(uid int64, accountName string, ownerKey []byte, encryptedData []byte) (int64, error) {
+	//creates the share of the named entry, returns its id
+	entryId, err := fetchEntryId(uid, accountName)
+	if err != nil {
+		return 0, err
+	}
+	result, err := db.Exec("INSERT INTO entry_shares (entry_id, owner_key, encrypted_data) VALUES (?, ?, ?)", entryId, ownerKey, encryptedData)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func UpdateEntryShareData(shareId int64, encryptedData []byte) error {
+	_, err := db.Exec("UPDATE entry_shares SET encrypted_data = ? WHERE id = ?", encryptedData, shareId)
+	return err
+}
+
+func UpsertShareRecipient(shareId int64, recipientId int64, wrappedKey []byte) error {
+	_, err := db.Exec(`INSERT INTO share_recipients (share_id, recipient_id, wrapped_key, shared_at) VALUES (?, ?, ?, `+SQL_NOW_MS+`)
+		ON CONFLICT (share_id, recipient_id) DO UPDATE SET wrapped_key = excluded.wrapped_key`, shareId, recipientId, wrappedKey)
+	return err
+}
+
+func FetchShareRecipients(shareId int64) ([]ShareRecipientRecord, error) {
+	//returns the recipients of the share with their public keys, sorted by username
+	rows, err := db.Query(`SELECT r.recipient_id, u.username, k.public_key, r.shared_at FROM share_recipients r
+		JOIN users u ON u.id = r.recipient_id
+		JOIN user_keys k ON k.user_id = r.recipient_id
+		WHERE r.share_id = ? ORDER BY u.username`, shareId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := make([]ShareRecipientRecord, 0)
+	for rows.Next() {
+		var recipient ShareRecipientRecord
+		if err := rows.Scan(&recipient.RecipientId, &recipient.Username, &recipient.PublicKey, &recipient.SharedAt); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, rows.Err()
+}
+
+func DeleteShareRecipient(shareId int64, recipientId int64) (bool, error) {
+	//removes the recipient from the share, the share itself goes once nobody is left on it
+	//returns false if the recipient was not on the share
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM share_recipients WHERE share_id = ? AND recipient_id = ?", shareId, recipientId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec("DELETE FROM entry_shares WHERE id = ? AND NOT EXISTS (SELECT 1 FROM share_recipients WHERE share_id = ?)", shareId, shareId)
+	if err != nil {
+		return false, err
+	}
+	return affected != 0, tx.Commit()
+}
+
+func RekeyEntryShare(shareId int64, ownerKey []byte, encryptedData []byte, wrappedKeys map[int64][]byte) error {
+	//replaces the key of the share, with the entry copy encrypted and the key wrapped for every recipient under the new key
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE entry_shares SET owner_key = ?, encrypted_data = ? WHERE id = ?", ownerKey, encryptedData, shareId); err != nil {
+		return err
+	}
+	for recipientId, wrappedKey := range wrappedKeys {
+		if _, err := tx.Exec("UPDATE share_recipients SET wrapped_key = ? WHERE share_id = ? AND recipient_id = ?", wrappedKey, shareId, recipientId); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func FetchIncomingShares(recipientId int64) ([]IncomingShareRecord, error) {
+	//returns every entry shared with the user, sorted by owner then entry name
+	rows, err := db.Query(`SELECT u.username, e.name, r.wrapped_key, s.encrypted_data, r.shared_at FROM share_recipients r
+		JOIN entry_shares s ON s.id = r.share_id
+		JOIN entries e ON e.id = s.entry_id
+		JOIN users u ON u.id = e.user_id
+		WHERE r.recipient_id = ? ORDER BY u.username, e.name`, recipientId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make([]IncomingShareRecord, 0)
+	for rows.Next() {
+		var share IncomingShareRecord
+		if err := rows.Scan(&share.Owner, &share.Name, &share.WrappedKey, &share.EncryptedData, &share.SharedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func FetchOutgoingShares(ownerId int64) ([]OutgoingShareRecord, error) {
+	//returns every entry of the user shared with others and who with, sorted by entry name then recipient
+	rows, err := db.Query(`SELECT e.name, u.username, r.shared_at FROM share_recipients r
+		JOIN entry_shares s ON s.id = r.share_id
+		JOIN entries e ON e.id = s.entry_id
+		JOIN users u ON u.id = r.recipient_id
+		WHERE e.user_id = ? ORDER BY e.name, u.username`, ownerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make([]OutgoingShareRecord, 0)
+	for rows.Next() {
+		var share OutgoingShareRecord
+		if err := rows.Scan(&share.Name, &share.Recipient, &share.SharedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
@@ -0,0 +1,265 @@
+package dbInterface
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"passwordManager/internal/userType"
+)
+
+// Sync identifies entries by a uuid and orders changes by modified_at, in milliseconds since the epoch.
+// The triggers below keep modified_at current for every change made through this package,
+// writes that set modified_at themselves, like the ones made by a sync, are left alone.
+
+// SQL_NOW_MS is the current time in milliseconds, the unit of modified_at and of every sync timestamp.
+const SQL_NOW_MS = "CAST(unixepoch('subsec') * 1000 AS INTEGER)"
+
+var syncSchema = []string{
+	`CREATE TABLE IF NOT EXISTS vault_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS entry_tombstones (
+		user_id INTEGER NOT NULL,
+		uuid TEXT NOT NULL,
+		deleted_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, uuid),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS entry_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		uuid TEXT NOT NULL,
+		name TEXT NOT NULL,
+		modified_at INTEGER NOT NULL,
+		recorded_at INTEGER NOT NULL,
+		encrypted_data BLOB NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS sync_state (
+		user_id INTEGER NOT NULL,
+		peer_id TEXT NOT NULL,
+		synced_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, peer_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS entries_sync_insert AFTER INSERT ON entries WHEN NEW.uuid IS NULL
+	BEGIN
+		UPDATE entries SET uuid = lower(hex(randomblob(16))), modified_at = ` + SQL_NOW_MS + ` WHERE id = NEW.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS entries_sync_update AFTER UPDATE OF name, acc_username, encrypted_data, folder_id ON entries
+	WHEN NEW.modified_at = OLD.modified_at
+	BEGIN
+		UPDATE entries SET modified_at = ` + SQL_NOW_MS + ` WHERE id = NEW.id;
+	END`,
+}
+
+func init() {
+	//fields, tags and otp secrets are part of the entry, changing them changes the entry
+	for _, table := range []string{"entry_fields", "entry_tags", "entry_otp"} {
+		for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+			row := "NEW"
+			if event == "DELETE" {
+				row = "OLD"
+			}
+			syncSchema = append(syncSchema, `CREATE TRIGGER IF NOT EXISTS `+table+`_sync_`+event+` AFTER `+event+` ON `+table+`
+			BEGIN
+				UPDATE entries SET modified_at = `+SQL_NOW_MS+` WHERE id = `+row+`.entry_id;
+			END`)
+		}
+	}
+}
+
+func createSyncSchema(conn *sql.DB) error {
+	for _, statement := range syncSchema {
+		if _, err := conn.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	//every vault file gets an id of its own, a byte copy shares it with its original
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	_, err := conn.Exec("INSERT OR IGNORE INTO vault_meta (key, value) VALUES ('vault_id', ?)", hex.EncodeToString(id))
+	return err
+}
+
+func tombstoneEntry(tx *sql.Tx, uid int64, accountName string) error {
+	//records the deletion of the named entry, so a sync removes it from other vaults instead of bringing it back
+	_, err := tx.Exec(`INSERT OR REPLACE INTO entry_tombstones (user_id, uuid, deleted_at)
+		SELECT user_id, uuid, `+SQL_NOW_MS+` FROM entries WHERE user_id = ? AND name = ?`, uid, accountName)
+	return err
+}
+
+// Vault is a handle on a vault database, either the live one or another vault file being synced with.
+type Vault struct {
+	conn *sql.DB
+	// owned is set for vaults opened by OpenVault, which have to be closed by the caller
+	owned bool
+}
+
+// HistoryRecord is an earlier version of an entry, encrypted as a whole.
+type HistoryRecord struct {
+	UUID          string
+	Name          string
+	ModifiedAt    int64
+	RecordedAt    int64
+	EncryptedData []byte
+}
+
+// SyncChanges is everything a sync writes into one vault, applied in a single transaction.
+type SyncChanges struct {
+	// Upserts replace the entry with the same uuid, or add it
+	Upserts []EntryRecord
+	Deletes []string
+	// Tombstones maps uuids to their deletion time, existing tombstones keep the later time
+	Tombstones map[string]int64
+	History    []HistoryRecord
+	PeerId     string
+	SyncedAt   int64
+}
+
+var ErrSameVault = errors.New("cannot sync a vault with itself")
+
+func LocalVault() Vault {
+	return Vault{conn: db}
+}
+
+func OpenVault(path string) (Vault, error) {
+	//opens another vault file, upgrading its schema to the current version
+	conn, err := openVaultDb(path)
+	if err != nil {
+		return Vault{}, err
+	}
+	return Vault{conn: conn, owned: true}, nil
+}
+
+func (vault Vault) Close() error {
+	if !vault.owned {
+		return nil
+	}
+	return vault.conn.Close()
+}
+
+func (vault Vault) VaultId() (string, error) {
+	var id string
+	err := vault.conn.QueryRow("SELECT value FROM vault_meta WHERE key = 'vault_id'").Scan(&id)
+	return id, err
+}
+
+func (vault Vault) FetchUser(username string) (userType.User, error) {
+	//returns the user of this vault, or sql.ErrNoRows if the vault has no user of that name
+	row := vault.conn.QueryRow("SELECT id, username, salt, key_hash, wrapped_vault_key, uses_key_file FROM users WHERE username = ?", username)
+
+	var user userType.User
+	err := row.Scan(&user.Uid, &user.Name, &user.Salt, &user.MasterKeyHash, &user.WrappedVaultKey, &user.UsesKeyFile)
+	return user, err
+}
+
+func (vault Vault) FetchEntryRecords(uid int64) ([]EntryRecord, error) {
+	return fetchUserEntryRecords(vault.conn, uid)
+}
+
+func (vault Vault) FetchTombstones(uid int64) (map[string]int64, error) {
+	//returns the deletion time of every deleted entry of the user, by uuid
+	rows, err := vault.conn.Query("SELECT uuid, deleted_at FROM entry_tombstones WHERE user_id = ?", uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tombstones := make(map[string]int64)
+	for rows.Next() {
+		var uuid string
+		var deletedAt int64
+		if err := rows.Scan(&uuid, &deletedAt); err != nil {
+			return nil, err
+		}
+		tombstones[uuid] = deletedAt
+	}
+	return tombstones, rows.Err()
+}
+
+func (vault Vault) FetchLastSync(uid int64, peerId string) (int64, error) {
+	//returns when the user last synced with the peer vault, or 0 if never
+	var syncedAt int64
+	err := vault.conn.QueryRow("SELECT synced_at FROM sync_state WHERE user_id = ? AND peer_id = ?", uid, peerId).Scan(&syncedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return syncedAt, err
+}
+
+func (vault Vault) ApplySync(uid int64, changes SyncChanges) error {
+	//writes the result of a sync into the vault, nothing is written if any change fails
+	tx, err := vault.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, uuid := range changes.Deletes {
+		if _, err := tx.Exec("DELETE FROM entries WHERE user_id = ? AND uuid = ?", uid, uuid); err != nil {
+			return err
+		}
+	}
+	for _, record := range changes.Upserts {
+		if err := upsertEntryRecord(tx, uid, record); err != nil {
+			return err
+		}
+	}
+
+	for uuid, deletedAt := range changes.Tombstones {
+		_, err := tx.Exec(`INSERT INTO entry_tombstones (user_id, uuid, deleted_at) VALUES (?, ?, ?)
+			ON CONFLICT (user_id, uuid) DO UPDATE SET deleted_at = max(deleted_at, excluded.deleted_at)`, uid, uuid, deletedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, record := range changes.History {
+		_, err := tx.Exec(`INSERT INTO entry_history (user_id, uuid, name, modified_at, recorded_at, encrypted_data) VALUES (?, ?, ?, ?, ?, ?)`,
+			uid, record.UUID, record.Name, record.ModifiedAt, record.RecordedAt, record.EncryptedData)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO sync_state (user_id, peer_id, synced_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, peer_id) DO UPDATE SET synced_at = excluded.synced_at`, uid, changes.PeerId, changes.SyncedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func FetchEntryHistory(uid int64, accountName string) ([]HistoryRecord, error) {
+	//returns the earlier versions of the named entry, newest first
+	//versions are found by the uuid of the entry, so they survive renames
+	if len(accountName) == 0 {
+		return nil, Err0LengthUserAccname
+	}
+
+	rows, err := db.Query(`SELECT h.uuid, h.name, h.modified_at, h.recorded_at, h.encrypted_data FROM entry_history h
+		JOIN entries e ON e.user_id = h.user_id AND e.uuid = h.uuid
+		WHERE e.user_id = ? AND e.name = ?
+		ORDER BY h.recorded_at DESC, h.id DESC`, uid, accountName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]HistoryRecord, 0)
+	for rows.Next() {
+		var record HistoryRecord
+		if err := rows.Scan(&record.UUID, &record.Name, &record.ModifiedAt, &record.RecordedAt, &record.EncryptedData); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,247 @@
+package backend
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"time"
+)
+
+// Emergency access lets an owner name contacts who can read their vault if they can no longer do it themselves.
+// The master key of the owner is sealed to the contact in advance. A contact asks for access, and it is granted
+// once the waiting period has passed without the owner denying the request. The contact can only read.
+
+const (
+	MIN_EMERGENCY_WAIT = 24 * time.Hour
+	MAX_EMERGENCY_WAIT = 90 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidEmergencyWait   = fmt.Errorf("waiting period must be between %d and %d days", MIN_EMERGENCY_WAIT/(24*time.Hour), MAX_EMERGENCY_WAIT/(24*time.Hour))
+	ErrEmergencyContactSelf   = errors.New("you cannot be your own emergency contact")
+	ErrNotEmergencyContact    = errors.New("you are not an emergency contact of this user")
+	ErrEmergencyContactAbsent = errors.New("given user is not one of your emergency contacts")
+	ErrEmergencyNotRequested  = errors.New("emergency access has not been requested, use requestaccess first")
+)
+
+// EmergencyWaitingError is returned to a contact whose access request is still in its waiting period.
+type EmergencyWaitingError struct {
+	AvailableAt time.Time
+}
+
+func (e EmergencyWaitingError) Error() string {
+	return "emergency access is granted on " + e.AvailableAt.Local().Format(time.DateTime) + " unless the owner denies it"
+}
+
+func emergencyContactFromRecord(record dbInterface.EmergencyContactRecord) userType.EmergencyContact {
+	contact := userType.EmergencyContact{
+		Owner:   record.Owner,
+		Contact: record.Contact,
+		Wait:    time.Duration(record.WaitSeconds) * time.Second,
+	}
+	if record.RequestedAt.Valid {
+		contact.RequestedAt = time.UnixMilli(record.RequestedAt.Int64)
+		contact.AvailableAt = contact.RequestedAt.Add(contact.Wait)
+	}
+	return contact
+}
+
+func emergencyUserId(username string, absent error) (int64, error) {
+	user, err := dbInterface.FetchUser(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, dbInterface.Err0LengthUsername) {
+			return 0, absent
+		}
+		logger.Error("db error:", "error", err)
+		return 0, fmt.Errorf("internal error, try again later")
+	}
+	return user.Uid, nil
+}
+
+func AddEmergencyContact(user userType.User, contact string, wait time.Duration, masterKey []byte) (string, error) {
+	//makes the user an emergency contact, adding an existing contact again updates the waiting period and drops a pending request
+	//returns the fingerprint of the public key of the contact, or a possible error
+	if wait < MIN_EMERGENCY_WAIT || wait > MAX_EMERGENCY_WAIT {
+		return "", ErrInvalidEmergencyWait
+	}
+	if contact == user.Name {
+		return "", ErrEmergencyContactSelf
+	}
+	contactId, contactKey, err := dbInterface.FetchPublicKey(contact)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthUsername):
+			return "", err
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecipientNotFound
+		case errors.Is(err, dbInterface.ErrNoUserKeys):
+			return "", ErrRecipientHasNoKeys
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	wrappedKey, err := crypto.SealToPublicKey(masterKey, contactKey)
+	if err != nil {
+		logger.Error("sealing master key failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	if err := dbInterface.UpsertEmergencyContact(user.Uid, contactId, wrappedKey, int64(wait/time.Second)); err != nil {
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Emergency contact added", "username", user.Name, "contact", contact, "wait", wait)
+	return crypto.KeyFingerprint(contactKey), nil
+}
+
+func RemoveEmergencyContact(user userType.User, contact string) error {
+	contactId, err := emergencyUserId(contact, ErrEmergencyContactAbsent)
+	if err != nil {
+		return err
+	}
+	if err := dbInterface.DeleteEmergencyContact(user.Uid, contactId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEmergencyContactAbsent
+		}
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Emergency contact removed", "username", user.Name, "contact", contact)
+	return nil
+}
+
+func GetEmergencyContacts(user userType.User) ([]userType.EmergencyContact, []userType.EmergencyContact, error) {
+	//returns the emergency contacts of the user, and the owners who made the user their contact
+	contactRecords, err := dbInterface.FetchEmergencyContacts(user.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, nil, fmt.Errorf("internal error, try again later")
+	}
+	ownerRecords, err := dbInterface.FetchEmergencyOwners(user.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, nil, fmt.Errorf("internal error, try again later")
+	}
+
+	contacts := make([]userType.EmergencyContact, 0, len(contactRecords))
+	for _, record := range contactRecords {
+		contacts = append(contacts, emergencyContactFromRecord(record))
+	}
+	owners := make([]userType.EmergencyContact, 0, len(ownerRecords))
+	for _, record := range ownerRecords {
+		owners = append(owners, emergencyContactFromRecord(record))
+	}
+	return contacts, owners, nil
+}
+
+func RequestEmergencyAccess(user userType.User, owner string) (time.Time, error) {
+	//starts the waiting period, returns when access is granted unless the owner denies it
+	ownerId, err := emergencyUserId(owner, ErrNotEmergencyContact)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := dbInterface.SetEmergencyRequest(ownerId, user.Uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrNotEmergencyContact
+		}
+		logger.Error("db error:", "error", err)
+		return time.Time{}, fmt.Errorf("internal error, try again later")
+	}
+	access, err := dbInterface.FetchEmergencyAccess(ownerId, user.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return time.Time{}, fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Emergency access requested", "username", user.Name, "owner", owner)
+	return time.UnixMilli(access.RequestedAt.Int64).Add(time.Duration(access.WaitSeconds) * time.Second), nil
+}
+
+func DenyEmergencyAccess(user userType.User, contact string) error {
+	//cancels the pending request of the contact, or takes back access already granted, the contact stays a contact
+	contactId, err := emergencyUserId(contact, ErrEmergencyContactAbsent)
+	if err != nil {
+		return err
+	}
+	if err := dbInterface.ClearEmergencyRequest(user.Uid, contactId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEmergencyContactAbsent
+		}
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Emergency access denied", "username", user.Name, "contact", contact)
+	return nil
+}
+
+func emergencyOwnerKey(user userType.User, owner string, masterKey []byte) (userType.User, []byte, error) {
+	//returns the owner and their master key once the waiting period of the request of the user has passed
+	ownerUser, err := dbInterface.FetchUser(owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, dbInterface.Err0LengthUsername) {
+			return userType.User{}, nil, ErrNotEmergencyContact
+		}
+		logger.Error("db error:", "error", err)
+		return userType.User{}, nil, fmt.Errorf("internal error, try again later")
+	}
+	access, err := dbInterface.FetchEmergencyAccess(ownerUser.Uid, user.Uid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return userType.User{}, nil, ErrNotEmergencyContact
+		}
+		logger.Error("db error:", "error", err)
+		return userType.User{}, nil, fmt.Errorf("internal error, try again later")
+	}
+	if !access.RequestedAt.Valid {
+		return userType.User{}, nil, ErrEmergencyNotRequested
+	}
+	availableAt := time.UnixMilli(access.RequestedAt.Int64).Add(time.Duration(access.WaitSeconds) * time.Second)
+	if time.Now().Before(availableAt) {
+		return userType.User{}, nil, EmergencyWaitingError{AvailableAt: availableAt}
+	}
+
+	privateKey, err := userPrivateKey(user, masterKey)
+	if err != nil {
+		logger.Error("user private key decryption failed:", "error", err)
+		return userType.User{}, nil, fmt.Errorf("internal error, try again later")
+	}
+	defer clear(privateKey)
+	ownerKey, err := crypto.OpenSealed(access.WrappedKey, privateKey)
+	if err != nil {
+		logger.Error("emergency key unwrapping failed:", "error", err)
+		return userType.User{}, nil, fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Emergency access used", "username", user.Name, "owner", owner)
+	return ownerUser, ownerKey, nil
+}
+
+func GetEmergencyAccountNames(user userType.User, owner string, masterKey []byte) ([]string, error) {
+	ownerUser, ownerKey, err := emergencyOwnerKey(user, owner, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	clear(ownerKey)
+	return GetUserAccountNames(ownerUser)
+}
+
+func GetEmergencyAccount(user userType.User, owner string, accountName string, masterKey []byte) (userType.CollectionEntry, error) {
+	//returns an entry of the owner, read only
+	ownerUser, ownerKey, err := emergencyOwnerKey(user, owner, masterKey)
+	if err != nil {
+		return userType.CollectionEntry{}, err
+	}
+	defer clear(ownerKey)
+
+	username, password, err := GetUserAccount(ownerUser, accountName, ownerKey)
+	if err != nil {
+		return userType.CollectionEntry{}, err
+	}
+	fields, err := GetEntryFields(ownerUser, accountName, ownerKey)
+	if err != nil {
+		return userType.CollectionEntry{}, err
+	}
+	return userType.CollectionEntry{Name: accountName, Username: username, Password: password, Fields: fields}, nil
+}
@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"fmt"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+)
+
+func decryptEntryRecord(record dbInterface.EntryRecord, masterKey []byte) (userType.VaultEntry, error) {
+	//turns a stored entry back into its plaintext form, the url and notes fields are lifted out of the custom fields
+	password, err := crypto.DecryptPassword(record.EncryptedData, masterKey)
+	if err != nil {
+		return userType.VaultEntry{}, err
+	}
+
+	entry := userType.VaultEntry{
+		Name:     record.Name,
+		Username: record.Username,
+		Password: string(password),
+		Folder:   record.Folder,
+		Tags:     record.Tags,
+		Fields:   make([]userType.EntryField, 0, len(record.Fields)),
+	}
+
+	for _, fieldRecord := range record.Fields {
+		field, err := decryptFieldRecord(fieldRecord, masterKey)
+		if err != nil {
+			return userType.VaultEntry{}, err
+		}
+		switch {
+		case field.Name == URL_FIELD_NAME && len(entry.URL) == 0:
+			entry.URL = field.Value
+		case field.Name == NOTES_FIELD_NAME && len(entry.Notes) == 0:
+			entry.Notes = field.Value
+		default:
+			entry.Fields = append(entry.Fields, field)
+		}
+	}
+
+	otp, err := decryptOTPRecord(record, masterKey)
+	if err != nil {
+		return userType.VaultEntry{}, err
+	}
+	entry.TOTP = otp
+	return entry, nil
+}
+
+func decryptOTPRecord(record dbInterface.EntryRecord, masterKey []byte) (string, error) {
+	//returns the otp uri of the entry, empty if it has no otp secret
+	if len(record.EncryptedOTP) == 0 {
+		return "", nil
+	}
+	uri, err := crypto.DecryptPassword(record.EncryptedOTP, masterKey)
+	if err != nil {
+		return "", err
+	}
+	config, err := ParseOTPSecret(string(uri))
+	if err != nil {
+		return "", err
+	}
+	//the uri has to carry the current counter, not the one the secret was stored with
+	config.Counter = record.OTPCounter
+	return otpConfigToURI(config), nil
+}
+
+func ExportUserAccounts(user userType.User, masterKey []byte) ([]userType.VaultEntry, error) {
+	//returns every entry of the user decrypted, with all of its metadata, or a possible error
+	records, err := dbInterface.FetchUserEntryRecords(user.Uid)
+	if err != nil {
+		logger.Error("error in retrieving user entries:", "error", err)
+		return nil, fmt.Errorf("internal error in retrieving user accounts")
+	}
+
+	entries := make([]userType.VaultEntry, 0, len(records))
+	for _, record := range records {
+		entry, err := decryptEntryRecord(record, masterKey)
+		if err != nil {
+			logger.Error("user entry decryption failed:", "error", err)
+			return nil, fmt.Errorf("internal error when decrypting user accounts")
+		}
+		entries = append(entries, entry)
+	}
+
+	logger.Info("Exported user accounts", "username", user.Name, "count", len(entries))
+	return entries, nil
+}
@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+)
+
+var (
+	ErrInvalidFieldType  = errors.New("field type must be one of: text, hidden, url, email")
+	ErrInvalidFieldValue = errors.New("field value does not match its type")
+)
+
+func parseFieldType(fieldType string) (userType.FieldType, error) {
+	switch userType.FieldType(fieldType) {
+	case userType.FieldText, userType.FieldHidden, userType.FieldURL, userType.FieldEmail:
+		return userType.FieldType(fieldType), nil
+	default:
+		return "", ErrInvalidFieldType
+	}
+}
+
+func validateFieldValue(fieldType userType.FieldType, value string) error {
+	//url and email fields are checked for shape, text and hidden fields accept anything non-empty
+	switch fieldType {
+	case userType.FieldURL:
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return ErrInvalidFieldValue
+		}
+	case userType.FieldEmail:
+		if _, err := mail.ParseAddress(value); err != nil {
+			return ErrInvalidFieldValue
+		}
+	}
+	return nil
+}
+
+func SetEntryField(user userType.User, accountName string, fieldName string, fieldType string, value string, masterKey []byte) (string, error) {
+	//creates or overwrites a custom field on the given account, the value is encrypted like the account password
+	//returns the name of the field that was set, or a possible error
+	parsedType, err := parseFieldType(fieldType)
+	if err != nil {
+		return "", err
+	}
+	if err := validateFieldValue(parsedType, value); err != nil {
+		return "", err
+	}
+
+	encryptedValue, err := crypto.EncryptPassword([]byte(value), masterKey)
+	if err != nil {
+		logger.Error("error in encrypting field value:", "error", err)
+		return "", err
+	}
+
+	field, err := dbInterface.UpsertEntryField(user.Uid, accountName, fieldName, string(parsedType), encryptedValue)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname, dbInterface.Err0LengthFieldName:
+			logger.Error("Set entry field failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			logger.Error("user account name not found:", "error", err)
+			return "", fmt.Errorf("given account name couldnt be found")
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return field, refreshEntryShare(user, accountName, masterKey)
+}
+
+func decryptFieldRecord(record dbInterface.FieldRecord, masterKey []byte) (userType.EntryField, error) {
+	decryptedValue, err := crypto.DecryptPassword(record.EncryptedData, masterKey)
+	if err != nil {
+		logger.Error("entry field decryption failed:", "error", err)
+		return userType.EntryField{}, fmt.Errorf("internal error when retrieving field")
+	}
+
+	return userType.EntryField{
+		Name:  record.Name,
+		Type:  userType.FieldType(record.FieldType),
+		Value: string(decryptedValue),
+	}, nil
+}
+
+func GetEntryField(user userType.User, accountName string, fieldName string, masterKey []byte) (userType.EntryField, error) {
+	//returns the decrypted field, or possible error
+	record, err := dbInterface.FetchEntryField(user.Uid, accountName, fieldName)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname, dbInterface.Err0LengthFieldName:
+			logger.Error("Get entry field failed:", "error", err)
+			return userType.EntryField{}, err
+		default:
+			logger.Error("entry field not found:", "error", err)
+			return userType.EntryField{}, fmt.Errorf("given field couldnt be found")
+		}
+	}
+
+	return decryptFieldRecord(record, masterKey)
+}
+
+func GetEntryFields(user userType.User, accountName string, masterKey []byte) ([]userType.EntryField, error) {
+	//returns every decrypted custom field of the account, or possible error
+	records, err := dbInterface.FetchEntryFields(user.Uid, accountName)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname:
+			logger.Error("Get entry fields failed:", "error", err)
+			return nil, err
+		default:
+			logger.Error("error in retrieving entry fields:", "error", err)
+			return nil, fmt.Errorf("internal error in retrieving entry fields")
+		}
+	}
+
+	fields := make([]userType.EntryField, 0, len(records))
+	for _, record := range records {
+		field, err := decryptFieldRecord(record, masterKey)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func RemoveEntryField(user userType.User, accountName string, fieldName string, masterKey []byte) (string, error) {
+	field, err := dbInterface.DeleteEntryField(user.Uid, accountName, fieldName)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname, dbInterface.Err0LengthFieldName:
+			logger.Error("Remove entry field failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			logger.Error("entry field not found:", "error", err)
+			return "", fmt.Errorf("given account or field couldnt be found")
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return field, refreshEntryShare(user, accountName, masterKey)
+}
@@ -0,0 +1,220 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"strconv"
+	"strings"
+)
+
+const (
+	//what to do with an imported entry whose name is already taken
+	DUPLICATE_SKIP      = "skip"
+	DUPLICATE_OVERWRITE = "overwrite"
+	DUPLICATE_RENAME    = "rename"
+
+	//names of the fields imported urls and notes are stored under
+	URL_FIELD_NAME   = "url"
+	NOTES_FIELD_NAME = "notes"
+	TOTP_FIELD_NAME  = "totp"
+)
+
+var ErrInvalidDuplicatePolicy = errors.New("duplicate policy must be one of: skip, overwrite, rename")
+
+func normalizeEntryName(name string) string {
+	//account names are lowercase and addressed as a single cli argument, so whitespace is collapsed into dashes
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
+
+func encryptField(field userType.EntryField, masterKey []byte) (dbInterface.FieldRecord, error) {
+	encryptedValue, err := crypto.EncryptPassword([]byte(field.Value), masterKey)
+	if err != nil {
+		return dbInterface.FieldRecord{}, err
+	}
+	return dbInterface.FieldRecord{Name: field.Name, FieldType: string(field.Type), EncryptedData: encryptedValue}, nil
+}
+
+func importedEntryFields(entry userType.VaultEntry) []userType.EntryField {
+	//collects the url, notes and custom fields of the entry, falling back to text for values that dont fit their type
+	fields := make([]userType.EntryField, 0, len(entry.Fields)+2)
+	if len(entry.URL) != 0 {
+		fields = append(fields, userType.EntryField{Name: URL_FIELD_NAME, Type: userType.FieldURL, Value: entry.URL})
+	}
+	if len(entry.Notes) != 0 {
+		fields = append(fields, userType.EntryField{Name: NOTES_FIELD_NAME, Type: userType.FieldText, Value: entry.Notes})
+	}
+	fields = append(fields, entry.Fields...)
+
+	valid := make([]userType.EntryField, 0, len(fields))
+	for _, field := range fields {
+		field.Name = normalizeEntryName(field.Name)
+		if len(field.Name) == 0 || len(field.Value) == 0 {
+			continue
+		}
+		if _, err := parseFieldType(string(field.Type)); err != nil {
+			field.Type = userType.FieldText
+		}
+		if err := validateFieldValue(field.Type, field.Value); err != nil {
+			field.Type = userType.FieldText
+		}
+		valid = append(valid, field)
+	}
+	return valid
+}
+
+func encryptVaultEntry(name string, entry userType.VaultEntry, masterKey []byte) (dbInterface.EntryRecord, error) {
+	encryptedPasswd, err := crypto.EncryptPassword([]byte(entry.Password), masterKey)
+	if err != nil {
+		return dbInterface.EntryRecord{}, err
+	}
+
+	folder, err := normalizeFolderPath(strings.ToLower(entry.Folder))
+	if err != nil {
+		folder = ""
+	}
+
+	record := dbInterface.EntryRecord{
+		Name:          name,
+		Username:      entry.Username,
+		EncryptedData: encryptedPasswd,
+		Folder:        folder,
+		Tags:          make([]string, 0, len(entry.Tags)),
+		Fields:        make([]dbInterface.FieldRecord, 0),
+	}
+
+	for _, tag := range entry.Tags {
+		tag = normalizeEntryName(tag)
+		if len(tag) != 0 && validateTagName(tag) == nil {
+			record.Tags = append(record.Tags, tag)
+		}
+	}
+
+	fields := importedEntryFields(entry)
+	if len(entry.TOTP) != 0 {
+		//an otp secret that cannot generate codes is still worth keeping, as a hidden field
+		config, err := ParseOTPSecret(entry.TOTP)
+		if err == nil {
+			config, err = validateOTPConfig(config)
+		}
+		if err != nil {
+			fields = append(fields, userType.EntryField{Name: TOTP_FIELD_NAME, Type: userType.FieldHidden, Value: entry.TOTP})
+		} else {
+			if len(config.Label) == 0 {
+				config.Label = name
+			}
+			record.OTPCounter = config.Counter
+			if record.EncryptedOTP, err = crypto.EncryptPassword([]byte(otpConfigToURI(config)), masterKey); err != nil {
+				return dbInterface.EntryRecord{}, err
+			}
+		}
+	}
+
+	for _, field := range fields {
+		fieldRecord, err := encryptField(field, masterKey)
+		if err != nil {
+			return dbInterface.EntryRecord{}, err
+		}
+		record.Fields = append(record.Fields, fieldRecord)
+	}
+
+	return record, nil
+}
+
+func ImportUserAccounts(user userType.User, entries []userType.VaultEntry, duplicatePolicy string, dryRun bool, masterKey []byte) (userType.ImportSummary, error) {
+	//imports the entries into the users vault in a single transaction, resolving name clashes with the duplicate policy
+	//a dry run computes and returns the same summary without writing anything
+	switch duplicatePolicy {
+	case DUPLICATE_SKIP, DUPLICATE_OVERWRITE, DUPLICATE_RENAME:
+	default:
+		return userType.ImportSummary{}, ErrInvalidDuplicatePolicy
+	}
+
+	existingNames, err := dbInterface.FetchUserAccounts(user.Uid)
+	if err != nil {
+		logger.Error("error in retrieving user account names:", "error", err)
+		return userType.ImportSummary{}, fmt.Errorf("internal error in retrieving user accounts")
+	}
+	existing := make(map[string]bool, len(existingNames))
+	for _, name := range existingNames {
+		existing[name] = true
+	}
+
+	summary := userType.ImportSummary{
+		Added:       make([]string, 0),
+		Overwritten: make([]string, 0),
+		Renamed:     make([]userType.ImportRename, 0),
+		Skipped:     make([]string, 0),
+	}
+	//names used by earlier entries of the same import, which clash like existing ones do
+	taken := make(map[string]bool)
+	records := make([]dbInterface.EntryRecord, 0, len(entries))
+
+	for _, entry := range entries {
+		name := normalizeEntryName(entry.Name)
+		if len(name) == 0 {
+			summary.Skipped = append(summary.Skipped, "(unnamed entry): no name")
+			continue
+		}
+		if len(entry.Password) == 0 {
+			summary.Skipped = append(summary.Skipped, name+": no password")
+			continue
+		}
+		if len(entry.Username) == 0 {
+			summary.Skipped = append(summary.Skipped, name+": no username")
+			continue
+		}
+
+		replace := false
+		if existing[name] || taken[name] {
+			switch duplicatePolicy {
+			case DUPLICATE_SKIP:
+				summary.Skipped = append(summary.Skipped, name+": duplicate")
+				continue
+			case DUPLICATE_OVERWRITE:
+				if taken[name] {
+					//two entries of the same import clashing cannot both be kept, the first one wins
+					summary.Skipped = append(summary.Skipped, name+": duplicate within import")
+					continue
+				}
+				replace = true
+				summary.Overwritten = append(summary.Overwritten, name)
+			case DUPLICATE_RENAME:
+				renamed := name
+				for i := 2; existing[renamed] || taken[renamed]; i++ {
+					renamed = name + "-" + strconv.Itoa(i)
+				}
+				summary.Renamed = append(summary.Renamed, userType.ImportRename{From: name, To: renamed})
+				name = renamed
+			}
+		}
+		if !replace {
+			summary.Added = append(summary.Added, name)
+		}
+		taken[name] = true
+
+		record, err := encryptVaultEntry(name, entry, masterKey)
+		if err != nil {
+			logger.Error("error in encrypting imported entry:", "error", err)
+			return userType.ImportSummary{}, fmt.Errorf("internal error when encrypting imported entries")
+		}
+		record.Replace = replace
+		records = append(records, record)
+	}
+
+	if dryRun {
+		return summary, nil
+	}
+
+	inserted, err := dbInterface.InsertUserAccountsBatch(user.Uid, records)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return userType.ImportSummary{}, fmt.Errorf("internal error, nothing was imported")
+	}
+
+	logger.Info("Imported user accounts", "username", user.Name, "count", inserted)
+	//overwritten entries kept their row, recipients of a shared one get the imported version
+	return summary, refreshEntryShares(user, summary.Overwritten, masterKey)
+}
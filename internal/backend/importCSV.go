@@ -0,0 +1,166 @@
+package backend
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"passwordManager/internal/userType"
+	"strings"
+)
+
+const (
+	//csv export formats the importer understands
+	CSV_FORMAT_AUTO      = "auto"
+	CSV_FORMAT_CHROME    = "chrome"
+	CSV_FORMAT_FIREFOX   = "firefox"
+	CSV_FORMAT_BITWARDEN = "bitwarden"
+
+	//bitwarden exports secure notes, cards and identities in the same file, only logins carry credentials
+	BITWARDEN_LOGIN_TYPE = "login"
+)
+
+var ErrUnknownCSVFormat = errors.New("csv format must be one of: auto, chrome, firefox, bitwarden")
+
+// columns that identify each export format, all of them have to be present in the header
+var csvFormatColumns = map[string][]string{
+	CSV_FORMAT_CHROME:    {"name", "url", "username", "password"},
+	CSV_FORMAT_FIREFOX:   {"url", "username", "password", "httprealm"},
+	CSV_FORMAT_BITWARDEN: {"type", "name", "login_uri", "login_username", "login_password"},
+}
+
+func detectCSVFormat(columns map[string]int) string {
+	//bitwarden and firefox are checked first since their headers are the most specific
+	for _, format := range []string{CSV_FORMAT_BITWARDEN, CSV_FORMAT_FIREFOX, CSV_FORMAT_CHROME} {
+		matches := true
+		for _, column := range csvFormatColumns[format] {
+			if _, ok := columns[column]; !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return format
+		}
+	}
+	return ""
+}
+
+func nameFromURL(rawURL string) string {
+	//firefox exports have no entry names, the host of the url is the closest thing
+	parsed, err := url.Parse(rawURL)
+	if err != nil || len(parsed.Hostname()) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(parsed.Hostname(), "www.")
+}
+
+func parseBitwardenFields(raw string) []userType.EntryField {
+	//bitwarden writes custom fields as "name: value" lines
+	fields := make([]userType.EntryField, 0)
+	for _, line := range strings.Split(raw, "\n") {
+		name, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		fields = append(fields, userType.EntryField{Name: name, Type: userType.FieldText, Value: strings.TrimSpace(value)})
+	}
+	return fields
+}
+
+func ParseCSVExport(reader io.Reader, format string) ([]userType.VaultEntry, string, error) {
+	//reads a browser or bitwarden csv export, detecting the format from the header when it is auto
+	//returns the entries, the format that was used, or a possible error
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		//excel and some browsers prepend a byte order mark to the first column
+		column = strings.TrimPrefix(column, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	switch format {
+	case CSV_FORMAT_AUTO, "":
+		format = detectCSVFormat(columns)
+		if len(format) == 0 {
+			return nil, "", fmt.Errorf("could not detect the csv format from its header")
+		}
+	case CSV_FORMAT_CHROME, CSV_FORMAT_FIREFOX, CSV_FORMAT_BITWARDEN:
+		for _, column := range csvFormatColumns[format] {
+			if _, ok := columns[column]; !ok {
+				return nil, "", fmt.Errorf("csv header is missing the %s column of the %s format", column, format)
+			}
+		}
+	default:
+		return nil, "", ErrUnknownCSVFormat
+	}
+
+	entries := make([]userType.VaultEntry, 0)
+	for line := 2; ; line++ {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read csv line %d: %w", line, err)
+		}
+
+		get := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return row[i]
+		}
+
+		var entry userType.VaultEntry
+		switch format {
+		case CSV_FORMAT_CHROME:
+			entry = userType.VaultEntry{
+				Name:     get("name"),
+				Username: get("username"),
+				Password: get("password"),
+				URL:      get("url"),
+				Notes:    get("note"),
+			}
+		case CSV_FORMAT_FIREFOX:
+			entry = userType.VaultEntry{
+				Name:     nameFromURL(get("url")),
+				Username: get("username"),
+				Password: get("password"),
+				URL:      get("url"),
+			}
+		case CSV_FORMAT_BITWARDEN:
+			if recordType := get("type"); len(recordType) != 0 && recordType != BITWARDEN_LOGIN_TYPE {
+				continue
+			}
+			entry = userType.VaultEntry{
+				Name:     get("name"),
+				Username: get("login_username"),
+				Password: get("login_password"),
+				//bitwarden joins several uris with commas, the first one is the primary
+				URL:    strings.TrimSpace(strings.Split(get("login_uri"), ",")[0]),
+				Notes:  get("notes"),
+				Folder: get("folder"),
+				TOTP:   get("login_totp"),
+				Fields: parseBitwardenFields(get("fields")),
+			}
+		}
+
+		if len(entry.Name) == 0 {
+			entry.Name = nameFromURL(entry.URL)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, format, nil
+}
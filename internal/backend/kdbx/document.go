@@ -0,0 +1,347 @@
+package kdbx
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"net/url"
+	"passwordManager/internal/userType"
+	"strings"
+	"time"
+)
+
+const (
+	//keys of the standard strings of an entry, every other string is a custom field
+	KEY_TITLE    = "Title"
+	KEY_USERNAME = "UserName"
+	KEY_PASSWORD = "Password"
+	KEY_URL      = "URL"
+	KEY_NOTES    = "Notes"
+	//keepassxc stores totp secrets as an otpauth uri under this key
+	KEY_OTP = "otp"
+
+	//keepass 2.47+ stores otp secrets split over several strings
+	KEY_TIME_OTP_SECRET    = "TimeOtp-Secret-Base32"
+	KEY_TIME_OTP_LENGTH    = "TimeOtp-Length"
+	KEY_TIME_OTP_PERIOD    = "TimeOtp-Period"
+	KEY_TIME_OTP_ALGORITHM = "TimeOtp-Algorithm"
+	KEY_HMAC_OTP_SECRET    = "HmacOtp-Secret-Base32"
+	KEY_HMAC_OTP_COUNTER   = "HmacOtp-Counter"
+
+	ROOT_GROUP_NAME = "Root"
+	GENERATOR       = "passmngr"
+
+	//kdbx 4 stores times as seconds since 0001-01-01, this is the offset to the unix epoch
+	KDBX_EPOCH_OFFSET = 62135596800
+)
+
+// xmlNode is a generic xml element. Children are kept in document order, which the inner random stream depends on.
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Nodes   []xmlNode  `xml:",any"`
+}
+
+func (node *xmlNode) child(name string) *xmlNode {
+	for i := range node.Nodes {
+		if node.Nodes[i].XMLName.Local == name {
+			return &node.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func (node *xmlNode) childText(name string) string {
+	if child := node.child(name); child != nil {
+		return child.Content
+	}
+	return ""
+}
+
+func (node *xmlNode) attr(name string) string {
+	for _, attr := range node.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func unprotect(node *xmlNode, stream innerStream) error {
+	//walks the document in order, replacing protected values with their plaintext
+	if strings.EqualFold(node.attr("Protected"), "True") {
+		ciphertext, err := base64.StdEncoding.DecodeString(node.Content)
+		if err != nil {
+			return ErrCorrupted
+		}
+		plaintext := make([]byte, len(ciphertext))
+		stream.XORKeyStream(plaintext, ciphertext)
+		node.Content = string(plaintext)
+	}
+	for i := range node.Nodes {
+		if err := unprotect(&node.Nodes[i], stream); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func otpFromKeePassStrings(strs map[string]string) string {
+	//rebuilds an otpauth uri from the split keepass 2.47 otp strings
+	values := url.Values{}
+	kind := "totp"
+	switch {
+	case len(strs[KEY_TIME_OTP_SECRET]) != 0:
+		values.Set("secret", strs[KEY_TIME_OTP_SECRET])
+		if length := strs[KEY_TIME_OTP_LENGTH]; len(length) != 0 {
+			values.Set("digits", length)
+		}
+		if period := strs[KEY_TIME_OTP_PERIOD]; len(period) != 0 {
+			values.Set("period", period)
+		}
+		if algorithm := strs[KEY_TIME_OTP_ALGORITHM]; len(algorithm) != 0 {
+			//keepass writes HMAC-SHA-256, otpauth uris use SHA256
+			values.Set("algorithm", strings.ReplaceAll(strings.TrimPrefix(algorithm, "HMAC-"), "-", ""))
+		}
+	case len(strs[KEY_HMAC_OTP_SECRET]) != 0:
+		kind = "hotp"
+		values.Set("secret", strs[KEY_HMAC_OTP_SECRET])
+		if counter := strs[KEY_HMAC_OTP_COUNTER]; len(counter) != 0 {
+			values.Set("counter", counter)
+		}
+	default:
+		return ""
+	}
+	uri := url.URL{Scheme: "otpauth", Host: kind, Path: "/", RawQuery: values.Encode()}
+	return uri.String()
+}
+
+func isKeePassOTPKey(key string) bool {
+	return strings.HasPrefix(key, "TimeOtp-") || strings.HasPrefix(key, "HmacOtp-")
+}
+
+func parseEntry(node *xmlNode, folder string) userType.VaultEntry {
+	entry := userType.VaultEntry{
+		Folder: folder,
+		Tags:   make([]string, 0),
+		Fields: make([]userType.EntryField, 0),
+	}
+
+	strs := make(map[string]string)
+	for i := range node.Nodes {
+		str := &node.Nodes[i]
+		if str.XMLName.Local != "String" {
+			continue
+		}
+		key := str.childText("Key")
+		value := str.child("Value")
+		if value == nil {
+			continue
+		}
+		strs[key] = value.Content
+
+		switch {
+		case key == KEY_TITLE:
+			entry.Name = value.Content
+		case key == KEY_USERNAME:
+			entry.Username = value.Content
+		case key == KEY_PASSWORD:
+			entry.Password = value.Content
+		case key == KEY_URL:
+			entry.URL = value.Content
+		case key == KEY_NOTES:
+			entry.Notes = value.Content
+		case key == KEY_OTP:
+			entry.TOTP = value.Content
+		case isKeePassOTPKey(key):
+		default:
+			fieldType := userType.FieldText
+			if strings.EqualFold(value.attr("Protected"), "True") || strings.EqualFold(value.attr("ProtectInMemory"), "True") {
+				fieldType = userType.FieldHidden
+			}
+			entry.Fields = append(entry.Fields, userType.EntryField{Name: key, Type: fieldType, Value: value.Content})
+		}
+	}
+	if len(entry.TOTP) == 0 {
+		entry.TOTP = otpFromKeePassStrings(strs)
+	}
+
+	for _, tag := range strings.FieldsFunc(node.childText("Tags"), func(r rune) bool { return r == ';' || r == ',' }) {
+		if tag = strings.TrimSpace(tag); len(tag) != 0 {
+			entry.Tags = append(entry.Tags, tag)
+		}
+	}
+	return entry
+}
+
+func parseGroup(node *xmlNode, folder string, recycleBin string, entries []userType.VaultEntry) []userType.VaultEntry {
+	if len(recycleBin) != 0 && node.childText("UUID") == recycleBin {
+		return entries
+	}
+
+	for i := range node.Nodes {
+		child := &node.Nodes[i]
+		switch child.XMLName.Local {
+		case "Entry":
+			entries = append(entries, parseEntry(child, folder))
+		case "Group":
+			//folder separators inside a group name would create folders that dont exist in the source
+			name := strings.ReplaceAll(strings.TrimSpace(child.childText("Name")), "/", "-")
+			childFolder := name
+			if len(folder) != 0 {
+				childFolder = folder + "/" + name
+			}
+			entries = parseGroup(child, childFolder, recycleBin, entries)
+		}
+	}
+	return entries
+}
+
+func parseDocument(document []byte, stream innerStream) ([]userType.VaultEntry, error) {
+	var root xmlNode
+	if err := xml.Unmarshal(document, &root); err != nil {
+		return nil, ErrCorrupted
+	}
+	if root.XMLName.Local != "KeePassFile" {
+		return nil, ErrCorrupted
+	}
+	if err := unprotect(&root, stream); err != nil {
+		return nil, err
+	}
+
+	recycleBin := ""
+	if meta := root.child("Meta"); meta != nil && !strings.EqualFold(meta.childText("RecycleBinEnabled"), "False") {
+		recycleBin = meta.childText("RecycleBinUUID")
+	}
+
+	entries := make([]userType.VaultEntry, 0)
+	dbRoot := root.child("Root")
+	if dbRoot == nil {
+		return entries, nil
+	}
+	//the top level group is the database itself, its name is not part of any folder path
+	if topGroup := dbRoot.child("Group"); topGroup != nil {
+		entries = parseGroup(topGroup, "", recycleBin, entries)
+	}
+	return entries, nil
+}
+
+// documentBuilder creates the xml document, encrypting protected values as they are added.
+// Nodes have to be added in document order for the inner random stream to line up with a reader.
+type documentBuilder struct {
+	stream innerStream
+	now    string
+	random func(int) []byte
+}
+
+func textNode(name string, content string) xmlNode {
+	return xmlNode{XMLName: xml.Name{Local: name}, Content: content}
+}
+
+func kdbxTime(t time.Time) string {
+	var encoded [8]byte
+	binary.LittleEndian.PutUint64(encoded[:], uint64(t.Unix()+KDBX_EPOCH_OFFSET))
+	return base64.StdEncoding.EncodeToString(encoded[:])
+}
+
+func (builder *documentBuilder) uuidNode() xmlNode {
+	return textNode("UUID", base64.StdEncoding.EncodeToString(builder.random(16)))
+}
+
+func (builder *documentBuilder) timesNode() xmlNode {
+	times := xmlNode{XMLName: xml.Name{Local: "Times"}}
+	for _, name := range []string{"CreationTime", "LastModificationTime", "LastAccessTime", "ExpiryTime", "LocationChanged"} {
+		times.Nodes = append(times.Nodes, textNode(name, builder.now))
+	}
+	times.Nodes = append(times.Nodes, textNode("Expires", "False"), textNode("UsageCount", "0"))
+	return times
+}
+
+func (builder *documentBuilder) stringNode(key string, value string, protected bool) xmlNode {
+	valueNode := textNode("Value", value)
+	if protected {
+		ciphertext := make([]byte, len(value))
+		builder.stream.XORKeyStream(ciphertext, []byte(value))
+		valueNode.Content = base64.StdEncoding.EncodeToString(ciphertext)
+		valueNode.Attrs = []xml.Attr{{Name: xml.Name{Local: "Protected"}, Value: "True"}}
+	}
+	return xmlNode{XMLName: xml.Name{Local: "String"}, Nodes: []xmlNode{textNode("Key", key), valueNode}}
+}
+
+func (builder *documentBuilder) entryNode(entry userType.VaultEntry) xmlNode {
+	node := xmlNode{XMLName: xml.Name{Local: "Entry"}}
+	node.Nodes = append(node.Nodes, builder.uuidNode(), builder.timesNode(), textNode("Tags", strings.Join(entry.Tags, ";")))
+
+	node.Nodes = append(node.Nodes,
+		builder.stringNode(KEY_TITLE, entry.Name, false),
+		builder.stringNode(KEY_USERNAME, entry.Username, false),
+		builder.stringNode(KEY_PASSWORD, entry.Password, true),
+		builder.stringNode(KEY_URL, entry.URL, false),
+		builder.stringNode(KEY_NOTES, entry.Notes, false),
+	)
+	if len(entry.TOTP) != 0 {
+		node.Nodes = append(node.Nodes, builder.stringNode(KEY_OTP, entry.TOTP, true))
+	}
+	for _, field := range entry.Fields {
+		node.Nodes = append(node.Nodes, builder.stringNode(field.Name, field.Value, field.Type == userType.FieldHidden))
+	}
+	return node
+}
+
+// folderTree groups entries by folder so they can be written as nested keepass groups.
+type folderTree struct {
+	entries  []userType.VaultEntry
+	names    []string
+	children map[string]*folderTree
+}
+
+func buildFolderTree(entries []userType.VaultEntry) *folderTree {
+	root := &folderTree{children: map[string]*folderTree{}}
+	for _, entry := range entries {
+		node := root
+		if len(entry.Folder) != 0 {
+			for _, segment := range strings.Split(entry.Folder, "/") {
+				child, ok := node.children[segment]
+				if !ok {
+					child = &folderTree{children: map[string]*folderTree{}}
+					node.children[segment] = child
+					node.names = append(node.names, segment)
+				}
+				node = child
+			}
+		}
+		node.entries = append(node.entries, entry)
+	}
+	return root
+}
+
+func (builder *documentBuilder) groupNode(name string, tree *folderTree) xmlNode {
+	node := xmlNode{XMLName: xml.Name{Local: "Group"}}
+	node.Nodes = append(node.Nodes, builder.uuidNode(), textNode("Name", name), builder.timesNode())
+	for _, entry := range tree.entries {
+		node.Nodes = append(node.Nodes, builder.entryNode(entry))
+	}
+	for _, childName := range tree.names {
+		node.Nodes = append(node.Nodes, builder.groupNode(childName, tree.children[childName]))
+	}
+	return node
+}
+
+func (builder *documentBuilder) build(databaseName string, entries []userType.VaultEntry) ([]byte, error) {
+	meta := xmlNode{XMLName: xml.Name{Local: "Meta"}, Nodes: []xmlNode{
+		textNode("Generator", GENERATOR),
+		textNode("DatabaseName", databaseName),
+		textNode("RecycleBinEnabled", "False"),
+	}}
+	dbRoot := xmlNode{XMLName: xml.Name{Local: "Root"}, Nodes: []xmlNode{
+		builder.groupNode(ROOT_GROUP_NAME, buildFolderTree(entries)),
+	}}
+	root := xmlNode{XMLName: xml.Name{Local: "KeePassFile"}, Nodes: []xmlNode{meta, dbRoot}}
+
+	document, err := xml.MarshalIndent(root, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), document...), nil
+}
@@ -0,0 +1,402 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/userType"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	//magic numbers every keepass 2 database starts with
+	SIGNATURE_1 uint32 = 0x9AA2D903
+	SIGNATURE_2 uint32 = 0xB54BFB67
+
+	//file version 4.0, major version in the upper 16 bits
+	FILE_VERSION_4 uint32 = 0x00040000
+
+	//outer header field ids
+	HEADER_END                = 0
+	HEADER_CIPHER_ID          = 2
+	HEADER_COMPRESSION        = 3
+	HEADER_MASTER_SEED        = 4
+	HEADER_ENCRYPTION_IV      = 7
+	HEADER_KDF_PARAMETERS     = 11
+	HEADER_PUBLIC_CUSTOM_DATA = 12
+
+	//inner header field ids
+	INNER_HEADER_END        = 0
+	INNER_HEADER_STREAM_ID  = 1
+	INNER_HEADER_STREAM_KEY = 2
+	INNER_HEADER_BINARY     = 3
+
+	//inner random stream algorithms protecting in-memory values
+	INNER_STREAM_SALSA20  = 2
+	INNER_STREAM_CHACHA20 = 3
+
+	COMPRESSION_NONE = 0
+	COMPRESSION_GZIP = 1
+
+	//size of the hmac protected blocks the payload is split into when writing
+	HMAC_BLOCK_SIZE = 1024 * 1024
+
+	//argon2 version supported in the kdf parameters
+	ARGON2_VERSION_13 = 0x13
+
+	//refuse kdf parameters above these, a crafted header should not be able to exhaust memory or hang the import
+	//they are far above what keepass and keepassxc pick for a one second unlock
+	KDBX_MAX_ARGON_MEMORY     = 1024 * 1024 * 1024
+	KDBX_MAX_ARGON_ITERATIONS = 100
+	KDBX_MAX_AES_ROUNDS       = 200_000_000
+)
+
+var (
+	CIPHER_CHACHA20 = []byte{0xD6, 0x03, 0x8A, 0x2B, 0x8B, 0x6F, 0x4C, 0xB5, 0xA5, 0x24, 0x33, 0x9A, 0x31, 0xDB, 0xB5, 0x9A}
+	CIPHER_AES256   = []byte{0x31, 0xC1, 0xF2, 0xE6, 0xBF, 0x71, 0x43, 0x50, 0xBE, 0x58, 0x05, 0x21, 0x6A, 0xFC, 0x5A, 0xFF}
+
+	KDF_ARGON2D  = []byte{0xEF, 0x63, 0x6D, 0xDF, 0x8C, 0x29, 0x44, 0x4B, 0x91, 0xF7, 0xA9, 0xA4, 0x03, 0xE3, 0x0A, 0x0C}
+	KDF_ARGON2ID = []byte{0x9E, 0x29, 0x8B, 0x19, 0x56, 0xDB, 0x47, 0x73, 0xB2, 0x3D, 0xFC, 0x3E, 0xC6, 0xF0, 0xA1, 0xE6}
+	KDF_AES      = []byte{0xC9, 0xD9, 0xF3, 0x9A, 0x62, 0x8A, 0x44, 0x60, 0xBF, 0x74, 0x0D, 0x08, 0xC1, 0x8A, 0x4F, 0xEA}
+)
+
+var (
+	ErrNotKDBX            = errors.New("file is not a keepass database")
+	ErrUnsupportedVersion = errors.New("only KDBX 4 databases are supported, save the database with KDBX 4 format first")
+	ErrUnsupportedCipher  = errors.New("only ChaCha20 and AES-256 encrypted databases are supported")
+	ErrUnsupportedKDF     = errors.New("only Argon2d, Argon2id and AES-KDF key derivation are supported")
+	ErrInvalidCredentials = errors.New("wrong passphrase or corrupted database")
+	ErrCorrupted          = errors.New("database is corrupted")
+	ErrKDFTooExpensive    = errors.New("key derivation parameters of the database exceed the supported limits")
+)
+
+type outerHeader struct {
+	cipherID      []byte
+	compression   uint32
+	masterSeed    []byte
+	encryptionIV  []byte
+	kdfParameters variantDictionary
+}
+
+func HasSignature(data []byte) bool {
+	//reports whether the data starts like a keepass 2 database, of any version
+	return len(data) >= 8 && binary.LittleEndian.Uint32(data[0:4]) == SIGNATURE_1 && binary.LittleEndian.Uint32(data[4:8]) == SIGNATURE_2
+}
+
+func readOuterHeader(data []byte) (outerHeader, int, error) {
+	//returns the parsed header and its length in bytes, which is what the header hash and hmac cover
+	if len(data) < 12 {
+		return outerHeader{}, 0, ErrNotKDBX
+	}
+	if !HasSignature(data) {
+		return outerHeader{}, 0, ErrNotKDBX
+	}
+	if binary.LittleEndian.Uint32(data[8:12])>>16 != FILE_VERSION_4>>16 {
+		return outerHeader{}, 0, ErrUnsupportedVersion
+	}
+
+	var header outerHeader
+	offset := 12
+	for {
+		if offset+5 > len(data) {
+			return outerHeader{}, 0, ErrCorrupted
+		}
+		id := data[offset]
+		size := int(binary.LittleEndian.Uint32(data[offset+1 : offset+5]))
+		offset += 5
+		if size < 0 || offset+size > len(data) {
+			return outerHeader{}, 0, ErrCorrupted
+		}
+		value := data[offset : offset+size]
+		offset += size
+
+		switch id {
+		case HEADER_END:
+			return header, offset, nil
+		case HEADER_CIPHER_ID:
+			header.cipherID = value
+		case HEADER_COMPRESSION:
+			if len(value) != 4 {
+				return outerHeader{}, 0, ErrCorrupted
+			}
+			header.compression = binary.LittleEndian.Uint32(value)
+		case HEADER_MASTER_SEED:
+			header.masterSeed = value
+		case HEADER_ENCRYPTION_IV:
+			header.encryptionIV = value
+		case HEADER_KDF_PARAMETERS:
+			params, err := readVariantDictionary(value)
+			if err != nil {
+				return outerHeader{}, 0, err
+			}
+			header.kdfParameters = params
+		}
+	}
+}
+
+func compositeKey(password string) []byte {
+	//keepass hashes every key component and then hashes the concatenation, here the password is the only component
+	passwordHash := sha256.Sum256([]byte(password))
+	composite := sha256.Sum256(passwordHash[:])
+	return composite[:]
+}
+
+func transformKey(params variantDictionary, composite []byte) ([]byte, error) {
+	uuid, _ := params["$UUID"].([]byte)
+	switch {
+	case bytes.Equal(uuid, KDF_ARGON2D), bytes.Equal(uuid, KDF_ARGON2ID):
+		salt, okSalt := params["S"].([]byte)
+		parallelism, okP := params["P"].(uint32)
+		memory, okM := params["M"].(uint64)
+		iterations, okI := params["I"].(uint64)
+		version, okV := params["V"].(uint32)
+		if !okSalt || !okP || !okM || !okI || !okV {
+			return nil, ErrCorrupted
+		}
+		if version != ARGON2_VERSION_13 {
+			return nil, fmt.Errorf("argon2 version %#x is not supported", version)
+		}
+		//keepass stores the memory in bytes, argon2 takes KiB
+		if parallelism < 1 || parallelism > 255 || iterations < 1 {
+			return nil, ErrCorrupted
+		}
+		if iterations > KDBX_MAX_ARGON_ITERATIONS || memory > KDBX_MAX_ARGON_MEMORY {
+			return nil, ErrKDFTooExpensive
+		}
+		if bytes.Equal(uuid, KDF_ARGON2D) {
+			return crypto.Argon2dKey(composite, salt, uint32(iterations), uint32(memory/1024), uint8(parallelism), 32), nil
+		}
+		return argon2.IDKey(composite, salt, uint32(iterations), uint32(memory/1024), uint8(parallelism), 32), nil
+
+	case bytes.Equal(uuid, KDF_AES):
+		seed, okSeed := params["S"].([]byte)
+		rounds, okRounds := params["R"].(uint64)
+		if !okSeed || !okRounds {
+			return nil, ErrCorrupted
+		}
+		if rounds > KDBX_MAX_AES_ROUNDS {
+			return nil, ErrKDFTooExpensive
+		}
+		block, err := aes.NewCipher(seed)
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+		key := bytes.Clone(composite)
+		for range rounds {
+			block.Encrypt(key[0:16], key[0:16])
+			block.Encrypt(key[16:32], key[16:32])
+		}
+		transformed := sha256.Sum256(key)
+		return transformed[:], nil
+
+	default:
+		return nil, ErrUnsupportedKDF
+	}
+}
+
+func deriveKeys(masterSeed []byte, transformedKey []byte) ([]byte, []byte) {
+	//returns the payload encryption key and the base key of the hmac block stream
+	encryptionKey := sha256.Sum256(append(bytes.Clone(masterSeed), transformedKey...))
+
+	hmacInput := append(bytes.Clone(masterSeed), transformedKey...)
+	hmacKey := sha512.Sum512(append(hmacInput, 0x01))
+	return encryptionKey[:], hmacKey[:]
+}
+
+func blockHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	//every block is authenticated with its own key, derived from the block index
+	var indexBytes [8]byte
+	binary.LittleEndian.PutUint64(indexBytes[:], index)
+	blockKey := sha512.Sum512(append(indexBytes[:], hmacKey...))
+
+	var sizeBytes [4]byte
+	binary.LittleEndian.PutUint32(sizeBytes[:], uint32(len(data)))
+
+	mac := hmac.New(sha256.New, blockKey[:])
+	mac.Write(indexBytes[:])
+	mac.Write(sizeBytes[:])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func headerHMAC(hmacKey []byte, header []byte) []byte {
+	//the header is authenticated like a block with the largest possible index
+	var indexBytes [8]byte
+	binary.LittleEndian.PutUint64(indexBytes[:], ^uint64(0))
+	blockKey := sha512.Sum512(append(indexBytes[:], hmacKey...))
+
+	mac := hmac.New(sha256.New, blockKey[:])
+	mac.Write(header)
+	return mac.Sum(nil)
+}
+
+func readBlocks(data []byte, hmacKey []byte) ([]byte, error) {
+	//verifies and concatenates the hmac block stream, which ends with an empty block
+	payload := make([]byte, 0, len(data))
+	offset := 0
+	for index := uint64(0); ; index++ {
+		if offset+36 > len(data) {
+			return nil, ErrCorrupted
+		}
+		mac := data[offset : offset+32]
+		size := int(int32(binary.LittleEndian.Uint32(data[offset+32 : offset+36])))
+		offset += 36
+		if size < 0 || offset+size > len(data) {
+			return nil, ErrCorrupted
+		}
+		block := data[offset : offset+size]
+		offset += size
+
+		if !hmac.Equal(mac, blockHMAC(hmacKey, index, block)) {
+			return nil, ErrCorrupted
+		}
+		if size == 0 {
+			return payload, nil
+		}
+		payload = append(payload, block...)
+	}
+}
+
+func decryptPayload(header outerHeader, key []byte, ciphertext []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(header.cipherID, CIPHER_CHACHA20):
+		stream, err := chacha20.NewUnauthenticatedCipher(key, header.encryptionIV)
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+		plaintext := make([]byte, len(ciphertext))
+		stream.XORKeyStream(plaintext, ciphertext)
+		return plaintext, nil
+
+	case bytes.Equal(header.cipherID, CIPHER_AES256):
+		block, err := aes.NewCipher(key)
+		if err != nil || len(header.encryptionIV) != aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 || len(ciphertext) == 0 {
+			return nil, ErrCorrupted
+		}
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, header.encryptionIV).CryptBlocks(plaintext, ciphertext)
+
+		//strip the pkcs7 padding
+		padding := int(plaintext[len(plaintext)-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, ErrCorrupted
+		}
+		return plaintext[:len(plaintext)-padding], nil
+
+	default:
+		return nil, ErrUnsupportedCipher
+	}
+}
+
+func readInnerHeader(payload []byte) (uint32, []byte, []byte, error) {
+	//returns the inner random stream algorithm, its key, and the xml document following the inner header
+	var streamID uint32
+	var streamKey []byte
+	offset := 0
+	for {
+		if offset+5 > len(payload) {
+			return 0, nil, nil, ErrCorrupted
+		}
+		id := payload[offset]
+		size := int(int32(binary.LittleEndian.Uint32(payload[offset+1 : offset+5])))
+		offset += 5
+		if size < 0 || offset+size > len(payload) {
+			return 0, nil, nil, ErrCorrupted
+		}
+		value := payload[offset : offset+size]
+		offset += size
+
+		switch id {
+		case INNER_HEADER_END:
+			return streamID, streamKey, payload[offset:], nil
+		case INNER_HEADER_STREAM_ID:
+			if len(value) != 4 {
+				return 0, nil, nil, ErrCorrupted
+			}
+			streamID = binary.LittleEndian.Uint32(value)
+		case INNER_HEADER_STREAM_KEY:
+			streamKey = value
+		case INNER_HEADER_BINARY:
+			//attachments are not imported
+		}
+	}
+}
+
+func Read(reader io.Reader, password string) ([]userType.VaultEntry, error) {
+	//decrypts a KDBX 4 database with the given password and returns its entries
+	//groups become folder paths, the recycle bin and entry history are left out
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	header, headerLen, err := readOuterHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.masterSeed) != 32 || header.kdfParameters == nil {
+		return nil, ErrCorrupted
+	}
+	if len(data) < headerLen+64 {
+		return nil, ErrCorrupted
+	}
+
+	headerHash := sha256.Sum256(data[:headerLen])
+	if !bytes.Equal(headerHash[:], data[headerLen:headerLen+32]) {
+		return nil, ErrCorrupted
+	}
+
+	transformedKey, err := transformKey(header.kdfParameters, compositeKey(password))
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey, hmacKey := deriveKeys(header.masterSeed, transformedKey)
+
+	//a mismatching header hmac is the first sign of a wrong password
+	if !hmac.Equal(headerHMAC(hmacKey, data[:headerLen]), data[headerLen+32:headerLen+64]) {
+		return nil, ErrInvalidCredentials
+	}
+
+	ciphertext, err := readBlocks(data[headerLen+64:], hmacKey)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := decryptPayload(header, encryptionKey, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.compression == COMPRESSION_GZIP {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+		payload, err = io.ReadAll(gzipReader)
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+	}
+
+	streamID, streamKey, document, err := readInnerHeader(payload)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newInnerStream(streamID, streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDocument(document, stream)
+}
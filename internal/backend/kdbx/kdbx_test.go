@@ -0,0 +1,70 @@
+package kdbx
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"passwordManager/internal/userType"
+)
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	entries := []userType.VaultEntry{
+		{Name: "github", Username: "octocat", Password: "hunter2", URL: "https://github.com", Notes: "line one\nline two",
+			Folder: "work/dev", TOTP: "otpauth://totp/github?secret=JBSWY3DPEHPK3PXP", Tags: []string{"code", "work"},
+			Fields: []userType.EntryField{{Name: "pin", Type: userType.FieldHidden, Value: "1234"}, {Name: "team", Type: userType.FieldText, Value: "core"}}},
+		{Name: "mail", Username: "me@example.com", Password: "<&\"'>", Tags: []string{}, Fields: []userType.EntryField{}},
+		{Name: "bank", Username: "me", Password: "s3cret", Folder: "work", Tags: []string{}, Fields: []userType.EntryField{}},
+	}
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, "passphrase", "test", entries); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if _, err := Read(bytes.NewReader(buffer.Bytes()), "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("read with a wrong passphrase: got %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	read, err := Read(bytes.NewReader(buffer.Bytes()), "passphrase")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(read) != len(entries) {
+		t.Fatalf("read %d entries, want %d", len(read), len(entries))
+	}
+	byName := make(map[string]userType.VaultEntry, len(read))
+	for _, entry := range read {
+		byName[entry.Name] = entry
+	}
+	for _, want := range entries {
+		got, ok := byName[want.Name]
+		if !ok {
+			t.Errorf("entry %s missing", want.Name)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("entry %s: got %+v, want %+v", want.Name, got, want)
+		}
+	}
+}
+
+func TestTransformKeyLimits(t *testing.T) {
+	//parameters a crafted file could carry, refused before any memory is allocated or round is run
+	salt := make([]byte, 32)
+	composite := make([]byte, 32)
+	tests := []struct {
+		name   string
+		params variantDictionary
+	}{
+		{"argon2 memory", variantDictionary{"$UUID": KDF_ARGON2D, "S": salt, "P": uint32(1), "M": uint64(1 << 42), "I": uint64(1), "V": uint32(ARGON2_VERSION_13)}},
+		{"argon2 iterations", variantDictionary{"$UUID": KDF_ARGON2ID, "S": salt, "P": uint32(1), "M": uint64(1 << 20), "I": uint64(1 << 40), "V": uint32(ARGON2_VERSION_13)}},
+		{"aes rounds", variantDictionary{"$UUID": KDF_AES, "S": salt, "R": uint64(1 << 62)}},
+	}
+	for _, test := range tests {
+		if _, err := transformKey(test.params, composite); !errors.Is(err, ErrKDFTooExpensive) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrKDFTooExpensive)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package kdbx
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// innerStream is the keystream protected values of the xml document are xored with, in document order.
+type innerStream interface {
+	XORKeyStream(dst, src []byte)
+}
+
+// SALSA20_NONCE is the fixed nonce keepass uses for the salsa20 inner stream.
+var SALSA20_NONCE = []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+
+// salsa20Stream turns the block function of x/crypto into a continuous keystream.
+type salsa20Stream struct {
+	key       [32]byte
+	counter   uint64
+	keystream []byte
+}
+
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if len(s.keystream) == 0 {
+			var input [16]byte
+			copy(input[:8], SALSA20_NONCE)
+			binary.LittleEndian.PutUint64(input[8:], s.counter)
+			block := make([]byte, 64)
+			salsa.XORKeyStream(block, block, &input, &s.key)
+			s.keystream = block
+			s.counter++
+		}
+		dst[i] = src[i] ^ s.keystream[0]
+		s.keystream = s.keystream[1:]
+	}
+}
+
+func newInnerStream(streamID uint32, streamKey []byte) (innerStream, error) {
+	switch streamID {
+	case INNER_STREAM_CHACHA20:
+		hash := sha512.Sum512(streamKey)
+		return chacha20.NewUnauthenticatedCipher(hash[:32], hash[32:44])
+	case INNER_STREAM_SALSA20:
+		return &salsa20Stream{key: sha256.Sum256(streamKey)}, nil
+	default:
+		return nil, fmt.Errorf("inner random stream %d is not supported", streamID)
+	}
+}
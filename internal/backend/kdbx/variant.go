@@ -0,0 +1,130 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	//version of the variant dictionary format, only the major byte is checked when reading
+	VARIANT_DICTIONARY_VERSION uint16 = 0x0100
+
+	variantEnd       = 0x00
+	variantUInt32    = 0x04
+	variantUInt64    = 0x05
+	variantBool      = 0x08
+	variantInt32     = 0x0C
+	variantInt64     = 0x0D
+	variantString    = 0x18
+	variantByteArray = 0x42
+)
+
+// variantDictionary holds the typed key value pairs keepass uses for kdf parameters.
+type variantDictionary map[string]any
+
+// variantItem is a single entry of a dictionary being written, kept in a slice so the output order is stable.
+type variantItem struct {
+	key   string
+	value any
+}
+
+func readVariantDictionary(data []byte) (variantDictionary, error) {
+	if len(data) < 2 || binary.LittleEndian.Uint16(data[0:2])>>8 != VARIANT_DICTIONARY_VERSION>>8 {
+		return nil, ErrCorrupted
+	}
+
+	dict := variantDictionary{}
+	offset := 2
+	for {
+		if offset >= len(data) {
+			return nil, ErrCorrupted
+		}
+		valueType := data[offset]
+		offset++
+		if valueType == variantEnd {
+			return dict, nil
+		}
+
+		if offset+4 > len(data) {
+			return nil, ErrCorrupted
+		}
+		keyLen := int(int32(binary.LittleEndian.Uint32(data[offset : offset+4])))
+		offset += 4
+		if keyLen < 0 || offset+keyLen+4 > len(data) {
+			return nil, ErrCorrupted
+		}
+		key := string(data[offset : offset+keyLen])
+		offset += keyLen
+
+		valueLen := int(int32(binary.LittleEndian.Uint32(data[offset : offset+4])))
+		offset += 4
+		if valueLen < 0 || offset+valueLen > len(data) {
+			return nil, ErrCorrupted
+		}
+		value := data[offset : offset+valueLen]
+		offset += valueLen
+
+		switch {
+		case (valueType == variantUInt32 || valueType == variantInt32) && valueLen == 4:
+			if valueType == variantUInt32 {
+				dict[key] = binary.LittleEndian.Uint32(value)
+			} else {
+				dict[key] = int32(binary.LittleEndian.Uint32(value))
+			}
+		case (valueType == variantUInt64 || valueType == variantInt64) && valueLen == 8:
+			if valueType == variantUInt64 {
+				dict[key] = binary.LittleEndian.Uint64(value)
+			} else {
+				dict[key] = int64(binary.LittleEndian.Uint64(value))
+			}
+		case valueType == variantBool && valueLen == 1:
+			dict[key] = value[0] != 0
+		case valueType == variantString:
+			dict[key] = string(value)
+		case valueType == variantByteArray:
+			dict[key] = bytes.Clone(value)
+		default:
+			return nil, ErrCorrupted
+		}
+	}
+}
+
+func writeVariantDictionary(items []variantItem) []byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, VARIANT_DICTIONARY_VERSION)
+
+	for _, item := range items {
+		var valueType byte
+		var value []byte
+		switch v := item.value.(type) {
+		case uint32:
+			valueType, value = variantUInt32, binary.LittleEndian.AppendUint32(nil, v)
+		case uint64:
+			valueType, value = variantUInt64, binary.LittleEndian.AppendUint64(nil, v)
+		case bool:
+			valueType, value = variantBool, []byte{0}
+			if v {
+				value[0] = 1
+			}
+		case int32:
+			valueType, value = variantInt32, binary.LittleEndian.AppendUint32(nil, uint32(v))
+		case int64:
+			valueType, value = variantInt64, binary.LittleEndian.AppendUint64(nil, uint64(v))
+		case string:
+			valueType, value = variantString, []byte(v)
+		case []byte:
+			valueType, value = variantByteArray, v
+		default:
+			panic("kdbx: unsupported variant dictionary value type")
+		}
+
+		buffer.WriteByte(valueType)
+		binary.Write(&buffer, binary.LittleEndian, int32(len(item.key)))
+		buffer.WriteString(item.key)
+		binary.Write(&buffer, binary.LittleEndian, int32(len(value)))
+		buffer.Write(value)
+	}
+
+	buffer.WriteByte(variantEnd)
+	return buffer.Bytes()
+}
@@ -0,0 +1,128 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"passwordManager/internal/userType"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	//argon2id parameters of written databases, in the range keepassxc picks for a one second unlock
+	EXPORT_ARGON_ITERATIONS = 3
+	EXPORT_ARGON_MEMORY     = 64 * 1024 * 1024
+	EXPORT_ARGON_THREADS    = 4
+)
+
+func randomBytes(length int) []byte {
+	buffer := make([]byte, length)
+	if _, err := rand.Read(buffer); err != nil {
+		panic("kdbx: random reading failed")
+	}
+	return buffer
+}
+
+func writeHeaderField(buffer *bytes.Buffer, id byte, value []byte) {
+	buffer.WriteByte(id)
+	binary.Write(buffer, binary.LittleEndian, uint32(len(value)))
+	buffer.Write(value)
+}
+
+func writeInnerHeaderField(buffer *bytes.Buffer, id byte, value []byte) {
+	buffer.WriteByte(id)
+	binary.Write(buffer, binary.LittleEndian, int32(len(value)))
+	buffer.Write(value)
+}
+
+func Write(writer io.Writer, password string, databaseName string, entries []userType.VaultEntry) error {
+	//writes the entries as a KDBX 4 database protected by the password, using Argon2id, ChaCha20 and gzip
+	//folders become nested groups below the root group
+	masterSeed := randomBytes(32)
+	encryptionIV := randomBytes(12)
+	kdfSalt := randomBytes(32)
+	streamKey := randomBytes(64)
+
+	kdfParameters := writeVariantDictionary([]variantItem{
+		{"$UUID", KDF_ARGON2ID},
+		{"S", kdfSalt},
+		{"P", uint32(EXPORT_ARGON_THREADS)},
+		{"M", uint64(EXPORT_ARGON_MEMORY)},
+		{"I", uint64(EXPORT_ARGON_ITERATIONS)},
+		{"V", uint32(ARGON2_VERSION_13)},
+	})
+
+	var header bytes.Buffer
+	binary.Write(&header, binary.LittleEndian, SIGNATURE_1)
+	binary.Write(&header, binary.LittleEndian, SIGNATURE_2)
+	binary.Write(&header, binary.LittleEndian, FILE_VERSION_4)
+	writeHeaderField(&header, HEADER_CIPHER_ID, CIPHER_CHACHA20)
+	writeHeaderField(&header, HEADER_COMPRESSION, binary.LittleEndian.AppendUint32(nil, COMPRESSION_GZIP))
+	writeHeaderField(&header, HEADER_MASTER_SEED, masterSeed)
+	writeHeaderField(&header, HEADER_ENCRYPTION_IV, encryptionIV)
+	writeHeaderField(&header, HEADER_KDF_PARAMETERS, kdfParameters)
+	writeHeaderField(&header, HEADER_END, []byte("\r\n\r\n"))
+
+	transformedKey := argon2.IDKey(compositeKey(password), kdfSalt, EXPORT_ARGON_ITERATIONS, EXPORT_ARGON_MEMORY/1024, EXPORT_ARGON_THREADS, 32)
+	encryptionKey, hmacKey := deriveKeys(masterSeed, transformedKey)
+
+	innerStreamCipher, err := newInnerStream(INNER_STREAM_CHACHA20, streamKey)
+	if err != nil {
+		return err
+	}
+	builder := documentBuilder{stream: innerStreamCipher, now: kdbxTime(time.Now()), random: randomBytes}
+	document, err := builder.build(databaseName, entries)
+	if err != nil {
+		return err
+	}
+
+	var payload bytes.Buffer
+	gzipWriter := gzip.NewWriter(&payload)
+	var innerHeader bytes.Buffer
+	writeInnerHeaderField(&innerHeader, INNER_HEADER_STREAM_ID, binary.LittleEndian.AppendUint32(nil, INNER_STREAM_CHACHA20))
+	writeInnerHeaderField(&innerHeader, INNER_HEADER_STREAM_KEY, streamKey)
+	writeInnerHeaderField(&innerHeader, INNER_HEADER_END, nil)
+	gzipWriter.Write(innerHeader.Bytes())
+	gzipWriter.Write(document)
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+
+	stream, err := chacha20.NewUnauthenticatedCipher(encryptionKey, encryptionIV)
+	if err != nil {
+		return err
+	}
+	ciphertext := payload.Bytes()
+	stream.XORKeyStream(ciphertext, ciphertext)
+
+	var out bytes.Buffer
+	out.Write(header.Bytes())
+	headerHash := sha256.Sum256(header.Bytes())
+	out.Write(headerHash[:])
+	out.Write(headerHMAC(hmacKey, header.Bytes()))
+
+	//the block stream ends with an empty block
+	index := uint64(0)
+	for {
+		size := min(len(ciphertext), HMAC_BLOCK_SIZE)
+		block := ciphertext[:size]
+		ciphertext = ciphertext[size:]
+
+		out.Write(blockHMAC(hmacKey, index, block))
+		binary.Write(&out, binary.LittleEndian, int32(size))
+		out.Write(block)
+		index++
+		if size == 0 {
+			break
+		}
+	}
+
+	_, err = writer.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"passwordManager/internal/backend/kdbx"
+	"passwordManager/internal/userType"
+)
+
+func IsKDBX(data []byte) bool {
+	return kdbx.HasSignature(data)
+}
+
+func ParseKDBX(reader io.Reader, passphrase string) ([]userType.VaultEntry, error) {
+	//decrypts a keepass KDBX 4 database, the entries can then be passed to ImportUserAccounts
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase of the keepass database cannot be empty")
+	}
+
+	entries, err := kdbx.Read(reader, passphrase)
+	if err != nil {
+		logger.Error("keepass database import failed:", "error", err)
+		return nil, err
+	}
+
+	for i := range entries {
+		if len(entries[i].Name) == 0 {
+			entries[i].Name = nameFromURL(entries[i].URL)
+		}
+	}
+	return entries, nil
+}
+
+func ExportUserAccountsKDBX(user userType.User, writer io.Writer, passphrase string, masterKey []byte) (int, error) {
+	//writes every entry of the user into a keepass KDBX 4 database protected by the passphrase
+	//returns the number of exported entries, or a possible error
+	if len(passphrase) == 0 {
+		return 0, fmt.Errorf("passphrase of the keepass database cannot be empty")
+	}
+
+	entries, err := ExportUserAccounts(user, masterKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := kdbx.Write(writer, passphrase, user.Name, entries); err != nil {
+		logger.Error("keepass database export failed:", "error", err)
+		return 0, fmt.Errorf("internal error when writing the keepass database")
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+)
+
+// A user can require a key file next to their master password, its hash is mixed into the key derivation.
+// Only a flag is stored, a wrong key file looks exactly like a wrong master password.
+// Setting or removing the key file rewraps the vault key, entries stay encrypted as they are.
+
+var (
+	ErrKeyFileRequired   = errors.New("this user needs a key file to log in, pass it with --keyfile")
+	ErrKeyFileNotUsed    = errors.New("this user does not use a key file")
+	ErrKeyFileUnreadable = errors.New("key file couldnt be read")
+)
+
+func userKeyFileHash(user userType.User, keyFile string) ([]byte, error) {
+	//returns the hash of the key file to derive the master key of the user with, nil for users without one
+	if !user.UsesKeyFile {
+		if len(keyFile) != 0 {
+			return nil, ErrKeyFileNotUsed
+		}
+		return nil, nil
+	}
+	if len(keyFile) == 0 {
+		return nil, ErrKeyFileRequired
+	}
+	hash, err := crypto.HashKeyFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyFileUnreadable, err)
+	}
+	return hash, nil
+}
+
+func GenerateKeyFile(path string) error {
+	//writes a new random key file at path, failing if the file exists
+	if len(path) == 0 {
+		return fmt.Errorf("key file path cannot be empty")
+	}
+	if err := crypto.GenerateKeyFile(path); err != nil {
+		logger.Error("key file generation failed:", "error", err)
+		return err
+	}
+	logger.Info("Key file generated", "path", path)
+	return nil
+}
+
+func SetKeyFile(user userType.User, masterPassword string, currentKeyFile string, newKeyFile string, vaultKey []byte) (userType.User, error) {
+	//makes newKeyFile required to unlock the vault of the user, an empty newKeyFile removes the requirement
+	//returns the updated user, the master password and current key file are asked again
+	if _, _, err := authenticateUser(user.Name, masterPassword, currentKeyFile); err != nil {
+		return userType.User{}, err
+	}
+
+	var keyFileHash []byte
+	if len(newKeyFile) != 0 {
+		hash, err := crypto.HashKeyFile(newKeyFile)
+		if err != nil {
+			return userType.User{}, fmt.Errorf("%w: %w", ErrKeyFileUnreadable, err)
+		}
+		keyFileHash = hash
+		defer clear(keyFileHash)
+	}
+
+	//a fresh salt, so the previous master key hash says nothing about the new one
+	salt := []byte(crypto.GenerateRandomString(SALT_SIZE))
+	masterKey, err := crypto.GenkeyWithKeyFile([]byte(masterPassword), keyFileHash, salt)
+	if err != nil {
+		logger.Error("setting key file failed:", "error", err)
+		return userType.User{}, fmt.Errorf("internal error, try again later")
+	}
+	defer clear(masterKey)
+	hashedKey, err := crypto.HashPassword(masterKey)
+	if err != nil {
+		logger.Error("setting key file failed:", "error", err)
+		return userType.User{}, fmt.Errorf("internal error, try again later")
+	}
+	//legacy users get their vault key wrapped here, it stays the key their entries are encrypted with
+	wrappedVaultKey, err := crypto.EncryptPassword(vaultKey, masterKey)
+	if err != nil {
+		logger.Error("error in encrypting vault key:", "error", err)
+		return userType.User{}, fmt.Errorf("internal error, try again later")
+	}
+
+	usesKeyFile := len(keyFileHash) != 0
+	if err := dbInterface.UpdateUserCredentials(user.Uid, salt, hashedKey, wrappedVaultKey, usesKeyFile); err != nil {
+		logger.Error("db error:", "error", err)
+		return userType.User{}, fmt.Errorf("internal error, try again later")
+	}
+
+	user.Salt, user.MasterKeyHash, user.WrappedVaultKey, user.UsesKeyFile = salt, hashedKey, wrappedVaultKey, usesKeyFile
+	logger.Info("Key file requirement changed", "username", user.Name, "uses_key_file", usesKeyFile)
+	return user, nil
+}
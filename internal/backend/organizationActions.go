@@ -0,0 +1,586 @@
+package backend
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+)
+
+// Organizations are shared vaults. Every member holds the key of every collection, sealed to their public key,
+// so any member can read; writing entries and managing members and collections depend on the role of the member.
+// Removing a member replaces the keys of all collections, a copy of an old key no longer opens anything.
+
+const (
+	ROLE_READ   = "read"
+	ROLE_WRITE  = "write"
+	ROLE_MANAGE = "manage"
+)
+
+var roleRank = map[string]int{ROLE_READ: 1, ROLE_WRITE: 2, ROLE_MANAGE: 3}
+
+var (
+	ErrInvalidRole             = errors.New("role must be one of: read, write, manage")
+	ErrOrganizationNotFound    = errors.New("given organization couldnt be found")
+	ErrOrganizationExists      = errors.New("an organization with this name already exists")
+	ErrPermissionDenied        = errors.New("your role in this organization does not allow this")
+	ErrMemberNotFound          = errors.New("given user is not a member of this organization")
+	ErrMemberExists            = errors.New("given user is already a member of this organization, use setrole to change their role")
+	ErrLastManager             = errors.New("an organization needs at least one member with the manage role")
+	ErrCollectionNotFound      = errors.New("given collection couldnt be found")
+	ErrCollectionExists        = errors.New("a collection with this name already exists in the organization")
+	ErrCollectionEntryNotFound = errors.New("given account couldnt be found in the collection")
+	ErrCollectionEntryExists   = errors.New("an account with this name already exists in the collection")
+)
+
+func requireRole(user userType.User, organization string, minimum string) (int64, error) {
+	//returns the id of the organization if the user is a member with at least the given role
+	orgId, err := dbInterface.FetchOrganizationId(organization)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthOrganizationName):
+			return 0, err
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrOrganizationNotFound
+		default:
+			logger.Error("db error:", "error", err)
+			return 0, fmt.Errorf("internal error, try again later")
+		}
+	}
+	role, err := dbInterface.FetchMemberRole(orgId, user.Uid)
+	if err != nil {
+		//outsiders are told the organization does not exist rather than that it does
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrOrganizationNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return 0, fmt.Errorf("internal error, try again later")
+	}
+	if roleRank[role] < roleRank[minimum] {
+		return 0, ErrPermissionDenied
+	}
+	return orgId, nil
+}
+
+func collectionKey(user userType.User, orgId int64, collection string, masterKey []byte) (int64, []byte, error) {
+	//returns the id and the key of the collection as held by the user
+	collectionId, wrappedKey, err := dbInterface.FetchCollectionKey(orgId, collection, user.Uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthCollectionName):
+			return 0, nil, err
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, nil, ErrCollectionNotFound
+		default:
+			logger.Error("db error:", "error", err)
+			return 0, nil, fmt.Errorf("internal error, try again later")
+		}
+	}
+	privateKey, err := userPrivateKey(user, masterKey)
+	if err != nil {
+		logger.Error("user private key decryption failed:", "error", err)
+		return 0, nil, fmt.Errorf("internal error, try again later")
+	}
+	defer clear(privateKey)
+	key, err := crypto.OpenSealed(wrappedKey, privateKey)
+	if err != nil {
+		logger.Error("collection key unwrapping failed:", "error", err)
+		return 0, nil, fmt.Errorf("internal error, try again later")
+	}
+	return collectionId, key, nil
+}
+
+func CreateOrganization(user userType.User, organization string) (string, error) {
+	//creates the organization with the user as its manager
+	name, err := dbInterface.InsertOrganization(organization, user.Uid, ROLE_MANAGE)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthOrganizationName):
+			return "", err
+		case dbInterface.IsUniqueViolation(err):
+			return "", ErrOrganizationExists
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+	logger.Info("Organization created", "username", user.Name, "organization", name)
+	return name, nil
+}
+
+func GetOrganizations(user userType.User) ([]userType.OrganizationMembership, error) {
+	records, err := dbInterface.FetchUserOrganizations(user.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+	organizations := make([]userType.OrganizationMembership, 0, len(records))
+	for _, record := range records {
+		organizations = append(organizations, userType.OrganizationMembership{Name: record.Name, Role: record.Role})
+	}
+	return organizations, nil
+}
+
+func GetOrgMembers(user userType.User, organization string) ([]userType.OrgMember, error) {
+	//returns the members of the organization, any member may list them
+	orgId, err := requireRole(user, organization, ROLE_READ)
+	if err != nil {
+		return nil, err
+	}
+	records, err := dbInterface.FetchOrgMembers(orgId)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+	members := make([]userType.OrgMember, 0, len(records))
+	for _, record := range records {
+		members = append(members, userType.OrgMember{Username: record.Username, Role: record.Role})
+	}
+	return members, nil
+}
+
+func AddOrgMember(user userType.User, organization string, member string, role string, masterKey []byte) (string, error) {
+	//adds the user to the organization with the given role, sealing every collection key to them
+	//returns the fingerprint of the public key of the new member, or a possible error
+	if _, ok := roleRank[role]; !ok {
+		return "", ErrInvalidRole
+	}
+	orgId, err := requireRole(user, organization, ROLE_MANAGE)
+	if err != nil {
+		return "", err
+	}
+	memberId, memberKey, err := dbInterface.FetchPublicKey(member)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthUsername):
+			return "", err
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecipientNotFound
+		case errors.Is(err, dbInterface.ErrNoUserKeys):
+			return "", ErrRecipientHasNoKeys
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+	if _, err := dbInterface.FetchMemberRole(orgId, memberId); err == nil {
+		return "", ErrMemberExists
+	}
+
+	keys, err := dbInterface.FetchOrgCollectionKeys(orgId, user.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	privateKey, err := userPrivateKey(user, masterKey)
+	if err != nil {
+		logger.Error("user private key decryption failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	defer clear(privateKey)
+
+	wrappedKeys := make(map[int64][]byte, len(keys))
+	for _, key := range keys {
+		collectionKey, err := crypto.OpenSealed(key.WrappedKey, privateKey)
+		if err != nil {
+			logger.Error("collection key unwrapping failed:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+		wrappedKey, err := crypto.SealToPublicKey(collectionKey, memberKey)
+		clear(collectionKey)
+		if err != nil {
+			logger.Error("sealing collection key failed:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+		wrappedKeys[key.CollectionId] = wrappedKey
+	}
+
+	if err := dbInterface.InsertOrgMember(orgId, memberId, role, wrappedKeys); err != nil {
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Organization member added", "username", user.Name, "organization", organization, "member", member, "role", role)
+	return crypto.KeyFingerprint(memberKey), nil
+}
+
+func SetOrgMemberRole(user userType.User, organization string, member string, role string) error {
+	if _, ok := roleRank[role]; !ok {
+		return ErrInvalidRole
+	}
+	orgId, err := requireRole(user, organization, ROLE_MANAGE)
+	if err != nil {
+		return err
+	}
+	memberId, err := orgMemberId(orgId, member)
+	if err != nil {
+		return err
+	}
+	if role != ROLE_MANAGE {
+		if err := keepOneManager(orgId, memberId); err != nil {
+			return err
+		}
+	}
+
+	if err := dbInterface.UpdateOrgMemberRole(orgId, memberId, role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMemberNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Organization member role changed", "username", user.Name, "organization", organization, "member", member, "role", role)
+	return nil
+}
+
+func orgMemberId(orgId int64, member string) (int64, error) {
+	memberId, _, err := dbInterface.FetchPublicKey(member)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, dbInterface.ErrNoUserKeys) || errors.Is(err, dbInterface.Err0LengthUsername) {
+			return 0, ErrMemberNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return 0, fmt.Errorf("internal error, try again later")
+	}
+	return memberId, nil
+}
+
+func keepOneManager(orgId int64, memberId int64) error {
+	//returns ErrLastManager if the member is the only manager left
+	role, err := dbInterface.FetchMemberRole(orgId, memberId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMemberNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	if role != ROLE_MANAGE {
+		return nil
+	}
+	managers, err := dbInterface.CountOrgManagers(orgId)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	if managers <= 1 {
+		return ErrLastManager
+	}
+	return nil
+}
+
+func RemoveOrgMember(user userType.User, organization string, member string, masterKey []byte) error {
+	//removes the member from the organization, managers remove anyone and every member may leave
+	//the collections get new keys afterwards, sealed to the remaining members
+	minimum := ROLE_MANAGE
+	if member == user.Name {
+		minimum = ROLE_READ
+	}
+	orgId, err := requireRole(user, organization, minimum)
+	if err != nil {
+		return err
+	}
+	memberId, err := orgMemberId(orgId, member)
+	if err != nil {
+		return err
+	}
+	if err := keepOneManager(orgId, memberId); err != nil {
+		return err
+	}
+
+	//the keys are read before the removal, a member leaving has no key left afterwards to rotate with
+	collections, err := dbInterface.FetchCollections(orgId)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	members, err := dbInterface.FetchOrgMembers(orgId)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	remaining := make([]dbInterface.OrgMemberRecord, 0, len(members))
+	for _, record := range members {
+		if record.UserId != memberId {
+			remaining = append(remaining, record)
+		}
+	}
+
+	//every collection is rekeyed together with the removal, so a failure leaves none under the old key
+	rekeys := make([]dbInterface.CollectionRekey, 0, len(collections))
+	for _, collection := range collections {
+		_, oldKey, err := collectionKey(user, orgId, collection.Name, masterKey)
+		if err != nil {
+			return err
+		}
+		rekey, err := rekeyCollection(collection.Id, oldKey, remaining)
+		clear(oldKey)
+		if err != nil {
+			logger.Error("rekeying collection failed:", "error", err)
+			return fmt.Errorf("internal error, try again later")
+		}
+		rekeys = append(rekeys, rekey)
+	}
+
+	if err := dbInterface.DeleteOrgMember(orgId, memberId, rekeys); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMemberNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Organization member removed", "username", user.Name, "organization", organization, "member", member)
+	return nil
+}
+
+func rekeyCollection(collectionId int64, oldKey []byte, members []dbInterface.OrgMemberRecord) (dbInterface.CollectionRekey, error) {
+	//returns the entries of the collection and its member keys under a new collection key
+	newKey, err := crypto.GenerateSymmetricKey()
+	if err != nil {
+		return dbInterface.CollectionRekey{}, err
+	}
+	defer clear(newKey)
+
+	entries, err := dbInterface.FetchCollectionEntries(collectionId)
+	if err != nil {
+		return dbInterface.CollectionRekey{}, err
+	}
+	for i, entry := range entries {
+		decrypted, err := crypto.DecryptPassword(entry.EncryptedData, oldKey)
+		if err != nil {
+			return dbInterface.CollectionRekey{}, err
+		}
+		entries[i].EncryptedData, err = crypto.EncryptPassword(decrypted, newKey)
+		clear(decrypted)
+		if err != nil {
+			return dbInterface.CollectionRekey{}, err
+		}
+	}
+	wrappedKeys := make(map[int64][]byte, len(members))
+	for _, member := range members {
+		wrappedKey, err := crypto.SealToPublicKey(newKey, member.PublicKey)
+		if err != nil {
+			return dbInterface.CollectionRekey{}, err
+		}
+		wrappedKeys[member.UserId] = wrappedKey
+	}
+	return dbInterface.CollectionRekey{CollectionId: collectionId, Entries: entries, WrappedKeys: wrappedKeys}, nil
+}
+
+func CreateCollection(user userType.User, organization string, collection string) (string, error) {
+	//creates the collection with a new key sealed to every member of the organization
+	orgId, err := requireRole(user, organization, ROLE_MANAGE)
+	if err != nil {
+		return "", err
+	}
+	members, err := dbInterface.FetchOrgMembers(orgId)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+
+	key, err := crypto.GenerateSymmetricKey()
+	if err != nil {
+		logger.Error("collection key generation failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	defer clear(key)
+	wrappedKeys := make(map[int64][]byte, len(members))
+	for _, member := range members {
+		wrappedKey, err := crypto.SealToPublicKey(key, member.PublicKey)
+		if err != nil {
+			logger.Error("sealing collection key failed:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+		wrappedKeys[member.UserId] = wrappedKey
+	}
+
+	name, err := dbInterface.InsertCollection(orgId, collection, wrappedKeys)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthCollectionName):
+			return "", err
+		case dbInterface.IsUniqueViolation(err):
+			return "", ErrCollectionExists
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+	logger.Info("Collection created", "username", user.Name, "organization", organization, "collection", name)
+	return name, nil
+}
+
+func GetCollections(user userType.User, organization string) ([]userType.CollectionSummary, error) {
+	orgId, err := requireRole(user, organization, ROLE_READ)
+	if err != nil {
+		return nil, err
+	}
+	records, err := dbInterface.FetchCollections(orgId)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+	collections := make([]userType.CollectionSummary, 0, len(records))
+	for _, record := range records {
+		collections = append(collections, userType.CollectionSummary{Name: record.Name, Entries: record.Entries})
+	}
+	return collections, nil
+}
+
+func MoveAccountToCollection(user userType.User, accountName string, organization string, collection string, masterKey []byte) (string, error) {
+	//moves the entry out of the personal vault of the user into the collection
+	orgId, err := requireRole(user, organization, ROLE_WRITE)
+	if err != nil {
+		return "", err
+	}
+	collectionId, key, err := collectionKey(user, orgId, collection, masterKey)
+	if err != nil {
+		return "", err
+	}
+	defer clear(key)
+
+	if _, err := dbInterface.FetchCollectionEntry(collectionId, accountName); err == nil {
+		return "", ErrCollectionEntryExists
+	}
+	encryptedData, err := encryptCollectionPayload(user, accountName, masterKey, key)
+	if err != nil {
+		return "", err
+	}
+	if err := dbInterface.MoveEntryToCollection(user.Uid, accountName, collectionId, encryptedData); err != nil {
+		if dbInterface.IsUniqueViolation(err) {
+			return "", ErrCollectionEntryExists
+		}
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Account moved to collection", "username", user.Name, "organization", organization, "collection", collection)
+	return accountName, nil
+}
+
+func encryptCollectionPayload(user userType.User, accountName string, masterKey []byte, collectionKey []byte) ([]byte, error) {
+	//the collection copy replaces the personal entry, so unlike a share it also carries its otp secret, folder and tags
+	username, password, err := GetUserAccount(user, accountName, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := GetEntryFields(user, accountName, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	records, err := dbInterface.FetchUserEntryRecords(user.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+
+	entry := entryPayload{Username: username, Password: password, Fields: fields}
+	for _, record := range records {
+		if record.Name != accountName {
+			continue
+		}
+		entry.Folder, entry.Tags = record.Folder, record.Tags
+		if entry.OTP, err = decryptOTPRecord(record, masterKey); err != nil {
+			logger.Error("otp secret decryption failed:", "error", err)
+			return nil, fmt.Errorf("internal error, try again later")
+		}
+		break
+	}
+
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(payload)
+	return crypto.EncryptPassword(payload, collectionKey)
+}
+
+func collectionEntry(name string, payload entryPayload) userType.CollectionEntry {
+	return userType.CollectionEntry{Name: name, Username: payload.Username, Password: payload.Password, Fields: payload.Fields, OTP: payload.OTP, Folder: payload.Folder, Tags: payload.Tags}
+}
+
+func GetCollectionAccounts(user userType.User, organization string, collection string, masterKey []byte) ([]userType.CollectionEntry, error) {
+	orgId, err := requireRole(user, organization, ROLE_READ)
+	if err != nil {
+		return nil, err
+	}
+	collectionId, key, err := collectionKey(user, orgId, collection, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+
+	records, err := dbInterface.FetchCollectionEntries(collectionId)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+	entries := make([]userType.CollectionEntry, 0, len(records))
+	for _, record := range records {
+		payload, err := decryptEntryPayload(record.EncryptedData, key)
+		if err != nil {
+			logger.Error("collection entry decryption failed:", "error", err, "name", record.Name)
+			continue
+		}
+		entries = append(entries, collectionEntry(record.Name, payload))
+	}
+	return entries, nil
+}
+
+func GetCollectionAccount(user userType.User, organization string, collection string, accountName string, masterKey []byte) (userType.CollectionEntry, error) {
+	orgId, err := requireRole(user, organization, ROLE_READ)
+	if err != nil {
+		return userType.CollectionEntry{}, err
+	}
+	collectionId, key, err := collectionKey(user, orgId, collection, masterKey)
+	if err != nil {
+		return userType.CollectionEntry{}, err
+	}
+	defer clear(key)
+
+	encryptedData, err := dbInterface.FetchCollectionEntry(collectionId, accountName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return userType.CollectionEntry{}, ErrCollectionEntryNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return userType.CollectionEntry{}, fmt.Errorf("internal error, try again later")
+	}
+	payload, err := decryptEntryPayload(encryptedData, key)
+	if err != nil {
+		logger.Error("collection entry decryption failed:", "error", err)
+		return userType.CollectionEntry{}, fmt.Errorf("internal error when retrieving password")
+	}
+	return collectionEntry(accountName, payload), nil
+}
+
+func RemoveCollectionAccount(user userType.User, organization string, collection string, accountName string) (string, error) {
+	orgId, err := requireRole(user, organization, ROLE_WRITE)
+	if err != nil {
+		return "", err
+	}
+	collectionId, _, err := dbInterface.FetchCollectionKey(orgId, collection, user.Uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthCollectionName):
+			return "", err
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrCollectionNotFound
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	name, err := dbInterface.DeleteCollectionEntry(collectionId, accountName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrCollectionEntryNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	return name, nil
+}
@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"strings"
+)
+
+var (
+	ErrInvalidFolderPath = errors.New("folder path segments cannot be empty, . or ..")
+	ErrInvalidTagName    = errors.New("tag names cannot contain commas or whitespace")
+)
+
+func normalizeFolderPath(folderPath string) (string, error) {
+	//trims surrounding separators, so "/work/aws/" and "work/aws" are the same folder
+	//an empty result means the root, which is not a folder of its own
+	trimmed := strings.Trim(strings.TrimSpace(folderPath), dbInterface.FOLDER_SEPARATOR)
+	if len(trimmed) == 0 {
+		return "", nil
+	}
+
+	//. and .. would climb out of the directory a folder becomes in a file based export
+	for _, segment := range strings.Split(trimmed, dbInterface.FOLDER_SEPARATOR) {
+		segment = strings.TrimSpace(segment)
+		if len(segment) == 0 || segment == "." || segment == ".." {
+			return "", ErrInvalidFolderPath
+		}
+	}
+	return trimmed, nil
+}
+
+func validateTagName(tagName string) error {
+	//tags are stored comma joined when listing, so commas cannot be part of a tag
+	if strings.ContainsAny(tagName, ", \t\n") {
+		return ErrInvalidTagName
+	}
+	return nil
+}
+
+func CreateFolder(user userType.User, folderPath string) (string, error) {
+	//returns the normalized path of the created folder, or a possible error
+	path, err := normalizeFolderPath(folderPath)
+	if err != nil {
+		return "", err
+	}
+
+	folder, err := dbInterface.InsertFolder(user.Uid, path)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthFolderPath:
+			logger.Error("Create folder failed:", "error", err)
+			return "", err
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return folder, nil
+}
+
+func MoveUserAccount(user userType.User, accountName string, folderPath string) (string, error) {
+	//moves the account into the folder, an empty or "/" path moves it back to the root
+	//returns the normalized folder path the account was moved to, or a possible error
+	path, err := normalizeFolderPath(folderPath)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = dbInterface.UpdateEntryFolder(user.Uid, accountName, path)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname:
+			logger.Error("Move user acc failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			logger.Error("user account name not found:", "error", err)
+			return "", fmt.Errorf("given account name couldnt be found")
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return path, nil
+}
+
+func RemoveFolder(user userType.User, folderPath string) (string, error) {
+	//removes the folder and its subfolders, the accounts inside are moved back to the root
+	path, err := normalizeFolderPath(folderPath)
+	if err != nil {
+		return "", err
+	}
+
+	folder, err := dbInterface.DeleteFolder(user.Uid, path)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthFolderPath:
+			logger.Error("Remove folder failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			logger.Error("folder not found:", "error", err)
+			return "", fmt.Errorf("given folder couldnt be found")
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return folder, nil
+}
+
+func GetFolders(user userType.User) ([]string, error) {
+	folders, err := dbInterface.FetchFolders(user.Uid)
+	if err != nil {
+		logger.Error("error in retrieving folders:", "error", err)
+		return nil, fmt.Errorf("internal error in retrieving folders")
+	}
+	return folders, nil
+}
+
+func TagUserAccount(user userType.User, accountName string, tagName string) (string, error) {
+	if err := validateTagName(tagName); err != nil {
+		return "", err
+	}
+
+	tag, err := dbInterface.InsertEntryTag(user.Uid, accountName, tagName)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname, dbInterface.Err0LengthTagName:
+			logger.Error("Tag user acc failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			logger.Error("user account name not found:", "error", err)
+			return "", fmt.Errorf("given account name couldnt be found")
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return tag, nil
+}
+
+func UntagUserAccount(user userType.User, accountName string, tagName string) (string, error) {
+	tag, err := dbInterface.DeleteEntryTag(user.Uid, accountName, tagName)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname, dbInterface.Err0LengthTagName:
+			logger.Error("Untag user acc failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			logger.Error("user account tag not found:", "error", err)
+			return "", fmt.Errorf("given account doesnt have this tag")
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return tag, nil
+}
+
+func GetUserAccountSummaries(user userType.User, folderPath string, tagNames []string) ([]userType.AccountSummary, error) {
+	//returns the accounts in the folder (and its subfolders) carrying every given tag
+	//an empty folder path and no tags returns every account of the user
+	path, err := normalizeFolderPath(folderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries, err := dbInterface.FetchAccountSummaries(user.Uid, path, tagNames)
+	if err != nil {
+		logger.Error("error in retrieving user account summaries:", "error", err)
+		return nil, fmt.Errorf("internal error in retrieving user accounts")
+	}
+	return summaries, nil
+}
@@ -0,0 +1,170 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+var ErrInvalidOrigin = errors.New("origin must be an https url, or http on a loopback host")
+
+type siteAddress struct {
+	host string
+	// site is the registrable domain of the host (eTLD+1), so login.example.co.uk and www.example.co.uk share example.co.uk
+	site string
+}
+
+func parseSiteAddress(rawURL string) (siteAddress, bool) {
+	//returns the host and site of a stored url or bare domain, false when it does not name a web site
+	if !strings.Contains(rawURL, "://") {
+		if strings.ContainsAny(rawURL, " /\t") || !strings.Contains(rawURL, ".") {
+			return siteAddress{}, false
+		}
+		rawURL = "https://" + rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || len(parsed.Hostname()) == 0 {
+		return siteAddress{}, false
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if host == "localhost" || net.ParseIP(host) != nil {
+		return siteAddress{host: host, site: host}, true
+	}
+	site, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		//the host is a public suffix itself, like github.io, it only matches itself
+		site = host
+	}
+	return siteAddress{host: host, site: site}, true
+}
+
+func parseOrigin(origin string) (siteAddress, error) {
+	//origins come from the browser, plain http is only trusted on the local machine
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return siteAddress{}, ErrInvalidOrigin
+	}
+	address, ok := parseSiteAddress(origin)
+	if !ok || !strings.Contains(origin, "://") {
+		return siteAddress{}, ErrInvalidOrigin
+	}
+	if parsed.Scheme == "http" && address.host != "localhost" && !net.ParseIP(address.host).IsLoopback() {
+		return siteAddress{}, ErrInvalidOrigin
+	}
+	return address, nil
+}
+
+func MatchAccountsByOrigin(user userType.User, origin string, masterKey []byte) ([]userType.OriginMatch, error) {
+	//returns the accounts stored for the site of the origin, with their passwords
+	//an account belongs to a site through its url fields, or through its name when that is a domain or url
+	//accounts for the exact host come first
+	address, err := parseOrigin(origin)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := dbInterface.FetchUserEntryRecords(user.Uid)
+	if err != nil {
+		logger.Error("error in retrieving user accounts:", "error", err)
+		return nil, fmt.Errorf("internal error in retrieving user accounts")
+	}
+
+	matches := make([]userType.OriginMatch, 0)
+	for _, record := range records {
+		candidates := []string{record.Name}
+		for _, field := range record.Fields {
+			if userType.FieldType(field.FieldType) != userType.FieldURL {
+				continue
+			}
+			value, err := crypto.DecryptPassword(field.EncryptedData, masterKey)
+			if err != nil {
+				logger.Error("entry field decryption failed:", "error", err)
+				return nil, fmt.Errorf("internal error when retrieving field")
+			}
+			candidates = append(candidates, string(value))
+		}
+
+		matched, exact := false, false
+		for _, candidate := range candidates {
+			stored, ok := parseSiteAddress(candidate)
+			if !ok || stored.site != address.site {
+				continue
+			}
+			matched = true
+			exact = exact || stored.host == address.host
+		}
+		if !matched {
+			continue
+		}
+
+		password, err := crypto.DecryptPassword(record.EncryptedData, masterKey)
+		if err != nil {
+			logger.Error("user account password decryption failed:", "error", err)
+			return nil, fmt.Errorf("internal error when retrieving password")
+		}
+		matches = append(matches, userType.OriginMatch{
+			Account:   userType.AccountSummary{Name: record.Name, Username: record.Username, Folder: record.Folder, Tags: record.Tags},
+			Password:  string(password),
+			ExactHost: exact,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].ExactHost && !matches[j].ExactHost })
+	return matches, nil
+}
+
+func SaveOriginLogin(user userType.User, origin string, username string, password string, masterKey []byte) (string, bool, error) {
+	//updates the password of the account stored for the origin under the same username, or adds an account for it
+	//returns the name of the account, whether it was added, or a possible error
+	if len(username) == 0 || len(password) == 0 {
+		return "", false, fmt.Errorf("username and password cannot be empty")
+	}
+	matches, err := MatchAccountsByOrigin(user, origin, masterKey)
+	if err != nil {
+		return "", false, err
+	}
+	for _, match := range matches {
+		if match.Account.Username != username {
+			continue
+		}
+		if match.Password == password {
+			return match.Account.Name, false, nil
+		}
+		acc, err := UpdateUserAccount(user, match.Account.Name, username, password, masterKey)
+		return acc, false, err
+	}
+
+	//new accounts are named after the host, the origin is kept as a url field so later lookups find them
+	address, _ := parseOrigin(origin)
+	existing, err := GetUserAccountNames(user)
+	if err != nil {
+		return "", false, err
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		taken[name] = true
+	}
+	name := address.host
+	for i := 2; taken[name]; i++ {
+		name = address.host + "-" + strconv.Itoa(i)
+	}
+
+	acc, _, err := AddUserAccount(user, name, username, password, masterKey)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := SetEntryField(user, acc, "url", string(userType.FieldURL), origin, masterKey); err != nil {
+		return "", false, err
+	}
+	return acc, true, nil
+}
@@ -0,0 +1,279 @@
+package backend
+
+import (
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/url"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OTP_KIND_TOTP  = "totp"
+	OTP_KIND_HOTP  = "hotp"
+	OTP_KIND_STEAM = "steam"
+
+	OTP_URI_SCHEME = "otpauth"
+)
+
+var (
+	ErrInvalidOTPSecret   = errors.New("otp secret must be base32 encoded or an otpauth:// uri")
+	ErrUnsupportedOTPKind = errors.New("otp type must be one of: totp, hotp, steam")
+)
+
+func decodeOTPSecret(secret string) ([]byte, error) {
+	//authenticator apps show base32 secrets in lowercase groups with spaces, and usually without padding
+	normalized := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	normalized = strings.TrimRight(normalized, "=")
+	if len(normalized) == 0 {
+		return nil, ErrInvalidOTPSecret
+	}
+
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+	if err != nil || len(decoded) == 0 {
+		return nil, ErrInvalidOTPSecret
+	}
+	return decoded, nil
+}
+
+func ParseOTPSecret(input string) (userType.OTPConfig, error) {
+	//accepts either a bare base32 secret, which gets the usual defaults, or a full otpauth:// uri
+	config := userType.OTPConfig{
+		Kind:      OTP_KIND_TOTP,
+		Algorithm: crypto.DEFAULT_OTP_ALGORITHM,
+		Digits:    crypto.DEFAULT_OTP_DIGITS,
+		Period:    crypto.DEFAULT_OTP_PERIOD,
+	}
+
+	if !strings.HasPrefix(strings.ToLower(input), OTP_URI_SCHEME+"://") {
+		config.Secret = input
+		return config, nil
+	}
+
+	parsed, err := url.Parse(input)
+	if err != nil {
+		return userType.OTPConfig{}, ErrInvalidOTPSecret
+	}
+
+	config.Kind = strings.ToLower(parsed.Host)
+	config.Label = strings.TrimPrefix(parsed.Path, "/")
+
+	params := parsed.Query()
+	config.Secret = params.Get("secret")
+	config.Issuer = params.Get("issuer")
+	if algorithm := params.Get("algorithm"); len(algorithm) != 0 {
+		config.Algorithm = strings.ToUpper(algorithm)
+	}
+	if digits := params.Get("digits"); len(digits) != 0 {
+		if config.Digits, err = strconv.Atoi(digits); err != nil {
+			return userType.OTPConfig{}, crypto.ErrInvalidOTPDigits
+		}
+	}
+	if period := params.Get("period"); len(period) != 0 {
+		if config.Period, err = strconv.Atoi(period); err != nil {
+			return userType.OTPConfig{}, crypto.ErrInvalidOTPPeriod
+		}
+	}
+	if counter := params.Get("counter"); len(counter) != 0 {
+		if config.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return userType.OTPConfig{}, fmt.Errorf("otp counter must be a non-negative number")
+		}
+	}
+	//steam secrets are exported as totp uris with a steam encoder by most apps
+	if strings.EqualFold(params.Get("encoder"), OTP_KIND_STEAM) {
+		config.Kind = OTP_KIND_STEAM
+	}
+
+	return config, nil
+}
+
+func otpConfigToURI(config userType.OTPConfig) string {
+	//hotp uris carry the counter they were created with, afterwards the database column is the source of truth
+	params := url.Values{}
+	params.Set("secret", config.Secret)
+	params.Set("algorithm", config.Algorithm)
+	params.Set("digits", strconv.Itoa(config.Digits))
+	params.Set("period", strconv.Itoa(config.Period))
+	if config.Kind == OTP_KIND_HOTP {
+		params.Set("counter", strconv.FormatUint(config.Counter, 10))
+	}
+	if len(config.Issuer) != 0 {
+		params.Set("issuer", config.Issuer)
+	}
+
+	uri := url.URL{Scheme: OTP_URI_SCHEME, Host: config.Kind, Path: "/" + config.Label, RawQuery: params.Encode()}
+	return uri.String()
+}
+
+func validateOTPConfig(config userType.OTPConfig) (userType.OTPConfig, error) {
+	//checks the config can generate codes, and returns it with the secret in canonical base32
+	secret, err := decodeOTPSecret(config.Secret)
+	if err != nil {
+		return userType.OTPConfig{}, err
+	}
+
+	//generating a code once validates algorithm, digits and period together
+	switch config.Kind {
+	case OTP_KIND_TOTP:
+		_, _, err = crypto.GenerateTOTP(secret, time.Now(), config.Period, config.Digits, config.Algorithm)
+	case OTP_KIND_HOTP:
+		_, err = crypto.GenerateHOTP(secret, config.Counter, config.Digits, config.Algorithm)
+	case OTP_KIND_STEAM:
+		_, _, err = crypto.GenerateSteamGuard(secret, time.Now())
+	default:
+		err = ErrUnsupportedOTPKind
+	}
+	if err != nil {
+		return userType.OTPConfig{}, err
+	}
+
+	config.Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	return config, nil
+}
+
+func SetEntryOTP(user userType.User, accountName string, config userType.OTPConfig, masterKey []byte) (string, error) {
+	//stores the otp config on the account as an encrypted otpauth uri, replacing any previous one
+	//returns the name of the account, or a possible error
+	validConfig, err := validateOTPConfig(config)
+	if err != nil {
+		return "", err
+	}
+	if len(validConfig.Label) == 0 {
+		validConfig.Label = accountName
+	}
+
+	encryptedURI, err := crypto.EncryptPassword([]byte(otpConfigToURI(validConfig)), masterKey)
+	if err != nil {
+		logger.Error("error in encrypting otp secret:", "error", err)
+		return "", err
+	}
+
+	acc, err := dbInterface.UpsertEntryOTP(user.Uid, accountName, encryptedURI, validConfig.Counter)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname:
+			logger.Error("Set entry otp failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			logger.Error("user account name not found:", "error", err)
+			return "", ErrAccountNotFound
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return acc, nil
+}
+
+func getEntryOTPConfig(user userType.User, accountName string, masterKey []byte) (userType.OTPConfig, error) {
+	encryptedURI, err := dbInterface.FetchEntryOTP(user.Uid, accountName)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname:
+			logger.Error("Get entry otp failed:", "error", err)
+			return userType.OTPConfig{}, err
+		default:
+			logger.Error("entry otp not found:", "error", err)
+			return userType.OTPConfig{}, fmt.Errorf("given account has no otp secret")
+		}
+	}
+
+	uri, err := crypto.DecryptPassword(encryptedURI, masterKey)
+	if err != nil {
+		logger.Error("entry otp decryption failed:", "error", err)
+		return userType.OTPConfig{}, fmt.Errorf("internal error when retrieving otp secret")
+	}
+
+	config, err := ParseOTPSecret(string(uri))
+	if err != nil {
+		logger.Error("stored otp uri is malformed:", "error", err)
+		return userType.OTPConfig{}, fmt.Errorf("internal error when retrieving otp secret")
+	}
+	return config, nil
+}
+
+func GetEntryOTPCode(user userType.User, accountName string, masterKey []byte) (userType.OTPCode, error) {
+	//returns the current code of the account, or a possible error
+	//counter based secrets advance their stored counter on every call, so each code is only handed out once
+	return entryOTPCode(user, accountName, masterKey, true)
+}
+
+func PeekEntryOTPCode(user userType.User, accountName string, masterKey []byte) (userType.OTPCode, error) {
+	//like GetEntryOTPCode, but a counter based code is not spent until CommitEntryOTPCounter is called with its counter
+	return entryOTPCode(user, accountName, masterKey, false)
+}
+
+func CommitEntryOTPCounter(user userType.User, accountName string, counter uint64) error {
+	//spends the counter based code PeekEntryOTPCode returned with the given counter
+	err := dbInterface.AdvanceEntryOTPCounter(user.Uid, accountName, counter)
+	if err != nil && !errors.Is(err, dbInterface.ErrOTPCounterMoved) {
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	return err
+}
+
+func entryOTPCode(user userType.User, accountName string, masterKey []byte, spend bool) (userType.OTPCode, error) {
+	config, err := getEntryOTPConfig(user, accountName, masterKey)
+	if err != nil {
+		return userType.OTPCode{}, err
+	}
+
+	secret, err := decodeOTPSecret(config.Secret)
+	if err != nil {
+		logger.Error("stored otp secret is malformed:", "error", err)
+		return userType.OTPCode{}, fmt.Errorf("internal error when retrieving otp secret")
+	}
+
+	code := userType.OTPCode{Kind: config.Kind}
+	switch config.Kind {
+	case OTP_KIND_TOTP:
+		code.Code, code.Remaining, err = crypto.GenerateTOTP(secret, time.Now(), config.Period, config.Digits, config.Algorithm)
+	case OTP_KIND_STEAM:
+		code.Code, code.Remaining, err = crypto.GenerateSteamGuard(secret, time.Now())
+	case OTP_KIND_HOTP:
+		if spend {
+			code.Counter, err = dbInterface.IncrementEntryOTPCounter(user.Uid, accountName)
+		} else {
+			code.Counter, err = dbInterface.FetchEntryOTPCounter(user.Uid, accountName)
+		}
+		if err != nil {
+			logger.Error("db error:", "error", err)
+			return userType.OTPCode{}, fmt.Errorf("internal error, try again later")
+		}
+		code.Code, err = crypto.GenerateHOTP(secret, code.Counter, config.Digits, config.Algorithm)
+	default:
+		err = ErrUnsupportedOTPKind
+	}
+	if err != nil {
+		logger.Error("otp generation failed:", "error", err)
+		return userType.OTPCode{}, fmt.Errorf("internal error when generating otp code")
+	}
+	return code, nil
+}
+
+func RemoveEntryOTP(user userType.User, accountName string) (string, error) {
+	acc, err := dbInterface.DeleteEntryOTP(user.Uid, accountName)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname:
+			logger.Error("Remove entry otp failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			logger.Error("entry otp not found:", "error", err)
+			return "", fmt.Errorf("given account has no otp secret")
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return acc, nil
+}
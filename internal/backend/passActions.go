@@ -0,0 +1,232 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pass, the standard unix password manager, keeps one gpg file per entry in a directory tree.
+// The first line of an entry is the password, it is followed by "key: value" lines and free form notes.
+
+const (
+	//extension of the plaintext entry files, keeps entry files apart from folders of the same name
+	PASS_ENTRY_EXTENSION = ".txt"
+	PASS_GPG_EXTENSION   = ".gpg"
+
+	//no sane entry is this big, anything larger is not a pass entry
+	PASS_MAX_ENTRY_SIZE = 1024 * 1024
+
+	PASS_KEY_SEPARATOR = ": "
+	PASS_OTP_PREFIX    = "otpauth://"
+)
+
+// pass has no field types, keys containing one of these words are imported as hidden fields
+var passHiddenKeyWords = []string{"password", "passphrase", "secret", "token", "pin", "key"}
+
+var (
+	ErrPassStoreExists   = errors.New("export directory already exists")
+	ErrPassFolderOutside = errors.New("folder of the entry leads outside the export directory, move it to another folder")
+)
+
+func passFileName(name string) string {
+	//entry names may contain the separator, which would otherwise become an extra directory level
+	return strings.ReplaceAll(name, dbInterface.FOLDER_SEPARATOR, "-") + PASS_ENTRY_EXTENSION
+}
+
+func createPassEntryFile(dir string, name string) (*os.File, error) {
+	//entries like a/b and a-b share a file name, later ones get a numbered suffix instead of failing the export
+	fileName := passFileName(name)
+	for i := 2; ; i++ {
+		file, err := os.OpenFile(filepath.Join(dir, fileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if !errors.Is(err, fs.ErrExist) {
+			return file, err
+		}
+		fileName = passFileName(name + "-" + strconv.Itoa(i))
+	}
+}
+
+func FormatPassEntry(entry userType.VaultEntry) []byte {
+	//returns the entry in the layout pass and its extensions (pass-otp, browserpass) understand
+	var content strings.Builder
+	writeLine := func(key, value string) {
+		if len(value) != 0 {
+			//values are single line, a line break would start the notes
+			content.WriteString(key + PASS_KEY_SEPARATOR + strings.Join(strings.Fields(value), " ") + "\n")
+		}
+	}
+
+	content.WriteString(entry.Password + "\n")
+	writeLine("username", entry.Username)
+	writeLine("url", entry.URL)
+	writeLine("tags", strings.Join(entry.Tags, ", "))
+	for _, field := range entry.Fields {
+		writeLine(field.Name, field.Value)
+	}
+	if len(entry.TOTP) != 0 {
+		content.WriteString(entry.TOTP + "\n")
+	}
+	if len(entry.Notes) != 0 {
+		content.WriteString(strings.TrimRight(entry.Notes, "\n") + "\n")
+	}
+	return []byte(content.String())
+}
+
+func ParsePassEntry(name string, folder string, data []byte) userType.VaultEntry {
+	//parses a decrypted pass entry, well known keys are mapped onto the entry and other keys become custom fields
+	//everything from the first line that is not a "key: value" pair on is kept as notes
+	entry := userType.VaultEntry{Name: name, Folder: folder}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	entry.Password = lines[0]
+
+	var notes []string
+	for _, line := range lines[1:] {
+		if len(notes) != 0 {
+			notes = append(notes, line)
+			continue
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line, PASS_OTP_PREFIX) && len(entry.TOTP) == 0 {
+			entry.TOTP = strings.TrimSpace(line)
+			continue
+		}
+
+		key, value, found := strings.Cut(line, PASS_KEY_SEPARATOR)
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if !found || len(key) == 0 || strings.ContainsAny(key, " \t/") || len(value) == 0 {
+			notes = append(notes, line)
+			continue
+		}
+
+		switch {
+		case (key == "username" || key == "user" || key == "login") && len(entry.Username) == 0:
+			entry.Username = value
+		case (key == URL_FIELD_NAME || key == "website") && len(entry.URL) == 0:
+			entry.URL = value
+		case key == "tags":
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); len(tag) != 0 {
+					entry.Tags = append(entry.Tags, tag)
+				}
+			}
+		default:
+			fieldType := userType.FieldText
+			for _, word := range passHiddenKeyWords {
+				if strings.Contains(key, word) {
+					fieldType = userType.FieldHidden
+					break
+				}
+			}
+			entry.Fields = append(entry.Fields, userType.EntryField{Name: key, Type: fieldType, Value: value})
+		}
+	}
+	entry.Notes = strings.TrimRight(strings.Join(notes, "\n"), "\n")
+	return entry
+}
+
+func ParsePassStore(store fs.FS) ([]userType.VaultEntry, []string, error) {
+	//reads a plaintext or already decrypted password store, directories become folders
+	//returns the entries and the paths of the entries that were skipped because they are still gpg encrypted
+	var entries []userType.VaultEntry
+	var encrypted []string
+	err := fs.WalkDir(store, ".", func(entryPath string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		//.git, .gpg-id and .extensions belong to pass itself
+		if entryPath != "." && strings.HasPrefix(dirEntry.Name(), ".") {
+			if dirEntry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if dirEntry.IsDir() || !dirEntry.Type().IsRegular() {
+			return nil
+		}
+		if strings.HasSuffix(entryPath, PASS_GPG_EXTENSION) {
+			encrypted = append(encrypted, entryPath)
+			return nil
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > PASS_MAX_ENTRY_SIZE {
+			return fmt.Errorf("%s is too large to be a pass entry", entryPath)
+		}
+		data, err := fs.ReadFile(store, entryPath)
+		if err != nil {
+			return err
+		}
+
+		folder := path.Dir(entryPath)
+		if folder == "." {
+			folder = ""
+		}
+		name := strings.TrimSuffix(path.Base(entryPath), PASS_ENTRY_EXTENSION)
+		entries = append(entries, ParsePassEntry(name, folder, data))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, encrypted, nil
+}
+
+func ExportUserAccountsPass(user userType.User, root string, masterKey []byte) (int, error) {
+	//writes every entry of the user as a plaintext password store below root, which must not exist yet
+	//the tree is only readable by the owner, and removed again if the export fails half way
+	//returns the number of exported entries, or a possible error
+	entries, err := ExportUserAccounts(user, masterKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Mkdir(root, 0700); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return 0, ErrPassStoreExists
+		}
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		dir := filepath.Join(root, filepath.FromSlash(entry.Folder))
+		//folders stored before . and .. were rejected could still climb out of root
+		if relative, relErr := filepath.Rel(root, dir); relErr != nil || !filepath.IsLocal(relative) {
+			err = fmt.Errorf("%w: %s", ErrPassFolderOutside, entry.Name)
+			break
+		}
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			break
+		}
+		var file *os.File
+		file, err = createPassEntryFile(dir, entry.Name)
+		if err != nil {
+			break
+		}
+		_, err = file.Write(FormatPassEntry(entry))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		os.RemoveAll(root)
+		return 0, err
+	}
+
+	logger.Info("Exported password store", "username", user.Name, "count", len(entries))
+	return len(entries), nil
+}
@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+)
+
+// Entries are encrypted with the vault key of their user. The master password wraps it, and so does the recovery code,
+// which is shown once when it is created. Recovering replaces the master password and the used code,
+// the vault key and everything encrypted with it stay as they are.
+
+var (
+	ErrNoRecoveryCode   = errors.New("this user has no recovery code, one can be created after logging in with recoverycode")
+	ErrRecoveryMismatch = errors.New("recovery code does not match this user")
+)
+
+func unwrapVaultKey(user userType.User, masterKey []byte) ([]byte, error) {
+	//users created before recovery codes existed use their master key as vault key
+	if len(user.WrappedVaultKey) == 0 {
+		return masterKey, nil
+	}
+	return crypto.DecryptPassword(user.WrappedVaultKey, masterKey)
+}
+
+func wrapWithRecoveryCode(vaultKey []byte) (string, []byte, []byte, error) {
+	//returns a new recovery code, its salt and the vault key wrapped with it
+	code, err := crypto.GenerateRecoveryCode()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	raw, err := crypto.NormalizeRecoveryCode(code)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	salt := []byte(crypto.GenerateRandomString(SALT_SIZE))
+	key, err := crypto.Genkey(raw, salt)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer clear(key)
+	wrappedVaultKey, err := crypto.EncryptPassword(vaultKey, key)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return code, salt, wrappedVaultKey, nil
+}
+
+func setRecoveryCode(user userType.User, vaultKey []byte) (string, error) {
+	code, salt, wrappedVaultKey, err := wrapWithRecoveryCode(vaultKey)
+	if err != nil {
+		return "", err
+	}
+	if err := dbInterface.UpsertRecovery(user.Uid, salt, wrappedVaultKey); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func NewRecoveryCode(user userType.User, masterPassword string, keyFile string, vaultKey []byte) (string, error) {
+	//replaces the recovery code of the user, the master password is asked again as the code can replace it
+	//returns the new code, which is not stored anywhere in readable form
+	if _, _, err := authenticateUser(user.Name, masterPassword, keyFile); err != nil {
+		return "", err
+	}
+	code, err := setRecoveryCode(user, vaultKey)
+	if err != nil {
+		logger.Error("creating recovery code failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Recovery code replaced", "username", user.Name)
+	return code, nil
+}
+
+func RecoverUser(username string, recoveryCode string, newMasterPassword string) (string, error) {
+	//sets a new master password using the recovery code of the user
+	//returns the recovery code replacing the used one, or a possible error
+	logger.Info("Attempting to recover user", "username", username)
+	if len(newMasterPassword) == 0 {
+		return "", crypto.Err0LengthPassword
+	}
+	user, err := dbInterface.FetchUser(username)
+	if err != nil {
+		if errors.Is(err, dbInterface.Err0LengthUsername) {
+			return "", err
+		}
+		logger.Error("recovery failed: given user couldnt be found", "error", err)
+		return "", fmt.Errorf("given user couldnt be found")
+	}
+	recoverySalt, recoveryWrappedKey, err := dbInterface.FetchRecovery(user.Uid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecoveryCode
+		}
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+
+	raw, err := crypto.NormalizeRecoveryCode(recoveryCode)
+	if err != nil {
+		return "", err
+	}
+	recoveryKey, err := crypto.Genkey(raw, recoverySalt)
+	if err != nil {
+		logger.Error("recovery failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	defer clear(recoveryKey)
+	vaultKey, err := crypto.DecryptPassword(recoveryWrappedKey, recoveryKey)
+	if err != nil {
+		logger.Error("recovery failed: mismatch recovery code")
+		return "", ErrRecoveryMismatch
+	}
+	defer clear(vaultKey)
+
+	salt := []byte(crypto.GenerateRandomString(SALT_SIZE))
+	masterKey, err := crypto.Genkey([]byte(newMasterPassword), salt)
+	if err != nil {
+		logger.Error("recovery failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	defer clear(masterKey)
+	hashedKey, err := crypto.HashPassword(masterKey)
+	if err != nil {
+		logger.Error("recovery failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	wrappedVaultKey, err := crypto.EncryptPassword(vaultKey, masterKey)
+	if err != nil {
+		logger.Error("error in encrypting vault key:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+
+	//the used code has been typed somewhere, it is replaced along with the password
+	newCode, newRecoverySalt, newRecoveryWrappedKey, err := wrapWithRecoveryCode(vaultKey)
+	if err != nil {
+		logger.Error("creating recovery code failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	if err := dbInterface.RecoverUser(user.Uid, salt, hashedKey, wrappedVaultKey, newRecoverySalt, newRecoveryWrappedKey); err != nil {
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+
+	logger.Info("User recovered, master password replaced", "username", username)
+	return newCode, nil
+}
@@ -0,0 +1,223 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"strings"
+)
+
+// Secret references name one value of an entry independently of the command reading it:
+//
+//	glk://<user>/<folder>/<entry>/<field>
+//
+// The folder takes as many segments as it is deep, and none for entries at the root.
+// Segments are percent-encoded, so entry names containing a slash can be referenced too.
+// The field is username, password, otp for the current one time code, or the name of a custom field.
+
+const REFERENCE_SCHEME = "glk://"
+
+const (
+	REFERENCE_FIELD_USERNAME = "username"
+	REFERENCE_FIELD_PASSWORD = "password"
+	REFERENCE_FIELD_OTP      = "otp"
+)
+
+var (
+	ErrReferenceScheme     = errors.New("must start with " + REFERENCE_SCHEME)
+	ErrReferenceIncomplete = errors.New("is missing, expected " + REFERENCE_SCHEME + "<user>/<folder>/<entry>/<field>")
+	ErrReferenceEmpty      = errors.New("cannot be empty")
+	ErrReferenceEncoding   = errors.New("is not validly percent-encoded")
+	ErrReferenceOtherUser  = errors.New("is not the logged in user")
+	ErrReferenceNoEntry    = errors.New("does not name an entry")
+	ErrReferenceNoField    = errors.New("is not a field of the entry")
+)
+
+// ReferenceError is a reference that could not be parsed or resolved, pointing at the segment at fault.
+type ReferenceError struct {
+	Reference string
+	// Segment is one of scheme, user, folder, entry or field
+	Segment string
+	Value   string
+	// Offset is where the segment starts in the reference
+	Offset int
+	Err    error
+}
+
+func (err *ReferenceError) Error() string {
+	if err.Segment == "scheme" {
+		return fmt.Sprintf("invalid reference %q: %v", err.Reference, err.Err)
+	}
+	return fmt.Sprintf("invalid reference %q: %s segment %q at character %d %v", err.Reference, err.Segment, err.Value, err.Offset+1, err.Err)
+}
+
+func (err *ReferenceError) Unwrap() error {
+	return err.Err
+}
+
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, REFERENCE_SCHEME)
+}
+
+func ParseSecretReference(reference string) (userType.SecretReference, error) {
+	//returns the parts of the reference, entry and folder names are lowercased like everywhere else
+	if !IsSecretReference(reference) {
+		return userType.SecretReference{}, &ReferenceError{Reference: reference, Segment: "scheme", Err: ErrReferenceScheme}
+	}
+
+	rawSegments := strings.Split(reference[len(REFERENCE_SCHEME):], "/")
+	segments := make([]string, len(rawSegments))
+	offsets := make([]int, len(rawSegments))
+	offset := len(REFERENCE_SCHEME)
+	for i, raw := range rawSegments {
+		offsets[i] = offset
+		offset += len(raw) + 1
+	}
+
+	if len(rawSegments) < 3 {
+		missing := []string{"entry", "field"}[len(rawSegments)-1]
+		return userType.SecretReference{}, &ReferenceError{Reference: reference, Segment: missing, Offset: len(reference), Err: ErrReferenceIncomplete}
+	}
+	//names each segment by its position, the last two are always the entry and the field
+	segmentName := func(i int) string {
+		switch i {
+		case 0:
+			return "user"
+		case len(rawSegments) - 2:
+			return "entry"
+		case len(rawSegments) - 1:
+			return "field"
+		default:
+			return "folder"
+		}
+	}
+
+	for i, raw := range rawSegments {
+		segment, err := url.PathUnescape(raw)
+		if err != nil {
+			return userType.SecretReference{}, &ReferenceError{Reference: reference, Segment: segmentName(i), Value: raw, Offset: offsets[i], Err: ErrReferenceEncoding}
+		}
+		if len(strings.TrimSpace(segment)) == 0 {
+			return userType.SecretReference{}, &ReferenceError{Reference: reference, Segment: segmentName(i), Value: raw, Offset: offsets[i], Err: ErrReferenceEmpty}
+		}
+		segments[i] = segment
+	}
+
+	folderSegments := segments[1 : len(segments)-2]
+	for i := range folderSegments {
+		folderSegments[i] = strings.ToLower(folderSegments[i])
+	}
+	return userType.SecretReference{
+		User:   segments[0],
+		Folder: strings.Join(folderSegments, dbInterface.FOLDER_SEPARATOR),
+		Entry:  strings.ToLower(segments[len(segments)-2]),
+		Field:  segments[len(segments)-1],
+	}, nil
+}
+
+func FormatSecretReference(ref userType.SecretReference) string {
+	//returns the reference as a uri, the inverse of ParseSecretReference
+	segments := []string{url.PathEscape(ref.User)}
+	if len(ref.Folder) != 0 {
+		for _, segment := range strings.Split(ref.Folder, dbInterface.FOLDER_SEPARATOR) {
+			segments = append(segments, url.PathEscape(segment))
+		}
+	}
+	segments = append(segments, url.PathEscape(ref.Entry), url.PathEscape(ref.Field))
+	return REFERENCE_SCHEME + strings.Join(segments, "/")
+}
+
+func segmentError(reference string, segment string, err error) *ReferenceError {
+	//returns the error for the named segment of an already parsed reference, the folder error points at its first segment
+	rawSegments := strings.Split(reference[len(REFERENCE_SCHEME):], "/")
+	index := map[string]int{"user": 0, "folder": 1, "entry": len(rawSegments) - 2, "field": len(rawSegments) - 1}[segment]
+	offset := len(REFERENCE_SCHEME)
+	for _, raw := range rawSegments[:index] {
+		offset += len(raw) + 1
+	}
+	value := rawSegments[index]
+	if segment == "folder" {
+		value = strings.Join(rawSegments[1:len(rawSegments)-2], "/")
+		if len(value) == 0 {
+			offset--
+		}
+	}
+	return &ReferenceError{Reference: reference, Segment: segment, Value: value, Offset: offset, Err: err}
+}
+
+func ResolveSecretReference(user userType.User, reference string, masterKey []byte) (string, error) {
+	//returns the value the reference points at, or a ReferenceError naming the segment that does not resolve
+	ref, err := ParseSecretReference(reference)
+	if err != nil {
+		return "", err
+	}
+	if ref.User != user.Name {
+		return "", segmentError(reference, "user", ErrReferenceOtherUser)
+	}
+
+	accountUsername, accountPassword, err := GetUserAccount(user, ref.Entry, masterKey)
+	if errors.Is(err, ErrAccountNotFound) {
+		return "", segmentError(reference, "entry", ErrReferenceNoEntry)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	//the folder is checked so a reference stops resolving when its entry is moved, instead of silently following it
+	summaries, err := GetUserAccountSummaries(user, ref.Folder, nil)
+	if err != nil {
+		return "", err
+	}
+	inFolder := false
+	for _, summary := range summaries {
+		if summary.Name == ref.Entry && summary.Folder == ref.Folder {
+			inFolder = true
+		}
+	}
+	if !inFolder {
+		return "", segmentError(reference, "folder", fmt.Errorf("does not hold entry %s", ref.Entry))
+	}
+
+	switch strings.ToLower(ref.Field) {
+	case REFERENCE_FIELD_USERNAME:
+		return accountUsername, nil
+	case REFERENCE_FIELD_PASSWORD:
+		return accountPassword, nil
+	case REFERENCE_FIELD_OTP:
+		code, err := GetEntryOTPCode(user, ref.Entry, masterKey)
+		if err != nil {
+			return "", segmentError(reference, "field", err)
+		}
+		return code.Code, nil
+	}
+
+	fields, err := GetEntryFields(user, ref.Entry, masterKey)
+	if err != nil {
+		return "", err
+	}
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, ref.Field) {
+			return field.Value, nil
+		}
+	}
+	return "", segmentError(reference, "field", ErrReferenceNoField)
+}
+
+func GetSecretReference(user userType.User, accountName string, fieldName string) (string, error) {
+	//returns the reference to the field of the account, as it is currently filed
+	if len(fieldName) == 0 {
+		return "", fmt.Errorf("field name cannot be empty")
+	}
+	summaries, err := GetUserAccountSummaries(user, "", nil)
+	if err != nil {
+		return "", err
+	}
+	for _, summary := range summaries {
+		if summary.Name == accountName {
+			return FormatSecretReference(userType.SecretReference{User: user.Name, Folder: summary.Folder, Entry: summary.Name, Field: fieldName}), nil
+		}
+	}
+	return "", ErrAccountNotFound
+}
@@ -0,0 +1,170 @@
+package backend
+
+import (
+	"fmt"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"sort"
+	"strings"
+)
+
+const (
+	// scores of the different kinds of matches, higher ranks first
+	SCORE_EXACT       = 100
+	SCORE_PREFIX      = 80
+	SCORE_SUBSTRING   = 60
+	SCORE_SUBSEQUENCE = 40
+	SCORE_TYPO        = 30
+
+	// matches on anything other than the account name rank slightly below name matches
+	SECONDARY_FIELD_PENALTY = 5
+
+	// maximum number of suggestions offered when an exact lookup fails
+	MAX_SUGGESTIONS = 3
+)
+
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func isSubsequence(query []rune, candidate []rune) bool {
+	i := 0
+	for _, r := range candidate {
+		if i < len(query) && query[i] == r {
+			i++
+		}
+	}
+	return i == len(query)
+}
+
+func matchScore(query string, candidate string) int {
+	//returns how well the candidate matches the query, 0 means no match at all
+	//both are compared lowercased
+	query = strings.ToLower(query)
+	candidate = strings.ToLower(candidate)
+	if len(query) == 0 || len(candidate) == 0 {
+		return 0
+	}
+
+	switch {
+	case candidate == query:
+		return SCORE_EXACT
+	case strings.HasPrefix(candidate, query):
+		return SCORE_PREFIX
+	case strings.Contains(candidate, query):
+		return SCORE_SUBSTRING
+	}
+
+	queryRunes, candidateRunes := []rune(query), []rune(candidate)
+	if isSubsequence(queryRunes, candidateRunes) {
+		//shorter candidates are a tighter fit for the same subsequence
+		return SCORE_SUBSEQUENCE - min(len(candidateRunes)-len(queryRunes), SCORE_SUBSEQUENCE-SCORE_TYPO-1)
+	}
+
+	//allow roughly one typo per three characters
+	distance := levenshtein(queryRunes, candidateRunes)
+	if distance <= max(1, len(queryRunes)/3) {
+		return SCORE_TYPO - distance
+	}
+	return 0
+}
+
+func rankSearchResults(results []userType.SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Account.Name < results[j].Account.Name
+	})
+}
+
+func SearchUserAccounts(user userType.User, query string, masterKey []byte) ([]userType.SearchResult, error) {
+	//matches the query against account names, usernames, url fields and tags
+	//returns every matching account once, ranked by its best match, or a possible error
+	if len(strings.TrimSpace(query)) == 0 {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+
+	summaries, err := dbInterface.FetchAccountSummaries(user.Uid, "", nil)
+	if err != nil {
+		logger.Error("error in retrieving user account summaries:", "error", err)
+		return nil, fmt.Errorf("internal error in retrieving user accounts")
+	}
+
+	urlRecords, err := dbInterface.FetchUserFieldsOfType(user.Uid, string(userType.FieldURL))
+	if err != nil {
+		logger.Error("error in retrieving url fields:", "error", err)
+		return nil, fmt.Errorf("internal error in retrieving user accounts")
+	}
+
+	results := make([]userType.SearchResult, 0)
+	for _, summary := range summaries {
+		best := userType.SearchResult{Account: summary}
+		consider := func(candidate string, matchedOn string, penalty int) {
+			if score := matchScore(query, candidate); score > 0 && score-penalty > best.Score {
+				best.Score = score - penalty
+				best.MatchedOn = matchedOn
+			}
+		}
+
+		consider(summary.Name, "name", 0)
+		consider(summary.Username, "username", SECONDARY_FIELD_PENALTY)
+		for _, tag := range summary.Tags {
+			consider(tag, "tag", SECONDARY_FIELD_PENALTY)
+		}
+		for _, record := range urlRecords[summary.Name] {
+			field, err := decryptFieldRecord(record, masterKey)
+			if err != nil {
+				return nil, err
+			}
+			consider(field.Value, "url", SECONDARY_FIELD_PENALTY)
+		}
+
+		if best.Score > 0 {
+			results = append(results, best)
+		}
+	}
+
+	rankSearchResults(results)
+	return results, nil
+}
+
+func SuggestUserAccountNames(user userType.User, accountName string) ([]string, error) {
+	//returns up to MAX_SUGGESTIONS account names close to the given one, best first
+	//only names are considered, so no key is needed
+	accs, err := dbInterface.FetchUserAccounts(user.Uid)
+	if err != nil {
+		logger.Error("error in retrieving user account names:", "error", err)
+		return nil, fmt.Errorf("internal error in retrieving user accounts")
+	}
+
+	results := make([]userType.SearchResult, 0)
+	for _, acc := range accs {
+		if score := matchScore(accountName, acc); score > 0 {
+			results = append(results, userType.SearchResult{Account: userType.AccountSummary{Name: acc}, MatchedOn: "name", Score: score})
+		}
+	}
+	rankSearchResults(results)
+
+	suggestions := make([]string, 0, MAX_SUGGESTIONS)
+	for i := 0; i < len(results) && i < MAX_SUGGESTIONS; i++ {
+		suggestions = append(suggestions, results[i].Account.Name)
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"strconv"
+	"strings"
+)
+
+// The vault key of a user can be split into shares, any threshold of which unlock the vault without the master password.
+// A printed share reads pmshare1:<user>:<set>:<threshold>:<index>:<data>:<checksum>. The set tells apart shares of
+// different splits, and the checksum catches typos before any share is combined.
+
+const (
+	SHARE_PREFIX = "pmshare1"
+	// SHARE_SET_SIZE is the number of random bytes naming the split a share belongs to
+	SHARE_SET_SIZE = 4
+)
+
+var shareEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var (
+	ErrShareChecksum     = errors.New("share checksum does not match, check it for typos")
+	ErrShareWrongUser    = errors.New("share belongs to another user")
+	ErrShareSetMismatch  = errors.New("shares come from different splits")
+	ErrShareMismatchKey  = errors.New("shares do not reconstruct the vault key of this user")
+	ErrShareUnverifiable = errors.New("this user has no key pair to check the reconstructed key against, log in with the master password once")
+)
+
+type vaultKeyShare struct {
+	user      string
+	set       string
+	threshold int
+	data      []byte
+}
+
+func shareChecksum(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:4])
+}
+
+func formatVaultKeyShare(share vaultKeyShare) string {
+	body := strings.Join([]string{SHARE_PREFIX, share.user, share.set, strconv.Itoa(share.threshold), strconv.Itoa(int(share.data[0])), shareEncoding.EncodeToString(share.data[1:])}, ":")
+	return body + ":" + shareChecksum(body)
+}
+
+func parseVaultKeyShare(text string) (vaultKeyShare, error) {
+	text = strings.TrimSpace(text)
+	fields := strings.Split(text, ":")
+	//usernames may contain colons, everything between the prefix and the last five fields is the user
+	if len(fields) < 7 || fields[0] != SHARE_PREFIX {
+		return vaultKeyShare{}, crypto.ErrInvalidShare
+	}
+	last := len(fields) - 1
+	if shareChecksum(text[:strings.LastIndex(text, ":")]) != strings.ToLower(fields[last]) {
+		return vaultKeyShare{}, ErrShareChecksum
+	}
+
+	threshold, err := strconv.Atoi(fields[last-3])
+	if err != nil {
+		return vaultKeyShare{}, crypto.ErrInvalidShare
+	}
+	index, err := strconv.Atoi(fields[last-2])
+	if err != nil || index < 1 || index > crypto.MAX_SHAMIR_SHARES {
+		return vaultKeyShare{}, crypto.ErrInvalidShare
+	}
+	//every vault key is KEY_LEN bytes, a share of any other length cant rebuild one
+	values, err := shareEncoding.DecodeString(strings.ToUpper(fields[last-1]))
+	if err != nil || len(values) != crypto.KEY_LEN {
+		return vaultKeyShare{}, crypto.ErrInvalidShare
+	}
+	return vaultKeyShare{
+		user:      strings.Join(fields[1:last-4], ":"),
+		set:       fields[last-4],
+		threshold: threshold,
+		data:      append([]byte{byte(index)}, values...),
+	}, nil
+}
+
+func SplitVaultKey(user userType.User, masterPassword string, keyFile string, threshold int, shares int, vaultKey []byte) ([]string, error) {
+	//returns printable shares of the vault key, the master password is asked again as the shares bypass it
+	if _, _, err := authenticateUser(user.Name, masterPassword, keyFile); err != nil {
+		return nil, err
+	}
+	parts, err := crypto.SplitSecret(vaultKey, threshold, shares)
+	if err != nil {
+		return nil, err
+	}
+	set, err := crypto.GenerateSymmetricKey()
+	if err != nil {
+		logger.Error("share set generation failed:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+
+	printable := make([]string, 0, len(parts))
+	for _, part := range parts {
+		printable = append(printable, formatVaultKeyShare(vaultKeyShare{user: user.Name, set: hex.EncodeToString(set[:SHARE_SET_SIZE]), threshold: threshold, data: part}))
+		clear(part)
+	}
+	logger.Info("Vault key split", "username", user.Name, "threshold", threshold, "shares", shares)
+	return printable, nil
+}
+
+func LogUserInWithShares(username string, shares []string) (userType.User, []byte, error) {
+	//returns the user and their vault key reconstructed from the shares, like LogUserIn does from the master password
+	logger.Info("Attempting to log in with vault key shares", "username", username)
+	if len(shares) == 0 {
+		return userType.User{}, []byte{}, crypto.ErrTooFewShares
+	}
+	parts := make([][]byte, 0, len(shares))
+	defer func() {
+		for _, part := range parts {
+			clear(part)
+		}
+	}()
+	var first vaultKeyShare
+	for i, text := range shares {
+		share, err := parseVaultKeyShare(text)
+		if err != nil {
+			return userType.User{}, []byte{}, fmt.Errorf("share %d: %w", i+1, err)
+		}
+		if share.user != username {
+			return userType.User{}, []byte{}, fmt.Errorf("share %d: %w", i+1, ErrShareWrongUser)
+		}
+		if i == 0 {
+			first = share
+		} else if share.set != first.set || share.threshold != first.threshold {
+			return userType.User{}, []byte{}, fmt.Errorf("share %d: %w", i+1, ErrShareSetMismatch)
+		}
+		parts = append(parts, share.data)
+	}
+	if len(parts) < first.threshold {
+		return userType.User{}, []byte{}, fmt.Errorf("%w, %d of %d given", crypto.ErrTooFewShares, len(parts), first.threshold)
+	}
+
+	user, err := dbInterface.FetchUser(username)
+	if err != nil {
+		if errors.Is(err, dbInterface.Err0LengthUsername) {
+			return userType.User{}, []byte{}, err
+		}
+		logger.Error("share login failed: given user couldnt be found", "error", err)
+		return userType.User{}, []byte{}, fmt.Errorf("given user couldnt be found")
+	}
+	vaultKey, err := crypto.CombineShares(parts)
+	if err != nil {
+		return userType.User{}, []byte{}, err
+	}
+
+	//the private key is encrypted with the vault key, opening it proves the reconstruction
+	privateKey, err := userPrivateKey(user, vaultKey)
+	if err != nil {
+		clear(vaultKey)
+		if errors.Is(err, dbInterface.ErrNoUserKeys) {
+			return userType.User{}, []byte{}, ErrShareUnverifiable
+		}
+		logger.Error("share login failed: reconstructed key mismatch", "error", err)
+		return userType.User{}, []byte{}, ErrShareMismatchKey
+	}
+	clear(privateKey)
+
+	logger.Info("User logged in with vault key shares", "username", username)
+	return user, vaultKey, nil
+}
@@ -0,0 +1,381 @@
+package backend
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"strings"
+	"time"
+)
+
+// Every user has an X25519 key pair, the private key encrypted with their master key.
+// Sharing an entry gives it a random key of its own: the entry is copied encrypted with that key,
+// the owner keeps the key encrypted with their master key and each recipient gets it sealed to their public key.
+// Revoking a recipient replaces the key, so a copy of the old one no longer opens the entry.
+
+var (
+	ErrShareWithSelf       = errors.New("an entry cannot be shared with its owner")
+	ErrRecipientNotFound   = errors.New("given recipient couldnt be found")
+	ErrRecipientHasNoKeys  = errors.New("recipient has no sharing key yet, they get one on their next login")
+	ErrShareNotFound       = errors.New("the entry is not shared with this user")
+	ErrSharedEntryNotFound = errors.New("no entry with this name is shared with you by this user")
+	ErrShareNotRefreshed   = errors.New("the change was saved, but its recipients still see the previous version, share the entry again to update their copy")
+)
+
+// entryPayload is an entry as it is stored outside the personal vault of its owner
+type entryPayload struct {
+	Username string                `json:"username"`
+	Password string                `json:"password"`
+	Fields   []userType.EntryField `json:"fields,omitempty"`
+	// only entries moved into a collection carry these, shares leave them with the owner
+	OTP    string   `json:"otp,omitempty"`
+	Folder string   `json:"folder,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+func ensureUserKeyPair(user userType.User, masterKey []byte) error {
+	//creates the key pair of a user that has none, users created before sharing existed get theirs on login
+	_, _, err := dbInterface.FetchUserKeys(user.Uid)
+	if !errors.Is(err, dbInterface.ErrNoUserKeys) {
+		return err
+	}
+
+	public, private, err := crypto.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	defer clear(private)
+	encryptedPrivate, err := crypto.EncryptPassword(private, masterKey)
+	if err != nil {
+		return err
+	}
+	return dbInterface.InsertUserKeys(user.Uid, public, encryptedPrivate)
+}
+
+func userPrivateKey(user userType.User, masterKey []byte) ([]byte, error) {
+	_, encryptedPrivate, err := dbInterface.FetchUserKeys(user.Uid)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DecryptPassword(encryptedPrivate, masterKey)
+}
+
+func GetKeyFingerprint(username string) (string, error) {
+	//returns the fingerprint of the public key of the user, to be compared out of band before sharing
+	_, public, err := dbInterface.FetchPublicKey(username)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthUsername):
+			return "", err
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecipientNotFound
+		case errors.Is(err, dbInterface.ErrNoUserKeys):
+			return "", ErrRecipientHasNoKeys
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+	return crypto.KeyFingerprint(public), nil
+}
+
+func encryptEntryPayload(user userType.User, accountName string, masterKey []byte, entryKey []byte) ([]byte, error) {
+	//returns the current username, password and fields of the entry encrypted with the entry key
+	username, password, err := GetUserAccount(user, accountName, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := GetEntryFields(user, accountName, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(entryPayload{Username: username, Password: password, Fields: fields})
+	if err != nil {
+		return nil, err
+	}
+	defer clear(payload)
+	return crypto.EncryptPassword(payload, entryKey)
+}
+
+func decryptEntryPayload(encryptedData []byte, entryKey []byte) (entryPayload, error) {
+	decrypted, err := crypto.DecryptPassword(encryptedData, entryKey)
+	if err != nil {
+		return entryPayload{}, err
+	}
+	defer clear(decrypted)
+
+	var payload entryPayload
+	if err := json.Unmarshal(decrypted, &payload); err != nil {
+		return entryPayload{}, err
+	}
+	return payload, nil
+}
+
+func ShareUserAccount(user userType.User, accountName string, recipientName string, masterKey []byte) (string, error) {
+	//shares the entry with the recipient, sharing it again with someone who has it refreshes their copy
+	//returns the fingerprint of the public key the entry was shared to, or a possible error
+	if recipientName == user.Name {
+		return "", ErrShareWithSelf
+	}
+	recipientId, recipientKey, err := dbInterface.FetchPublicKey(recipientName)
+	if err != nil {
+		switch {
+		case errors.Is(err, dbInterface.Err0LengthUsername):
+			return "", err
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecipientNotFound
+		case errors.Is(err, dbInterface.ErrNoUserKeys):
+			return "", ErrRecipientHasNoKeys
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	//an entry already shared with someone keeps its key, otherwise it gets a new one
+	var entryKey []byte
+	share, err := dbInterface.FetchEntryShare(user.Uid, accountName)
+	switch {
+	case err == nil:
+		entryKey, err = crypto.DecryptPassword(share.OwnerKey, masterKey)
+		if err != nil {
+			logger.Error("entry share key decryption failed:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		entryKey, err = crypto.GenerateSymmetricKey()
+		if err != nil {
+			logger.Error("entry share key generation failed:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	default:
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+	defer clear(entryKey)
+
+	encryptedData, err := encryptEntryPayload(user, accountName, masterKey, entryKey)
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := crypto.SealToPublicKey(entryKey, recipientKey)
+	if err != nil {
+		logger.Error("sealing entry share key failed:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+
+	shareId := share.Id
+	if shareId == 0 {
+		ownerKey, err := crypto.EncryptPassword(entryKey, masterKey)
+		if err != nil {
+			logger.Error("error in encrypting entry share key:", "error", err)
+			return "", err
+		}
+		shareId, err = dbInterface.InsertEntryShare(user.Uid, accountName, ownerKey, encryptedData)
+		if err != nil {
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	} else if err := dbInterface.UpdateEntryShareData(shareId, encryptedData); err != nil {
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+
+	if err := dbInterface.UpsertShareRecipient(shareId, recipientId, wrappedKey); err != nil {
+		logger.Error("db error:", "error", err)
+		return "", fmt.Errorf("internal error, try again later")
+	}
+
+	logger.Info("Entry shared", "username", user.Name, "recipient", recipientName)
+	return crypto.KeyFingerprint(recipientKey), nil
+}
+
+func RevokeShare(user userType.User, accountName string, recipientName string, masterKey []byte) error {
+	//stops sharing the entry with the recipient, the remaining recipients get the entry under a new key
+	share, err := dbInterface.FetchEntryShare(user.Uid, accountName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrShareNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	recipientId, _, err := dbInterface.FetchPublicKey(recipientName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, dbInterface.ErrNoUserKeys) {
+			return ErrShareNotFound
+		}
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+
+	removed, err := dbInterface.DeleteShareRecipient(share.Id, recipientId)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	if !removed {
+		return ErrShareNotFound
+	}
+	logger.Info("Entry share revoked", "username", user.Name, "recipient", recipientName)
+
+	recipients, err := dbInterface.FetchShareRecipients(share.Id)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	entryKey, err := crypto.GenerateSymmetricKey()
+	if err != nil {
+		logger.Error("entry share key generation failed:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	defer clear(entryKey)
+	encryptedData, err := encryptEntryPayload(user, accountName, masterKey, entryKey)
+	if err != nil {
+		return err
+	}
+	ownerKey, err := crypto.EncryptPassword(entryKey, masterKey)
+	if err != nil {
+		logger.Error("error in encrypting entry share key:", "error", err)
+		return err
+	}
+	wrappedKeys := make(map[int64][]byte, len(recipients))
+	for _, recipient := range recipients {
+		wrappedKey, err := crypto.SealToPublicKey(entryKey, recipient.PublicKey)
+		if err != nil {
+			logger.Error("sealing entry share key failed:", "error", err)
+			return fmt.Errorf("internal error, try again later")
+		}
+		wrappedKeys[recipient.RecipientId] = wrappedKey
+	}
+
+	if err := dbInterface.RekeyEntryShare(share.Id, ownerKey, encryptedData, wrappedKeys); err != nil {
+		logger.Error("db error:", "error", err)
+		return fmt.Errorf("internal error, try again later")
+	}
+	return nil
+}
+
+func refreshEntryShare(user userType.User, accountName string, masterKey []byte) error {
+	//brings the shared copy of an entry up to date after a change
+	//returns ErrShareNotRefreshed if recipients are left with the previous copy, the change itself stays saved
+	share, err := dbInterface.FetchEntryShare(user.Uid, accountName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		logger.Error("refreshing entry share failed:", "error", err)
+		return ErrShareNotRefreshed
+	}
+	entryKey, err := crypto.DecryptPassword(share.OwnerKey, masterKey)
+	if err != nil {
+		logger.Error("refreshing entry share failed:", "error", err)
+		return ErrShareNotRefreshed
+	}
+	defer clear(entryKey)
+
+	encryptedData, err := encryptEntryPayload(user, accountName, masterKey, entryKey)
+	if err != nil {
+		logger.Error("refreshing entry share failed:", "error", err)
+		return ErrShareNotRefreshed
+	}
+	if err := dbInterface.UpdateEntryShareData(share.Id, encryptedData); err != nil {
+		logger.Error("refreshing entry share failed:", "error", err)
+		return ErrShareNotRefreshed
+	}
+	return nil
+}
+
+func refreshEntryShares(user userType.User, accountNames []string, masterKey []byte) error {
+	//refreshes the shared copies of every named entry, the error names the ones left out of date
+	var stale []string
+	for _, accountName := range accountNames {
+		if err := refreshEntryShare(user, accountName, masterKey); err != nil {
+			stale = append(stale, accountName)
+		}
+	}
+	if len(stale) != 0 {
+		return fmt.Errorf("%w: %s", ErrShareNotRefreshed, strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+func openIncomingShare(record dbInterface.IncomingShareRecord, privateKey []byte) (userType.SharedEntry, error) {
+	entryKey, err := crypto.OpenSealed(record.WrappedKey, privateKey)
+	if err != nil {
+		return userType.SharedEntry{}, err
+	}
+	defer clear(entryKey)
+	payload, err := decryptEntryPayload(record.EncryptedData, entryKey)
+	if err != nil {
+		return userType.SharedEntry{}, err
+	}
+	return userType.SharedEntry{
+		Owner:    record.Owner,
+		Name:     record.Name,
+		Username: payload.Username,
+		Password: payload.Password,
+		Fields:   payload.Fields,
+		SharedAt: time.UnixMilli(record.SharedAt),
+	}, nil
+}
+
+func GetSharedEntries(user userType.User, masterKey []byte) ([]userType.SharedEntry, []userType.ShareGrant, error) {
+	//returns the entries shared with the user, and the entries the user shares with whom
+	incoming, err := dbInterface.FetchIncomingShares(user.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, nil, fmt.Errorf("internal error, try again later")
+	}
+	outgoing, err := dbInterface.FetchOutgoingShares(user.Uid)
+	if err != nil {
+		logger.Error("db error:", "error", err)
+		return nil, nil, fmt.Errorf("internal error, try again later")
+	}
+
+	received := make([]userType.SharedEntry, 0, len(incoming))
+	if len(incoming) != 0 {
+		privateKey, err := userPrivateKey(user, masterKey)
+		if err != nil {
+			logger.Error("user private key decryption failed:", "error", err)
+			return nil, nil, fmt.Errorf("internal error, try again later")
+		}
+		defer clear(privateKey)
+		for _, record := range incoming {
+			entry, err := openIncomingShare(record, privateKey)
+			if err != nil {
+				logger.Error("opening shared entry failed:", "error", err, "owner", record.Owner, "name", record.Name)
+				continue
+			}
+			received = append(received, entry)
+		}
+	}
+
+	granted := make([]userType.ShareGrant, 0, len(outgoing))
+	for _, record := range outgoing {
+		granted = append(granted, userType.ShareGrant{Name: record.Name, Recipient: record.Recipient, SharedAt: time.UnixMilli(record.SharedAt)})
+	}
+	return received, granted, nil
+}
+
+func GetSharedEntry(user userType.User, owner string, accountName string, masterKey []byte) (userType.SharedEntry, error) {
+	//returns the named entry shared with the user by its owner
+	received, _, err := GetSharedEntries(user, masterKey)
+	if err != nil {
+		return userType.SharedEntry{}, err
+	}
+	for _, entry := range received {
+		if entry.Owner == owner && entry.Name == accountName {
+			return entry, nil
+		}
+	}
+	return userType.SharedEntry{}, ErrSharedEntryNotFound
+}
@@ -0,0 +1,414 @@
+package backend
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/backend/dbInterface"
+	"passwordManager/internal/userType"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrSyncUserNotFound     = errors.New("the other vault has no user of this name")
+	ErrSyncPasswordRequired = errors.New("the user has another master password in the other vault, pass it with --password")
+	ErrSyncInvalidPassword  = errors.New("wrong master password for the other vault")
+)
+
+// syncSide is one of the two vaults taking part in a sync, with the users entries and tombstones in it.
+type syncSide struct {
+	vault      dbInterface.Vault
+	user       userType.User
+	key        []byte
+	records    map[string]dbInterface.EntryRecord
+	tombstones map[string]int64
+	changes    dbInterface.SyncChanges
+}
+
+// mergedEntry is the version of an entry both vaults end up with, and the side whose key it is encrypted with.
+type mergedEntry struct {
+	record dbInterface.EntryRecord
+	origin *syncSide
+}
+
+func loadSyncSide(vault dbInterface.Vault, user userType.User, key []byte) (*syncSide, error) {
+	records, err := vault.FetchEntryRecords(user.Uid)
+	if err != nil {
+		return nil, err
+	}
+	tombstones, err := vault.FetchTombstones(user.Uid)
+	if err != nil {
+		return nil, err
+	}
+
+	side := &syncSide{vault: vault, user: user, key: key, records: make(map[string]dbInterface.EntryRecord), tombstones: tombstones}
+	for _, record := range records {
+		side.records[record.UUID] = record
+	}
+	side.changes.Tombstones = make(map[string]int64)
+	return side, nil
+}
+
+func otherVaultKey(user userType.User, otherUser userType.User, otherPassword string, otherKeyFile string, masterKey []byte) ([]byte, error) {
+	//a copy of this vault shares the salt and the key hash and so the vault key, a vault set up separately needs its own password
+	if bytes.Equal(user.Salt, otherUser.Salt) && bytes.Equal(user.MasterKeyHash, otherUser.MasterKeyHash) && bytes.Equal(user.WrappedVaultKey, otherUser.WrappedVaultKey) {
+		return masterKey, nil
+	}
+	if len(otherPassword) == 0 {
+		return nil, ErrSyncPasswordRequired
+	}
+
+	keyFileHash, err := userKeyFileHash(otherUser, otherKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(keyFileHash)
+	otherKey, err := crypto.GenkeyWithKeyFile([]byte(otherPassword), keyFileHash, otherUser.Salt)
+	if err != nil {
+		return nil, err
+	}
+	hashedKey, err := crypto.HashPassword(otherKey)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hashedKey, otherUser.MasterKeyHash) {
+		return nil, ErrSyncInvalidPassword
+	}
+	return unwrapVaultKey(otherUser, otherKey)
+}
+
+func reencrypt(data []byte, fromKey []byte, toKey []byte) ([]byte, error) {
+	if len(data) == 0 || bytes.Equal(fromKey, toKey) {
+		return data, nil
+	}
+	plaintext, err := crypto.DecryptPassword(data, fromKey)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.EncryptPassword(plaintext, toKey)
+}
+
+func reencryptRecord(record dbInterface.EntryRecord, fromKey []byte, toKey []byte) (dbInterface.EntryRecord, error) {
+	//returns a copy of the record readable with toKey
+	var err error
+	if record.EncryptedData, err = reencrypt(record.EncryptedData, fromKey, toKey); err != nil {
+		return record, err
+	}
+	if record.EncryptedOTP, err = reencrypt(record.EncryptedOTP, fromKey, toKey); err != nil {
+		return record, err
+	}
+	fields := make([]dbInterface.FieldRecord, len(record.Fields))
+	for i, field := range record.Fields {
+		if field.EncryptedData, err = reencrypt(field.EncryptedData, fromKey, toKey); err != nil {
+			return record, err
+		}
+		fields[i] = field
+	}
+	record.Fields = fields
+	return record, nil
+}
+
+func historyRecord(record dbInterface.EntryRecord, fromKey []byte, toKey []byte, recordedAt int64) (dbInterface.HistoryRecord, error) {
+	//the whole version is kept as one encrypted json document, history is only ever read back as a whole
+	entry, err := decryptEntryRecord(record, fromKey)
+	if err != nil {
+		return dbInterface.HistoryRecord{}, err
+	}
+	plaintext, err := json.Marshal(entry)
+	if err != nil {
+		return dbInterface.HistoryRecord{}, err
+	}
+	encrypted, err := crypto.EncryptPassword(plaintext, toKey)
+	if err != nil {
+		return dbInterface.HistoryRecord{}, err
+	}
+	return dbInterface.HistoryRecord{UUID: record.UUID, Name: record.Name, ModifiedAt: record.ModifiedAt, RecordedAt: recordedAt, EncryptedData: encrypted}, nil
+}
+
+func sameEntryContent(local dbInterface.EntryRecord, localKey []byte, remote dbInterface.EntryRecord, remoteKey []byte) (bool, error) {
+	localEntry, err := decryptEntryRecord(local, localKey)
+	if err != nil {
+		return false, err
+	}
+	remoteEntry, err := decryptEntryRecord(remote, remoteKey)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(localEntry, remoteEntry), nil
+}
+
+func mergeEntry(local *syncSide, remote *syncSide, uuid string, base int64, now int64, report *userType.SyncReport) (*mergedEntry, *mergedEntry, error) {
+	//three way merge of one entry, base is when the two vaults last synced
+	//returns the version both vaults keep, or nil if the entry is deleted, and the losing version of a conflict, if any
+	localRecord, inLocal := local.records[uuid]
+	remoteRecord, inRemote := remote.records[uuid]
+	deletedAt := max(local.tombstones[uuid], remote.tombstones[uuid])
+
+	switch {
+	case inLocal && inRemote:
+		if localRecord.ModifiedAt == remoteRecord.ModifiedAt {
+			if localRecord.ModifiedAt != 0 {
+				return &mergedEntry{localRecord, local}, nil, nil
+			}
+			//entries untouched since before sync was introduced may still differ between two separately kept vaults
+			same, err := sameEntryContent(localRecord, local.key, remoteRecord, remote.key)
+			if err != nil || same {
+				return &mergedEntry{localRecord, local}, nil, err
+			}
+			report.Conflicts = append(report.Conflicts, userType.SyncConflict{Name: localRecord.Name, Resolution: "both vaults had a version of unknown age, kept this vault's"})
+			loser := &mergedEntry{remoteRecord, remote}
+			//the kept version has to look newer, or the other vault would not take it
+			localRecord.ModifiedAt = now
+			return &mergedEntry{localRecord, local}, loser, nil
+		}
+
+		winner, loser := &mergedEntry{localRecord, local}, &mergedEntry{remoteRecord, remote}
+		if remoteRecord.ModifiedAt > localRecord.ModifiedAt {
+			winner, loser = loser, winner
+		}
+		if localRecord.ModifiedAt > base && remoteRecord.ModifiedAt > base {
+			resolution := "changed in both vaults, kept the newer version from this vault"
+			if winner.origin == remote {
+				resolution = "changed in both vaults, kept the newer version from the other vault"
+			}
+			report.Conflicts = append(report.Conflicts, userType.SyncConflict{Name: winner.record.Name, Resolution: resolution})
+			return winner, loser, nil
+		}
+		return winner, nil, nil
+
+	case inLocal || inRemote:
+		present := &mergedEntry{localRecord, local}
+		if inRemote {
+			present = &mergedEntry{remoteRecord, remote}
+		}
+		if deletedAt == 0 {
+			return present, nil, nil
+		}
+		if deletedAt >= present.record.ModifiedAt {
+			return nil, nil, nil
+		}
+		report.Conflicts = append(report.Conflicts, userType.SyncConflict{Name: present.record.Name, Resolution: "changed after it was deleted in the other vault, kept it"})
+		return present, nil, nil
+	}
+	return nil, nil, nil
+}
+
+func resolveNameClashes(merged []*mergedEntry, now int64, report *userType.SyncReport) {
+	//entries created separately in both vaults can share a name, the newer one is renamed
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].record.Name != merged[j].record.Name {
+			return merged[i].record.Name < merged[j].record.Name
+		}
+		if merged[i].record.ModifiedAt != merged[j].record.ModifiedAt {
+			return merged[i].record.ModifiedAt < merged[j].record.ModifiedAt
+		}
+		return merged[i].record.UUID < merged[j].record.UUID
+	})
+
+	taken := make(map[string]bool, len(merged))
+	for _, entry := range merged {
+		taken[entry.record.Name] = true
+	}
+	for i := 1; i < len(merged); i++ {
+		if merged[i].record.Name != merged[i-1].record.Name {
+			continue
+		}
+		name := merged[i].record.Name
+		newName := name
+		for suffix := 2; taken[newName]; suffix++ {
+			newName = name + "-" + strconv.Itoa(suffix)
+		}
+		taken[newName] = true
+		merged[i].record.Name = newName
+		merged[i].record.ModifiedAt = now
+		report.Conflicts = append(report.Conflicts, userType.SyncConflict{Name: name, Resolution: "both vaults had a different entry of this name, renamed one to " + newName})
+	}
+}
+
+func planSideChanges(side *syncSide, merged []*mergedEntry, deletedNames *[]string, upsertedNames *[]string) error {
+	//turns the merged state into the upserts and deletes that bring the vault to it
+	kept := make(map[string]bool, len(merged))
+	for _, entry := range merged {
+		kept[entry.record.UUID] = true
+		current, exists := side.records[entry.record.UUID]
+		if exists && current.ModifiedAt == entry.record.ModifiedAt && current.Name == entry.record.Name {
+			continue
+		}
+		record, err := reencryptRecord(entry.record, entry.origin.key, side.key)
+		if err != nil {
+			return err
+		}
+		side.changes.Upserts = append(side.changes.Upserts, record)
+		*upsertedNames = append(*upsertedNames, record.Name)
+	}
+
+	for uuid, record := range side.records {
+		if !kept[uuid] {
+			side.changes.Deletes = append(side.changes.Deletes, uuid)
+			*deletedNames = append(*deletedNames, record.Name)
+		}
+	}
+	sort.Strings(*deletedNames)
+	return nil
+}
+
+func SyncUserAccounts(user userType.User, otherPath string, otherPassword string, otherKeyFile string, masterKey []byte) (userType.SyncReport, error) {
+	//merges the users entries with the ones of the same user in the vault file at otherPath, both vaults end up with the merged entries
+	//entries are matched by uuid, the newer change wins, deletions travel as tombstones
+	//an entry changed in both vaults since their last sync is a conflict, the losing version is kept in the history of both vaults
+	var report userType.SyncReport
+
+	otherInfo, err := os.Stat(otherPath)
+	if err != nil {
+		return report, err
+	}
+	if localInfo, err := os.Stat(dbInterface.DB_PATH); err == nil && os.SameFile(localInfo, otherInfo) {
+		return report, dbInterface.ErrSameVault
+	}
+
+	remoteVault, err := dbInterface.OpenVault(otherPath)
+	if err != nil {
+		logger.Error("sync failed to open the other vault:", "error", err)
+		return report, err
+	}
+	defer remoteVault.Close()
+
+	remoteUser, err := remoteVault.FetchUser(user.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return report, ErrSyncUserNotFound
+	}
+	if err != nil {
+		logger.Error("sync failed to fetch the other user:", "error", err)
+		return report, fmt.Errorf("internal error, try again later")
+	}
+	remoteKey, err := otherVaultKey(user, remoteUser, otherPassword, otherKeyFile, masterKey)
+	if err != nil {
+		return report, err
+	}
+
+	localVault := dbInterface.LocalVault()
+	localId, err := localVault.VaultId()
+	if err != nil {
+		return report, err
+	}
+	remoteId, err := remoteVault.VaultId()
+	if err != nil {
+		return report, err
+	}
+	base, err := localVault.FetchLastSync(user.Uid, remoteId)
+	if err != nil {
+		return report, err
+	}
+
+	local, err := loadSyncSide(localVault, user, masterKey)
+	if err != nil {
+		logger.Error("sync failed to read this vault:", "error", err)
+		return report, fmt.Errorf("internal error, try again later")
+	}
+	remote, err := loadSyncSide(remoteVault, remoteUser, remoteKey)
+	if err != nil {
+		logger.Error("sync failed to read the other vault:", "error", err)
+		return report, fmt.Errorf("internal error, try again later")
+	}
+
+	uuids := make(map[string]bool)
+	for _, side := range []*syncSide{local, remote} {
+		for uuid := range side.records {
+			uuids[uuid] = true
+		}
+		for uuid, deletedAt := range side.tombstones {
+			uuids[uuid] = true
+			local.changes.Tombstones[uuid] = max(local.changes.Tombstones[uuid], deletedAt)
+			remote.changes.Tombstones[uuid] = max(remote.changes.Tombstones[uuid], deletedAt)
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	merged := make([]*mergedEntry, 0, len(uuids))
+	for uuid := range uuids {
+		winner, loser, err := mergeEntry(local, remote, uuid, base, now, &report)
+		if err != nil {
+			logger.Error("sync failed to merge an entry:", "error", err)
+			return report, fmt.Errorf("internal error, try again later")
+		}
+		if winner != nil {
+			merged = append(merged, winner)
+		}
+		if loser == nil {
+			continue
+		}
+		for _, side := range []*syncSide{local, remote} {
+			history, err := historyRecord(loser.record, loser.origin.key, side.key, now)
+			if err != nil {
+				logger.Error("sync failed to keep a conflicting version:", "error", err)
+				return report, fmt.Errorf("internal error, try again later")
+			}
+			side.changes.History = append(side.changes.History, history)
+		}
+	}
+	resolveNameClashes(merged, now, &report)
+
+	if err := planSideChanges(local, merged, &report.DeletedLocal, &report.Pulled); err != nil {
+		logger.Error("sync failed to prepare this vault:", "error", err)
+		return report, fmt.Errorf("internal error, try again later")
+	}
+	if err := planSideChanges(remote, merged, &report.DeletedRemote, &report.Pushed); err != nil {
+		logger.Error("sync failed to prepare the other vault:", "error", err)
+		return report, fmt.Errorf("internal error, try again later")
+	}
+
+	//the other vault is written first, if writing this one fails the next sync finds the other one already merged
+	remote.changes.PeerId, remote.changes.SyncedAt = localId, now
+	if err := remote.vault.ApplySync(remoteUser.Uid, remote.changes); err != nil {
+		logger.Error("sync failed to write the other vault:", "error", err)
+		return report, fmt.Errorf("failed to write the other vault: %w", err)
+	}
+	local.changes.PeerId, local.changes.SyncedAt = remoteId, now
+	if err := local.vault.ApplySync(user.Uid, local.changes); err != nil {
+		logger.Error("sync failed to write this vault:", "error", err)
+		return report, fmt.Errorf("internal error, try again later")
+	}
+	logger.Info("Synced vaults", "username", user.Name, "other", otherPath, "pulled", len(report.Pulled), "pushed", len(report.Pushed), "conflicts", len(report.Conflicts))
+	//pulled entries kept their row, recipients of a shared one get the synced version
+	names := make([]string, 0, len(local.changes.Upserts))
+	for _, record := range local.changes.Upserts {
+		names = append(names, record.Name)
+	}
+	return report, refreshEntryShares(user, names, masterKey)
+}
+
+func GetEntryHistory(user userType.User, accountName string, masterKey []byte) ([]userType.EntryVersion, error) {
+	//returns the earlier versions of the entry kept by syncs, newest first
+	records, err := dbInterface.FetchEntryHistory(user.Uid, accountName)
+	if err != nil {
+		logger.Error("history fetch failed:", "error", err)
+		return nil, fmt.Errorf("internal error, try again later")
+	}
+
+	versions := make([]userType.EntryVersion, 0, len(records))
+	for _, record := range records {
+		plaintext, err := crypto.DecryptPassword(record.EncryptedData, masterKey)
+		if err != nil {
+			logger.Error("history decryption failed:", "error", err)
+			return nil, fmt.Errorf("internal error, try again later")
+		}
+		var entry userType.VaultEntry
+		if err := json.Unmarshal(plaintext, &entry); err != nil {
+			logger.Error("history decoding failed:", "error", err)
+			return nil, fmt.Errorf("internal error, try again later")
+		}
+		versions = append(versions, userType.EntryVersion{
+			Entry:      entry,
+			ModifiedAt: time.UnixMilli(record.ModifiedAt),
+			RecordedAt: time.UnixMilli(record.RecordedAt),
+		})
+	}
+	return versions, nil
+}
@@ -9,6 +9,8 @@ package backend
 
 import (
 	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"passwordManager/internal/backend/crypto"
@@ -22,10 +24,18 @@ func SetLogger(mainLogger *slog.Logger) {
 	logger = mainLogger
 }
 
+var (
+	ErrAccountNotFound       = errors.New("given account name couldnt be found")
+	ErrAccountExists         = errors.New("an account with this name already exists")
+	ErrInvalidPasswordLength = fmt.Errorf("password length must be between %d and %d", MIN_GEN_PASSWORD_LENGTH, MAX_GEN_PASSWORD_LENGTH)
+)
+
 const SALT_SIZE int = 16
 const GEN_PASSWORD_LENGTH int = 16
+const MIN_GEN_PASSWORD_LENGTH int = 8
+const MAX_GEN_PASSWORD_LENGTH int = 128
 
-func authenticateUser(username string, masterPassword string) (userType.User, []byte, error) {
+func authenticateUser(username string, masterPassword string, keyFile string) (userType.User, []byte, error) {
 	//returns true, the users info, and their generated master key if the given username and password pair is correct, false otherwise
 	// intended to be used as a util function inside the API, for example for first log in, or account deletion, etc.
 	logger.Info("Attempting to authenticate user", "username", username)
@@ -42,7 +52,13 @@ func authenticateUser(username string, masterPassword string) (userType.User, []
 	}
 
 	logger.Debug("User information fetched successfully", "username", username)
-	generatedKey, err := crypto.Genkey([]byte(masterPassword), userInfo.Salt)
+	keyFileHash, err := userKeyFileHash(userInfo, keyFile)
+	if err != nil {
+		logger.Error("authentication failed:", "error", err)
+		return userType.User{}, []byte{}, err
+	}
+	defer clear(keyFileHash)
+	generatedKey, err := crypto.GenkeyWithKeyFile([]byte(masterPassword), keyFileHash, userInfo.Salt)
 	if err != nil {
 		switch err {
 		case crypto.Err0LengthPassword:
@@ -67,13 +83,22 @@ func authenticateUser(username string, masterPassword string) (userType.User, []
 		return userType.User{}, []byte{}, fmt.Errorf("authentication failed: invalid credentials")
 	}
 
+	vaultKey, err := unwrapVaultKey(userInfo, generatedKey)
+	if err != nil {
+		logger.Error("authentication failed: vault key decryption failed", "error", err)
+		return userType.User{}, []byte{}, fmt.Errorf("internal error, try again later")
+	}
+
 	logger.Info("User authenticated successfully", "username", username)
-	return userInfo, generatedKey, nil
+	return userInfo, vaultKey, nil
 }
 
 //Unauthenticated Actions
 
-func AddUser(username string, masterPasswd string) (string, string, error) {
+func AddUser(username string, masterPasswd string, keyFile string) (string, string, string, error) {
+	//returns the username, the master password used and the recovery code of the new user, or a possible error
+	//the recovery code is only ever shown here, an empty one means it could not be created
+	//an empty key file means the master password alone unlocks the vault
 	logger.Info("Attempting to add a new user", "username", username)
 
 	var passwdToUse string
@@ -84,17 +109,28 @@ func AddUser(username string, masterPasswd string) (string, string, error) {
 		passwdToUse = masterPasswd
 	}
 
+	var keyFileHash []byte
+	if len(keyFile) != 0 {
+		hash, err := crypto.HashKeyFile(keyFile)
+		if err != nil {
+			logger.Error("Add user failed: key file unreadable", "error", err)
+			return "", "", "", fmt.Errorf("%w: %w", ErrKeyFileUnreadable, err)
+		}
+		keyFileHash = hash
+		defer clear(keyFileHash)
+	}
+
 	logger.Debug("Generated password to use", "username", username)
 	salt := crypto.GenerateRandomString(SALT_SIZE)
-	key, err := crypto.Genkey([]byte(passwdToUse), []byte(salt))
+	key, err := crypto.GenkeyWithKeyFile([]byte(passwdToUse), keyFileHash, []byte(salt))
 	if err != nil {
 		switch err {
 		case crypto.Err0LengthPassword:
 			logger.Error("authentication failed:", "error", err)
-			return "", "", err
+			return "", "", "", err
 		case crypto.ErrInvalidSalt:
 			logger.Error("authentication failed:", "error", err)
-			return "", "", fmt.Errorf("internal error, try again later")
+			return "", "", "", fmt.Errorf("internal error, try again later")
 		}
 	}
 
@@ -102,32 +138,60 @@ func AddUser(username string, masterPasswd string) (string, string, error) {
 	hashedKey, err := crypto.HashPassword(key)
 	if err != nil {
 		logger.Error("authentication failed:", "error", err)
-		return "", "", err
+		return "", "", "", err
+	}
+
+	//entries are encrypted with a random vault key, the master key only wraps it, so the recovery code can wrap it too
+	vaultKey, err := crypto.GenerateSymmetricKey()
+	if err != nil {
+		logger.Error("vault key generation failed:", "error", err)
+		return "", "", "", fmt.Errorf("internal error, try again later")
+	}
+	wrappedVaultKey, err := crypto.EncryptPassword(vaultKey, key)
+	if err != nil {
+		logger.Error("error in encrypting vault key:", "error", err)
+		return "", "", "", fmt.Errorf("internal error, try again later")
 	}
 
 	logger.Debug("Hashed key successfully", "username", username)
-	inserted_usr, err := dbInterface.InsertUser(username, []byte(salt), hashedKey)
+	inserted_usr, err := dbInterface.InsertUser(username, []byte(salt), hashedKey, wrappedVaultKey, len(keyFileHash) != 0)
 	if err != nil {
 		switch err {
 		case dbInterface.Err0LengthUsername:
 			logger.Error("Add user failed: ", "error", err)
-			return "", "", err
+			return "", "", "", err
 		default:
 			logger.Error("db error:", "error", err)
-			return "", "", fmt.Errorf("internal error, try again later")
+			return "", "", "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	var recoveryCode string
+	if user, err := dbInterface.FetchUser(inserted_usr); err == nil {
+		//the key pair lets others share entries with the user before their first login
+		if err := ensureUserKeyPair(user, vaultKey); err != nil {
+			logger.Error("creating user key pair failed:", "error", err)
+		}
+		if recoveryCode, err = setRecoveryCode(user, vaultKey); err != nil {
+			logger.Error("creating recovery code failed:", "error", err)
 		}
 	}
 
 	logger.Info("User successfully added", "username", inserted_usr)
-	return inserted_usr, passwdToUse, nil
+	return inserted_usr, passwdToUse, recoveryCode, nil
 }
 
-func LogUserIn(username string, masterPassword string) (userType.User, []byte, error) {
-	//returns the user and the users master Key (derived from the master Password) on a successful login, error otherwise
-	user, key, err := authenticateUser(username, masterPassword)
+func LogUserIn(username string, masterPassword string, keyFile string) (userType.User, []byte, error) {
+	//returns the user and the users vault key (unwrapped with the key derived from the master Password) on a successful login, error otherwise
+	//keyFile is the path of the key file of users who set one, empty otherwise
+	user, key, err := authenticateUser(username, masterPassword, keyFile)
 	if err != nil {
 		return userType.User{}, []byte{}, err
 	}
+	if err := ensureUserKeyPair(user, key); err != nil {
+		//sharing is unavailable until a later login manages it, the vault itself is still usable
+		logger.Error("creating user key pair failed:", "error", err)
+	}
 
 	return user, key, nil
 }
@@ -144,7 +208,7 @@ func GetUserAccount(user userType.User, accountName string, userKey []byte) (str
 			return "", "", err
 		default:
 			logger.Error("user account name not found:", "error", err)
-			return "", "", fmt.Errorf("given account name couldnt be found")
+			return "", "", ErrAccountNotFound
 		}
 	}
 
@@ -200,8 +264,8 @@ func AddUserAccount(user userType.User, accountName string, accountUsername stri
 	return acc, string(passwdToUse), nil
 }
 
-func RemoveUser(user userType.User, masterPassword string) (string, error) {
-	_, _, err := authenticateUser(user.Name, masterPassword)
+func RemoveUser(user userType.User, masterPassword string, keyFile string) (string, error) {
+	_, _, err := authenticateUser(user.Name, masterPassword, keyFile)
 	if err != nil {
 		return "", err
 	}
@@ -237,3 +301,48 @@ func RemoveUserAccount(accountName string, user userType.User) (string, error) {
 	return acc, nil
 
 }
+
+func UpdateUserAccount(user userType.User, accountName string, accountUsername string, password string, masterKey []byte) (string, error) {
+	//changes the username and password of an account, an empty value keeps the current one
+	//returns the name of the updated account, or a possible error
+	currentUsername, currentPassword, err := GetUserAccount(user, accountName, masterKey)
+	if err != nil {
+		return "", err
+	}
+	if len(accountUsername) == 0 {
+		accountUsername = currentUsername
+	}
+	if len(password) == 0 {
+		password = currentPassword
+	}
+
+	encryptedPasswd, err := crypto.EncryptPassword([]byte(password), masterKey)
+	if err != nil {
+		logger.Error("error in encrypting password:", "error", err)
+		return "", err
+	}
+
+	acc, err := dbInterface.UpdateUserAccount(user.Uid, accountName, accountUsername, encryptedPasswd)
+	if err != nil {
+		switch err {
+		case dbInterface.Err0LengthUserAccname, dbInterface.Err0LengthUserAccUsername:
+			logger.Error("Update user acc failed:", "error", err)
+			return "", err
+		case sql.ErrNoRows:
+			return "", ErrAccountNotFound
+		default:
+			logger.Error("db error:", "error", err)
+			return "", fmt.Errorf("internal error, try again later")
+		}
+	}
+
+	return acc, refreshEntryShare(user, acc, masterKey)
+}
+
+func GeneratePassword(length int) (string, error) {
+	//returns a random password of the given length drawn from the same characters as generated account passwords
+	if length < MIN_GEN_PASSWORD_LENGTH || length > MAX_GEN_PASSWORD_LENGTH {
+		return "", ErrInvalidPasswordLength
+	}
+	return crypto.GenerateRandomString(length), nil
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend"
+	"strconv"
+)
+
+func backupVault(path string, flags []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("backup path cannot be empty")
+	}
+
+	keep := 0
+	for i := 0; i < len(flags); i += 2 {
+		if i+1 >= len(flags) {
+			return fmt.Errorf("missing value for %s", flags[i])
+		}
+		if flags[i] != "--keep" {
+			return fmt.Errorf("unknown flag %s", flags[i])
+		}
+		n, err := strconv.Atoi(flags[i+1])
+		if err != nil || n < 1 {
+			return backend.ErrInvalidBackupRotation
+		}
+		keep = n
+	}
+
+	manifest, err := backend.BackupVault(path, keep)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up the vault to %s (%d bytes, sha256 %s).\n", path, manifest.Size, manifest.SHA256)
+	return nil
+}
+
+func restoreVault(path string, masterPassword string, keyFile string) error {
+	if len(path) == 0 || len(masterPassword) == 0 {
+		return fmt.Errorf("backup path and master password cannot be empty")
+	}
+
+	manifest, wholeDatabase, err := backend.RestoreVault(currAuthState.user, masterPassword, keyFile, path, currAuthState.masterKey)
+	if err != nil && !errors.Is(err, backend.ErrShareNotRefreshed) {
+		return err
+	}
+	if !wholeDatabase {
+		fmt.Printf("Restored your accounts from the backup of %s, other users were left as they are.\n", manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("The previous database was saved to %s.\n", backend.PRE_RESTORE_BACKUP_PATH)
+		warnStaleShare(err)
+		return nil
+	}
+	fmt.Printf("Restored the vault from the backup of %s.\n", manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("The previous database was saved to %s.\n", backend.PRE_RESTORE_BACKUP_PATH)
+
+	//the restored database may know this user with another password
+	return logout(&currAuthState)
+}
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"passwordManager/internal/backend"
@@ -13,6 +14,8 @@ type authState struct {
 	isAuthenticated bool
 	user            userType.User
 	masterKey       []byte
+	// keyFile is the key file given at login, asked for again along with the master password
+	keyFile string
 }
 
 var currAuthState authState = authState{
@@ -30,7 +33,7 @@ func checkCommandAndAuthStateMatch(cmd string, currAuthState *authState) uint8 {
 		if currAuthState.isAuthenticated {
 			return 2
 		}
-	case "adduser":
+	case "adduser", "recover", "loginshares":
 		if currAuthState.isAuthenticated {
 			return 2
 		}
@@ -58,7 +61,55 @@ func checkCommandAndAuthStateMatch(cmd string, currAuthState *authState) uint8 {
 		if !currAuthState.isAuthenticated {
 			return 1
 		}
-	case "exit", "quit", "help":
+	case "setfield", "getfield", "getfields", "removefield", "ref":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "move", "tag", "untag", "folders", "addfolder", "removefolder":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "import", "export":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "backup", "restore":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "sync", "history":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "search":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "setotp", "otp", "removeotp", "settotp", "totp", "removetotp":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "share", "unshare", "shared", "getshared":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "createorg", "orgs", "addmember", "setrole", "removemember", "members":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "addcollection", "collections", "collect", "collection", "getcollected", "removecollected":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "recoverycode", "splitkey", "setkeyfile":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "addcontact", "removecontact", "contacts", "requestaccess", "denyaccess", "emergencyaccounts", "emergencyget":
+		if !currAuthState.isAuthenticated {
+			return 1
+		}
+	case "exit", "quit", "help", "genkeyfile":
 		return 0
 	default:
 		return 0 // command can be used, should fail in processCommand if command is not recognized
@@ -66,14 +117,14 @@ func checkCommandAndAuthStateMatch(cmd string, currAuthState *authState) uint8 {
 	return 0
 }
 
-func login(username string, password string, currAuthState *authState) error {
+func login(username string, password string, keyFile string, currAuthState *authState) error {
 
 	// input validation
 	if len(username) == 0 || len(password) == 0 {
 		return fmt.Errorf("username and password cannot be empty")
 	}
 
-	account, masterKey, err := backend.LogUserIn(username, password)
+	account, masterKey, err := backend.LogUserIn(username, password, keyFile)
 	if err != nil {
 		return err
 	}
@@ -81,7 +132,9 @@ func login(username string, password string, currAuthState *authState) error {
 	currAuthState.isAuthenticated = true
 	currAuthState.user = account
 	currAuthState.masterKey = masterKey
+	currAuthState.keyFile = keyFile
 	fmt.Println("Login successful.")
+	printEmergencyRequests()
 	return nil
 }
 
@@ -93,20 +146,29 @@ func logout(currAuthState *authState) error {
 	currAuthState.isAuthenticated = false
 	currAuthState.user = userType.User{}
 	currAuthState.masterKey = []byte{}
+	currAuthState.keyFile = ""
 	fmt.Println("Logged out successfully.")
 	return nil
 }
 
-func addUser(username string, masterPassword string) error {
+func addUser(username string, masterPassword string, keyFile string) error {
 
 	if len(username) == 0 || len(masterPassword) == 0 {
 		return fmt.Errorf("username and password cannot be empty")
 	}
-	_, _, err := backend.AddUser(username, masterPassword)
+	_, _, recoveryCode, err := backend.AddUser(username, masterPassword, keyFile)
 	if err != nil {
 		return err
 	}
 	fmt.Println("User added successfully.")
+	if len(keyFile) != 0 {
+		fmt.Println("Log in with login <username> <password> --keyfile", keyFile)
+	}
+	if len(recoveryCode) == 0 {
+		fmt.Println("No recovery code could be created, log in and run recoverycode to get one")
+		return nil
+	}
+	printRecoveryCode(recoveryCode)
 	return nil
 }
 
@@ -119,6 +181,12 @@ func getUserAccount(accountName string) error {
 	accountName = strings.ToLower(accountName)
 
 	accountUsername, accountPassword, err := backend.GetUserAccount(currAuthState.user, accountName, currAuthState.masterKey)
+	if errors.Is(err, backend.ErrAccountNotFound) {
+		suggestions, suggestErr := backend.SuggestUserAccountNames(currAuthState.user, accountName)
+		if suggestErr == nil && len(suggestions) != 0 {
+			return fmt.Errorf("%w, did you mean: %s?", err, strings.Join(suggestions, ", "))
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -127,21 +195,19 @@ func getUserAccount(accountName string) error {
 	return nil
 }
 
-func getUserAccountNames(user userType.User) error {
-	accs, err := backend.GetUserAccountNames(user)
+func getUserAccountNames(user userType.User, folderPath string, tagNames []string) error {
+	accs, err := backend.GetUserAccountSummaries(user, folderPath, tagNames)
 	if err != nil {
 		return err
 	}
 
-	//pretty print the account names retrieved
+	//pretty print the account names retrieved, grouped into their folders
 	if len(accs) == 0 {
 		fmt.Println("No accounts found for the user.")
 		return nil
 	}
 	fmt.Println("User accounts:")
-	for _, acc := range accs {
-		fmt.Println("-", acc)
-	}
+	printAccountTree(accs)
 	fmt.Println("Use getaccount <account_name> to retrieve credentials")
 	return nil
 }
@@ -162,12 +228,12 @@ func addUserAccount(accountName string, accountUsername string, accountPassword
 	return nil
 }
 
-func removeUser(masterPassword string) error {
+func removeUser(masterPassword string, keyFile string) error {
 	if len(masterPassword) == 0 {
 		return fmt.Errorf("master password cannot be empty")
 	}
 
-	account, err := backend.RemoveUser(currAuthState.user, masterPassword)
+	account, err := backend.RemoveUser(currAuthState.user, masterPassword, keyFile)
 	if err != nil {
 		return err
 	}
@@ -192,11 +258,15 @@ func processCommand(cmd string, args []string, currAuthState *authState) bool {
 	// true for continue CLI, false for exit
 	switch cmd {
 	case "login":
-		if len(args) < 3 {
-			fmt.Println("Usage: login <username> <password>")
+		keyFile, ok := "", len(args) >= 3
+		if ok {
+			keyFile, ok = parseKeyFileFlag(args[3:])
+		}
+		if !ok {
+			fmt.Println("Usage: login <username> <password> [--keyfile <path>]")
 			return true
 		}
-		err := login(args[1], args[2], currAuthState)
+		err := login(args[1], args[2], keyFile, currAuthState)
 		if err != nil {
 			fmt.Println("Login failed:", err)
 		}
@@ -208,11 +278,15 @@ func processCommand(cmd string, args []string, currAuthState *authState) bool {
 		}
 
 	case "adduser":
-		if len(args) < 3 {
-			fmt.Println("Usage: adduser <username> <master_password>")
+		keyFile, ok := "", len(args) >= 3
+		if ok {
+			keyFile, ok = parseKeyFileFlag(args[3:])
+		}
+		if !ok {
+			fmt.Println("Usage: adduser <username> <master_password> [--keyfile <path>]")
 			return true
 		}
-		err := addUser(args[1], args[2])
+		err := addUser(args[1], args[2], keyFile)
 		if err != nil {
 			fmt.Println("adduser failed:", err)
 		}
@@ -228,11 +302,12 @@ func processCommand(cmd string, args []string, currAuthState *authState) bool {
 		}
 
 	case "getaccounts":
-		if len(args) > 1 {
-			fmt.Println("Usage: getaccounts")
+		folderPath, tagNames, ok := parseListingFlags(args[1:])
+		if !ok {
+			fmt.Println("Usage: getaccounts [--folder <folder_path>] [--tag <tag>]...")
 			return true
 		}
-		err := getUserAccountNames(currAuthState.user)
+		err := getUserAccountNames(currAuthState.user, folderPath, tagNames)
 		if err != nil {
 			fmt.Println("getaccounts failed:", err)
 		}
@@ -248,11 +323,15 @@ func processCommand(cmd string, args []string, currAuthState *authState) bool {
 		}
 
 	case "removeuser":
-		if len(args) < 2 {
-			fmt.Println("Usage: removeuser <master_password>")
+		keyFile, ok := "", len(args) >= 2
+		if ok {
+			keyFile, ok = sessionKeyFile(args[2:])
+		}
+		if !ok {
+			fmt.Println("Usage: removeuser <master_password> [--keyfile <path>]")
 			return true
 		}
-		err := removeUser(args[1])
+		err := removeUser(args[1], keyFile)
 		if err != nil {
 			fmt.Println("removeuser failed:", err)
 		}
@@ -266,6 +345,510 @@ func processCommand(cmd string, args []string, currAuthState *authState) bool {
 			fmt.Println("removeaccount failed:", err)
 		}
 
+	case "setfield":
+		if len(args) < 5 {
+			fmt.Println("Usage: setfield <account_name> <field_name> <text|hidden|url|email> <value>")
+			return true
+		}
+		err := setEntryField(args[1], args[2], args[3], strings.Join(args[4:], " "))
+		if err != nil {
+			fmt.Println("setfield failed:", err)
+		}
+
+	case "getfield":
+		if len(args) < 3 {
+			fmt.Println("Usage: getfield <account_name> <field_name>")
+			return true
+		}
+		err := getEntryField(args[1], args[2])
+		if err != nil {
+			fmt.Println("getfield failed:", err)
+		}
+
+	case "getfields":
+		if len(args) < 2 {
+			fmt.Println("Usage: getfields <account_name>")
+			return true
+		}
+		err := getEntryFields(args[1])
+		if err != nil {
+			fmt.Println("getfields failed:", err)
+		}
+
+	case "ref":
+		if len(args) < 2 || len(args) > 3 {
+			fmt.Println("Usage: ref <account_name> [username|password|otp|<field_name>]")
+			return true
+		}
+		fieldName := backend.REFERENCE_FIELD_PASSWORD
+		if len(args) == 3 {
+			fieldName = args[2]
+		}
+		err := getSecretReference(args[1], fieldName)
+		if err != nil {
+			fmt.Println("ref failed:", err)
+		}
+
+	case "removefield":
+		if len(args) < 3 {
+			fmt.Println("Usage: removefield <account_name> <field_name>")
+			return true
+		}
+		err := removeEntryField(args[1], args[2])
+		if err != nil {
+			fmt.Println("removefield failed:", err)
+		}
+
+	case "search":
+		if len(args) < 2 {
+			fmt.Println("Usage: search <query>")
+			return true
+		}
+		err := searchUserAccounts(strings.Join(args[1:], " "))
+		if err != nil {
+			fmt.Println("search failed:", err)
+		}
+
+	case "setotp", "settotp":
+		if len(args) < 3 {
+			fmt.Println("Usage: " + cmd + " <account_name> <base32_secret | otpauth_uri> [--type totp|hotp|steam] [--algorithm SHA1|SHA256|SHA512] [--digits 6|8] [--period <seconds>] [--counter <n>]")
+			return true
+		}
+		err := setEntryOTP(args[1], args[2], args[3:])
+		if err != nil {
+			fmt.Println(cmd+" failed:", err)
+		}
+
+	case "otp", "totp":
+		if len(args) < 2 {
+			fmt.Println("Usage: " + cmd + " <account_name>")
+			return true
+		}
+		err := getEntryOTPCode(args[1])
+		if err != nil {
+			fmt.Println(cmd+" failed:", err)
+		}
+
+	case "removeotp", "removetotp":
+		if len(args) < 2 {
+			fmt.Println("Usage: " + cmd + " <account_name>")
+			return true
+		}
+		err := removeEntryOTP(args[1])
+		if err != nil {
+			fmt.Println(cmd+" failed:", err)
+		}
+
+	case "import":
+		if len(args) < 2 {
+			fmt.Println("Usage: import <file> [--format auto|chrome|firefox|bitwarden|kdbx|bundle|pass] [--passphrase <passphrase>] [--duplicates skip|overwrite|rename] [--dry-run]")
+			return true
+		}
+		err := importUserAccounts(args[1], args[2:])
+		if err != nil {
+			fmt.Println("import failed:", err)
+		}
+
+	case "export":
+		if len(args) < 2 {
+			fmt.Println("Usage: export <file> [--format bundle|kdbx|age|pass] [--passphrase <passphrase>] [--age-recipient <age1...>]...")
+			return true
+		}
+		err := exportUserAccounts(args[1], args[2:])
+		if err != nil {
+			fmt.Println("export failed:", err)
+		}
+
+	case "backup":
+		if len(args) < 2 {
+			fmt.Println("Usage: backup <path> [--keep <n>]")
+			return true
+		}
+		err := backupVault(args[1], args[2:])
+		if err != nil {
+			fmt.Println("backup failed:", err)
+		}
+
+	case "restore":
+		keyFile, ok := "", len(args) >= 3
+		if ok {
+			keyFile, ok = sessionKeyFile(args[3:])
+		}
+		if !ok {
+			fmt.Println("Usage: restore <path> <master_password> [--keyfile <path>]")
+			return true
+		}
+		err := restoreVault(args[1], args[2], keyFile)
+		if err != nil {
+			fmt.Println("restore failed:", err)
+		}
+
+	case "sync":
+		if len(args) < 2 {
+			fmt.Println("Usage: sync <other_vault.db> [--password <master_password_in_other_vault>] [--keyfile <key_file_in_other_vault>]")
+			return true
+		}
+		err := syncVault(args[1], args[2:])
+		if err != nil {
+			fmt.Println("sync failed:", err)
+		}
+
+	case "history":
+		if len(args) < 2 {
+			fmt.Println("Usage: history <account_name>")
+			return true
+		}
+		err := getEntryHistory(args[1])
+		if err != nil {
+			fmt.Println("history failed:", err)
+		}
+
+	case "move":
+		if len(args) < 3 {
+			fmt.Println("Usage: move <account_name> <folder_path | />")
+			return true
+		}
+		err := moveUserAccount(args[1], args[2])
+		if err != nil {
+			fmt.Println("move failed:", err)
+		}
+
+	case "tag":
+		if len(args) < 3 {
+			fmt.Println("Usage: tag <account_name> <tag>")
+			return true
+		}
+		err := tagUserAccount(args[1], args[2])
+		if err != nil {
+			fmt.Println("tag failed:", err)
+		}
+
+	case "untag":
+		if len(args) < 3 {
+			fmt.Println("Usage: untag <account_name> <tag>")
+			return true
+		}
+		err := untagUserAccount(args[1], args[2])
+		if err != nil {
+			fmt.Println("untag failed:", err)
+		}
+
+	case "folders":
+		err := getFolders()
+		if err != nil {
+			fmt.Println("folders failed:", err)
+		}
+
+	case "addfolder":
+		if len(args) < 2 {
+			fmt.Println("Usage: addfolder <folder_path>")
+			return true
+		}
+		err := createFolder(args[1])
+		if err != nil {
+			fmt.Println("addfolder failed:", err)
+		}
+
+	case "removefolder":
+		if len(args) < 2 {
+			fmt.Println("Usage: removefolder <folder_path>")
+			return true
+		}
+		err := removeFolder(args[1])
+		if err != nil {
+			fmt.Println("removefolder failed:", err)
+		}
+
+	case "share":
+		if len(args) < 3 {
+			fmt.Println("Usage: share <account_name> <username>")
+			return true
+		}
+		err := shareUserAccount(args[1], args[2])
+		if err != nil {
+			fmt.Println("share failed:", err)
+		}
+
+	case "unshare":
+		if len(args) < 3 {
+			fmt.Println("Usage: unshare <account_name> <username>")
+			return true
+		}
+		err := revokeShare(args[1], args[2])
+		if err != nil {
+			fmt.Println("unshare failed:", err)
+		}
+
+	case "shared":
+		err := getSharedEntries()
+		if err != nil {
+			fmt.Println("shared failed:", err)
+		}
+
+	case "getshared":
+		if len(args) < 3 {
+			fmt.Println("Usage: getshared <owner> <account_name>")
+			return true
+		}
+		err := getSharedEntry(args[1], args[2])
+		if err != nil {
+			fmt.Println("getshared failed:", err)
+		}
+
+	case "createorg":
+		if len(args) < 2 {
+			fmt.Println("Usage: createorg <organization>")
+			return true
+		}
+		err := createOrganization(args[1])
+		if err != nil {
+			fmt.Println("createorg failed:", err)
+		}
+
+	case "orgs":
+		err := getOrganizations()
+		if err != nil {
+			fmt.Println("orgs failed:", err)
+		}
+
+	case "addmember":
+		if len(args) < 4 {
+			fmt.Println("Usage: addmember <organization> <username> <read|write|manage>")
+			return true
+		}
+		err := addOrgMember(args[1], args[2], args[3])
+		if err != nil {
+			fmt.Println("addmember failed:", err)
+		}
+
+	case "setrole":
+		if len(args) < 4 {
+			fmt.Println("Usage: setrole <organization> <username> <read|write|manage>")
+			return true
+		}
+		err := setOrgMemberRole(args[1], args[2], args[3])
+		if err != nil {
+			fmt.Println("setrole failed:", err)
+		}
+
+	case "removemember":
+		if len(args) < 3 {
+			fmt.Println("Usage: removemember <organization> <username>")
+			return true
+		}
+		err := removeOrgMember(args[1], args[2])
+		if err != nil {
+			fmt.Println("removemember failed:", err)
+		}
+
+	case "members":
+		if len(args) < 2 {
+			fmt.Println("Usage: members <organization>")
+			return true
+		}
+		err := getOrgMembers(args[1])
+		if err != nil {
+			fmt.Println("members failed:", err)
+		}
+
+	case "addcollection":
+		if len(args) < 3 {
+			fmt.Println("Usage: addcollection <organization> <collection>")
+			return true
+		}
+		err := createCollection(args[1], args[2])
+		if err != nil {
+			fmt.Println("addcollection failed:", err)
+		}
+
+	case "collections":
+		if len(args) < 2 {
+			fmt.Println("Usage: collections <organization>")
+			return true
+		}
+		err := getCollections(args[1])
+		if err != nil {
+			fmt.Println("collections failed:", err)
+		}
+
+	case "collect":
+		if len(args) < 4 {
+			fmt.Println("Usage: collect <account_name> <organization> <collection>")
+			return true
+		}
+		err := moveAccountToCollection(args[1], args[2], args[3])
+		if err != nil {
+			fmt.Println("collect failed:", err)
+		}
+
+	case "collection":
+		if len(args) < 3 {
+			fmt.Println("Usage: collection <organization> <collection>")
+			return true
+		}
+		err := getCollectionAccounts(args[1], args[2])
+		if err != nil {
+			fmt.Println("collection failed:", err)
+		}
+
+	case "getcollected":
+		if len(args) < 4 {
+			fmt.Println("Usage: getcollected <organization> <collection> <account_name>")
+			return true
+		}
+		err := getCollectionAccount(args[1], args[2], args[3])
+		if err != nil {
+			fmt.Println("getcollected failed:", err)
+		}
+
+	case "removecollected":
+		if len(args) < 4 {
+			fmt.Println("Usage: removecollected <organization> <collection> <account_name>")
+			return true
+		}
+		err := removeCollectionAccount(args[1], args[2], args[3])
+		if err != nil {
+			fmt.Println("removecollected failed:", err)
+		}
+
+	case "addcontact":
+		if len(args) < 3 {
+			fmt.Println("Usage: addcontact <username> <wait_days>")
+			return true
+		}
+		err := addEmergencyContact(args[1], args[2])
+		if err != nil {
+			fmt.Println("addcontact failed:", err)
+		}
+
+	case "removecontact":
+		if len(args) < 2 {
+			fmt.Println("Usage: removecontact <username>")
+			return true
+		}
+		err := removeEmergencyContact(args[1])
+		if err != nil {
+			fmt.Println("removecontact failed:", err)
+		}
+
+	case "contacts":
+		err := getEmergencyContacts()
+		if err != nil {
+			fmt.Println("contacts failed:", err)
+		}
+
+	case "requestaccess":
+		if len(args) < 2 {
+			fmt.Println("Usage: requestaccess <owner>")
+			return true
+		}
+		err := requestEmergencyAccess(args[1])
+		if err != nil {
+			fmt.Println("requestaccess failed:", err)
+		}
+
+	case "denyaccess":
+		if len(args) < 2 {
+			fmt.Println("Usage: denyaccess <username>")
+			return true
+		}
+		err := denyEmergencyAccess(args[1])
+		if err != nil {
+			fmt.Println("denyaccess failed:", err)
+		}
+
+	case "emergencyaccounts":
+		if len(args) < 2 {
+			fmt.Println("Usage: emergencyaccounts <owner>")
+			return true
+		}
+		err := getEmergencyAccounts(args[1])
+		if err != nil {
+			fmt.Println("emergencyaccounts failed:", err)
+		}
+
+	case "emergencyget":
+		if len(args) < 3 {
+			fmt.Println("Usage: emergencyget <owner> <account_name>")
+			return true
+		}
+		err := getEmergencyAccount(args[1], args[2])
+		if err != nil {
+			fmt.Println("emergencyget failed:", err)
+		}
+
+	case "recover":
+		if len(args) < 4 {
+			fmt.Println("Usage: recover <username> <recovery_code> <new_master_password>")
+			return true
+		}
+		err := recoverUser(args[1], args[2], args[3])
+		if err != nil {
+			fmt.Println("recover failed:", err)
+		}
+
+	case "recoverycode":
+		keyFile, ok := "", len(args) >= 2
+		if ok {
+			keyFile, ok = sessionKeyFile(args[2:])
+		}
+		if !ok {
+			fmt.Println("Usage: recoverycode <master_password> [--keyfile <path>]")
+			return true
+		}
+		err := newRecoveryCode(args[1], keyFile)
+		if err != nil {
+			fmt.Println("recoverycode failed:", err)
+		}
+
+	case "splitkey":
+		keyFile, ok := "", len(args) >= 4
+		if ok {
+			keyFile, ok = sessionKeyFile(args[4:])
+		}
+		if !ok {
+			fmt.Println("Usage: splitkey <master_password> <threshold> <shares> [--keyfile <path>]")
+			return true
+		}
+		err := splitVaultKey(args[1], args[2], args[3], keyFile)
+		if err != nil {
+			fmt.Println("splitkey failed:", err)
+		}
+
+	case "setkeyfile":
+		currentKeyFile, ok := "", len(args) >= 3
+		if ok {
+			currentKeyFile, ok = sessionKeyFile(args[3:])
+		}
+		if !ok {
+			fmt.Println("Usage: setkeyfile <master_password> <key_file | none> [--keyfile <current_key_file>]")
+			return true
+		}
+		err := setKeyFile(args[1], args[2], currentKeyFile)
+		if err != nil {
+			fmt.Println("setkeyfile failed:", err)
+		}
+
+	case "genkeyfile":
+		if len(args) < 2 {
+			fmt.Println("Usage: genkeyfile <path>")
+			return true
+		}
+		err := generateKeyFile(args[1])
+		if err != nil {
+			fmt.Println("genkeyfile failed:", err)
+		}
+
+	case "loginshares":
+		if len(args) < 3 {
+			fmt.Println("Usage: loginshares <username> <share> <share>...")
+			return true
+		}
+		err := loginWithShares(args[1], args[2:], currAuthState)
+		if err != nil {
+			fmt.Println("loginshares failed:", err)
+		}
+
 	case "exit", "quit":
 		fmt.Println("Exiting...")
 		return false
@@ -275,16 +858,67 @@ func processCommand(cmd string, args []string, currAuthState *authState) bool {
 			fmt.Println("Available commands:\n" +
 				"  logout\n" +
 				"  getaccount <account_name>\n" +
-				"  getaccounts\n" +
+				"  getaccounts [--folder <folder_path>] [--tag <tag>]...\n" +
+				"  search <query>\n" +
 				"  addaccount <account_name> <account_username> <account_password>\n" +
-				"  removeuser <master_password>\n" +
+				"  removeuser <master_password> [--keyfile <path>]\n" +
+				"  recoverycode <master_password> [--keyfile <path>]\n" +
+				"  splitkey <master_password> <threshold> <shares> [--keyfile <path>]\n" +
+				"  setkeyfile <master_password> <key_file | none> [--keyfile <current_key_file>]\n" +
+				"  genkeyfile <path>\n" +
 				"  removeaccount <account_name>\n" +
+				"  setfield <account_name> <field_name> <text|hidden|url|email> <value>\n" +
+				"  getfield <account_name> <field_name>\n" +
+				"  getfields <account_name>\n" +
+				"  removefield <account_name> <field_name>\n" +
+				"  ref <account_name> [username|password|otp|<field_name>]\n" +
+				"  setotp | settotp <account_name> <base32_secret | otpauth_uri> [--type totp|hotp|steam] [--algorithm <alg>] [--digits <n>] [--period <seconds>] [--counter <n>]\n" +
+				"  otp | totp <account_name>\n" +
+				"  removeotp | removetotp <account_name>\n" +
+				"  import <file> [--format <format>] [--passphrase <passphrase>] [--duplicates skip|overwrite|rename] [--dry-run]\n" +
+				"  export <file> [--format bundle|kdbx|age|pass] [--passphrase <passphrase>] [--age-recipient <age1...>]\n" +
+				"  backup <path> [--keep <n>]\n" +
+				"  restore <path> <master_password> [--keyfile <path>]\n" +
+				"  sync <other_vault.db> [--password <master_password_in_other_vault>] [--keyfile <key_file_in_other_vault>]\n" +
+				"  history <account_name>\n" +
+				"  move <account_name> <folder_path | />\n" +
+				"  tag <account_name> <tag>\n" +
+				"  untag <account_name> <tag>\n" +
+				"  folders\n" +
+				"  addfolder <folder_path>\n" +
+				"  removefolder <folder_path>\n" +
+				"  share <account_name> <username>\n" +
+				"  unshare <account_name> <username>\n" +
+				"  shared\n" +
+				"  getshared <owner> <account_name>\n" +
+				"  createorg <organization>\n" +
+				"  orgs\n" +
+				"  addmember <organization> <username> <read|write|manage>\n" +
+				"  setrole <organization> <username> <read|write|manage>\n" +
+				"  removemember <organization> <username>\n" +
+				"  members <organization>\n" +
+				"  addcollection <organization> <collection>\n" +
+				"  collections <organization>\n" +
+				"  collect <account_name> <organization> <collection>\n" +
+				"  collection <organization> <collection>\n" +
+				"  getcollected <organization> <collection> <account_name>\n" +
+				"  removecollected <organization> <collection> <account_name>\n" +
+				"  addcontact <username> <wait_days>\n" +
+				"  removecontact <username>\n" +
+				"  contacts\n" +
+				"  requestaccess <owner>\n" +
+				"  denyaccess <username>\n" +
+				"  emergencyaccounts <owner>\n" +
+				"  emergencyget <owner> <account_name>\n" +
 				"  exit | quit\n" +
 				"  help")
 		} else {
 			fmt.Println("Available commands:\n" +
-				"  login <username> <password>\n" +
-				"  adduser <username> <master_password>\n" +
+				"  login <username> <password> [--keyfile <path>]\n" +
+				"  adduser <username> <master_password> [--keyfile <path>]\n" +
+				"  genkeyfile <path>\n" +
+				"  recover <username> <recovery_code> <new_master_password>\n" +
+				"  loginshares <username> <share> <share>...\n" +
 				"  exit | quit\n" +
 				"  help")
 		}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+	"passwordManager/internal/userType"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func addEmergencyContact(contact string, waitDays string) error {
+	if len(contact) == 0 || len(waitDays) == 0 {
+		return fmt.Errorf("contact and waiting period cannot be empty")
+	}
+	days, err := strconv.Atoi(waitDays)
+	if err != nil {
+		return fmt.Errorf("waiting period must be a number of days")
+	}
+
+	fingerprint, err := backend.AddEmergencyContact(currAuthState.user, contact, time.Duration(days)*24*time.Hour, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now an emergency contact, they can read your vault %d days after requesting access unless you deny it.\n", contact, days)
+	fmt.Printf("Key fingerprint of %s: %s, check it with them\n", contact, fingerprint)
+	return nil
+}
+
+func removeEmergencyContact(contact string) error {
+	if len(contact) == 0 {
+		return fmt.Errorf("contact cannot be empty")
+	}
+
+	err := backend.RemoveEmergencyContact(currAuthState.user, contact)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is no longer an emergency contact.\n", contact)
+	return nil
+}
+
+func formatEmergencyStatus(contact userType.EmergencyContact) string {
+	switch {
+	case contact.RequestedAt.IsZero():
+		return "no request"
+	case time.Now().Before(contact.AvailableAt):
+		return "requested, granted on " + contact.AvailableAt.Local().Format(SHARED_AT_FORMAT)
+	default:
+		return "access granted since " + contact.AvailableAt.Local().Format(SHARED_AT_FORMAT)
+	}
+}
+
+func getEmergencyContacts() error {
+	contacts, owners, err := backend.GetEmergencyContacts(currAuthState.user)
+	if err != nil {
+		return err
+	}
+
+	if len(contacts) == 0 {
+		fmt.Println("You have no emergency contacts.")
+	} else {
+		fmt.Println("Your emergency contacts:")
+		for _, contact := range contacts {
+			fmt.Printf("- %s (waits %d days, %s)\n", contact.Contact, int(contact.Wait/(24*time.Hour)), formatEmergencyStatus(contact))
+		}
+	}
+
+	if len(owners) == 0 {
+		fmt.Println("You are nobody's emergency contact.")
+	} else {
+		fmt.Println("You are the emergency contact of:")
+		for _, owner := range owners {
+			fmt.Printf("- %s (waits %d days, %s)\n", owner.Owner, int(owner.Wait/(24*time.Hour)), formatEmergencyStatus(owner))
+		}
+	}
+	return nil
+}
+
+func printEmergencyRequests() {
+	//warns the owner at login about contacts asking for their vault, so they can deny in time
+	contacts, _, err := backend.GetEmergencyContacts(currAuthState.user)
+	if err != nil {
+		return
+	}
+	for _, contact := range contacts {
+		if contact.RequestedAt.IsZero() {
+			continue
+		}
+		fmt.Printf("Warning: %s requested emergency access to your vault (%s), use denyaccess %s to refuse\n", contact.Contact, formatEmergencyStatus(contact), contact.Contact)
+	}
+}
+
+func requestEmergencyAccess(owner string) error {
+	if len(owner) == 0 {
+		return fmt.Errorf("owner cannot be empty")
+	}
+
+	availableAt, err := backend.RequestEmergencyAccess(currAuthState.user, owner)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Emergency access to the vault of %s requested, it is granted on %s unless they deny it.\n", owner, availableAt.Local().Format(SHARED_AT_FORMAT))
+	return nil
+}
+
+func denyEmergencyAccess(contact string) error {
+	if len(contact) == 0 {
+		return fmt.Errorf("contact cannot be empty")
+	}
+
+	err := backend.DenyEmergencyAccess(currAuthState.user, contact)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Emergency access of %s denied, they stay a contact and may request again.\n", contact)
+	return nil
+}
+
+func getEmergencyAccounts(owner string) error {
+	if len(owner) == 0 {
+		return fmt.Errorf("owner cannot be empty")
+	}
+
+	accounts, err := backend.GetEmergencyAccountNames(currAuthState.user, owner, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		fmt.Printf("%s has no accounts.\n", owner)
+		return nil
+	}
+	fmt.Printf("Accounts of %s:\n", owner)
+	for _, account := range accounts {
+		fmt.Println("-", account)
+	}
+	return nil
+}
+
+func getEmergencyAccount(owner string, accountName string) error {
+	if len(owner) == 0 || len(accountName) == 0 {
+		return fmt.Errorf("owner and account name cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	entry, err := backend.GetEmergencyAccount(currAuthState.user, owner, accountName, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account %s of %s\nUsername: %s\nPassword: %s\n", entry.Name, owner, entry.Username, entry.Password)
+	for _, field := range entry.Fields {
+		value := field.Value
+		if field.Type == userType.FieldHidden {
+			value = HIDDEN_FIELD_MASK
+		}
+		fmt.Printf("- %s (%s): %s\n", field.Name, field.Type, value)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend"
+	"passwordManager/internal/userType"
+	"strings"
+)
+
+const HIDDEN_FIELD_MASK = "********"
+
+func setEntryField(accountName string, fieldName string, fieldType string, value string) error {
+	if len(accountName) == 0 || len(fieldName) == 0 {
+		return fmt.Errorf("account name and field name cannot be empty")
+	}
+	if len(value) == 0 {
+		return fmt.Errorf("field value cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+	fieldName = strings.ToLower(fieldName)
+
+	field, err := backend.SetEntryField(currAuthState.user, accountName, fieldName, strings.ToLower(fieldType), value, currAuthState.masterKey)
+	if err != nil && !errors.Is(err, backend.ErrShareNotRefreshed) {
+		return err
+	}
+	fmt.Printf("Field %s set on account %s.\n", field, accountName)
+	warnStaleShare(err)
+	return nil
+}
+
+func getEntryField(accountName string, fieldName string) error {
+	if len(accountName) == 0 || len(fieldName) == 0 {
+		return fmt.Errorf("account name and field name cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+	fieldName = strings.ToLower(fieldName)
+
+	field, err := backend.GetEntryField(currAuthState.user, accountName, fieldName, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+
+	//explicitly asking for a single field reveals it, even when hidden
+	fmt.Printf("%s (%s): %s\n", field.Name, field.Type, field.Value)
+	return nil
+}
+
+func getEntryFields(accountName string) error {
+	if len(accountName) == 0 {
+		return fmt.Errorf("account name cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	fields, err := backend.GetEntryFields(currAuthState.user, accountName, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		fmt.Println("No custom fields found for the account.")
+		return nil
+	}
+	fmt.Printf("Fields of %s:\n", accountName)
+	for _, field := range fields {
+		value := field.Value
+		if field.Type == userType.FieldHidden {
+			value = HIDDEN_FIELD_MASK
+		}
+		fmt.Printf("- %s (%s): %s\n", field.Name, field.Type, value)
+	}
+	fmt.Println("Use getfield <account_name> <field_name> to reveal a hidden field")
+	return nil
+}
+
+func removeEntryField(accountName string, fieldName string) error {
+	if len(accountName) == 0 || len(fieldName) == 0 {
+		return fmt.Errorf("account name and field name cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+	fieldName = strings.ToLower(fieldName)
+
+	field, err := backend.RemoveEntryField(currAuthState.user, accountName, fieldName, currAuthState.masterKey)
+	if err != nil && !errors.Is(err, backend.ErrShareNotRefreshed) {
+		return err
+	}
+	fmt.Printf("Field removed successfully. Deleted field: %s\n", field)
+	warnStaleShare(err)
+	return nil
+}
+
+func getSecretReference(accountName string, fieldName string) error {
+	if len(accountName) == 0 {
+		return fmt.Errorf("account name cannot be empty")
+	}
+
+	reference, err := backend.GetSecretReference(currAuthState.user, strings.ToLower(accountName), strings.ToLower(fieldName))
+	if err != nil {
+		return err
+	}
+	fmt.Println(reference)
+	return nil
+}
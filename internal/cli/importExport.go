@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"passwordManager/internal/backend"
+	"passwordManager/internal/userType"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FORMAT_AUTO   = "auto"
+	FORMAT_KDBX   = "kdbx"
+	FORMAT_BUNDLE = "bundle"
+	FORMAT_AGE    = "age"
+	FORMAT_PASS   = "pass"
+)
+
+type transferOptions struct {
+	format          string
+	duplicatePolicy string
+	passphrase      string
+	ageRecipients   []string
+	dryRun          bool
+}
+
+func parseTransferFlags(args []string) (transferOptions, error) {
+	//parses the flags shared by import and export, each command validates the ones it cares about
+	options := transferOptions{format: FORMAT_AUTO, duplicatePolicy: backend.DUPLICATE_SKIP}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--dry-run" {
+			options.dryRun = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return transferOptions{}, fmt.Errorf("missing value for %s", args[i])
+		}
+		switch args[i] {
+		case "--format":
+			options.format = strings.ToLower(args[i+1])
+		case "--duplicates":
+			options.duplicatePolicy = strings.ToLower(args[i+1])
+		case "--passphrase":
+			options.passphrase = args[i+1]
+		case "--age-recipient":
+			options.ageRecipients = append(options.ageRecipients, args[i+1])
+		default:
+			return transferOptions{}, fmt.Errorf("unknown flag %s", args[i])
+		}
+		i++
+	}
+	return options, nil
+}
+
+func detectFileFormat(path string, options transferOptions) string {
+	//an explicit format wins, otherwise age recipients or the file extension decide, anything else is written as a bundle
+	if options.format != FORMAT_AUTO {
+		return options.format
+	}
+	if len(options.ageRecipients) > 0 {
+		return FORMAT_AGE
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".kdbx":
+		return FORMAT_KDBX
+	case ".age":
+		return FORMAT_AGE
+	default:
+		return FORMAT_BUNDLE
+	}
+}
+
+func sniffFileFormat(data []byte, format string) string {
+	//an explicit format wins, otherwise the content decides, since exported files are often renamed
+	if format != FORMAT_AUTO {
+		return format
+	}
+	switch {
+	case backend.IsKDBX(data):
+		return FORMAT_KDBX
+	case backend.IsBundle(data):
+		return FORMAT_BUNDLE
+	case backend.IsAge(data):
+		return FORMAT_AGE
+	default:
+		return FORMAT_AUTO
+	}
+}
+
+func printImportSummary(summary userType.ImportSummary, dryRun bool) {
+	if dryRun {
+		fmt.Println("Dry run, nothing was imported. The import would result in:")
+	} else {
+		fmt.Println("Import finished:")
+	}
+	fmt.Printf("  %d added, %d overwritten, %d renamed, %d skipped\n", len(summary.Added), len(summary.Overwritten), len(summary.Renamed), len(summary.Skipped))
+	for _, name := range summary.Overwritten {
+		fmt.Println("  overwritten:", name)
+	}
+	for _, rename := range summary.Renamed {
+		fmt.Printf("  renamed: %s -> %s\n", rename.From, rename.To)
+	}
+	for _, reason := range summary.Skipped {
+		fmt.Println("  skipped:", reason)
+	}
+}
+
+func readImportFile(data []byte, options transferOptions) ([]userType.VaultEntry, error) {
+	switch format := sniffFileFormat(data, options.format); format {
+	case FORMAT_KDBX:
+		entries, err := backend.ParseKDBX(bytes.NewReader(data), options.passphrase)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Read %d entries from keepass database.\n", len(entries))
+		return entries, nil
+	case FORMAT_BUNDLE:
+		entries, err := backend.ParseBundle(bytes.NewReader(data), options.passphrase)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Read %d entries from vault bundle.\n", len(entries))
+		return entries, nil
+	case FORMAT_AGE:
+		return nil, fmt.Errorf("age files are meant for the recipients only and cannot be imported")
+	default:
+		entries, csvFormat, err := backend.ParseCSVExport(bytes.NewReader(data), format)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Read %d entries from %s export.\n", len(entries), csvFormat)
+		return entries, nil
+	}
+}
+
+func readPassStore(path string) ([]userType.VaultEntry, error) {
+	entries, encrypted, err := backend.ParsePassStore(os.DirFS(path))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Read %d entries from password store.\n", len(entries))
+	if len(encrypted) != 0 {
+		fmt.Printf("Skipped %d gpg encrypted entries, decrypt the store first to import them.\n", len(encrypted))
+	}
+	return entries, nil
+}
+
+func importUserAccounts(path string, flags []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("file path cannot be empty")
+	}
+
+	options, err := parseTransferFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	var entries []userType.VaultEntry
+	if info.IsDir() || options.format == FORMAT_PASS {
+		entries, err = readPassStore(path)
+	} else {
+		var data []byte
+		data, err = os.ReadFile(path)
+		if err == nil {
+			entries, err = readImportFile(data, options)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	summary, err := backend.ImportUserAccounts(currAuthState.user, entries, options.duplicatePolicy, options.dryRun, currAuthState.masterKey)
+	if err != nil && !errors.Is(err, backend.ErrShareNotRefreshed) {
+		return err
+	}
+	printImportSummary(summary, options.dryRun)
+	warnStaleShare(err)
+	return nil
+}
+
+func exportUserAccounts(path string, flags []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("file path cannot be empty")
+	}
+
+	options, err := parseTransferFlags(flags)
+	if err != nil {
+		return err
+	}
+	format := detectFileFormat(path, options)
+	switch format {
+	case FORMAT_BUNDLE, FORMAT_KDBX:
+		if len(options.passphrase) == 0 {
+			return fmt.Errorf("a --passphrase protecting the exported file is required")
+		}
+	case FORMAT_AGE:
+		if len(options.passphrase) == 0 && len(options.ageRecipients) == 0 {
+			return fmt.Errorf("an --age-recipient or a --passphrase protecting the exported file is required")
+		}
+	case FORMAT_PASS:
+		return exportPassStore(path)
+	default:
+		return fmt.Errorf("unknown export format, use --format bundle, kdbx, age or pass")
+	}
+
+	//exports hold every credential of the user, so they are never written over an existing file or readable by others
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	switch format {
+	case FORMAT_KDBX:
+		count, err = backend.ExportUserAccountsKDBX(currAuthState.user, file, options.passphrase, currAuthState.masterKey)
+	case FORMAT_AGE:
+		count, err = backend.ExportUserAccountsAge(currAuthState.user, file, options.ageRecipients, options.passphrase, currAuthState.masterKey)
+	default:
+		count, err = backend.ExportUserAccountsBundle(currAuthState.user, file, options.passphrase, currAuthState.masterKey)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	fmt.Printf("Exported %d accounts to %s.\n", count, path)
+	return nil
+}
+
+func exportPassStore(path string) error {
+	count, err := backend.ExportUserAccountsPass(currAuthState.user, path, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d accounts to %s.\n", count, path)
+	fmt.Println("The entries are stored unencrypted, encrypt them with pass or delete the directory once you are done with it.")
+	return nil
+}
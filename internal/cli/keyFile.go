@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+)
+
+func parseKeyFileFlag(flags []string) (string, bool) {
+	//returns the path given with --keyfile, empty if the flag is absent, false on anything else
+	if len(flags) == 0 {
+		return "", true
+	}
+	if len(flags) != 2 || flags[0] != "--keyfile" || len(flags[1]) == 0 {
+		return "", false
+	}
+	return flags[1], true
+}
+
+func sessionKeyFile(flags []string) (string, bool) {
+	//like parseKeyFileFlag, but without the flag falls back to the key file the session was unlocked with
+	//a session unlocked with shares has none, its key file users pass it to confirm their master password
+	keyFile, ok := parseKeyFileFlag(flags)
+	if ok && len(keyFile) == 0 {
+		keyFile = currAuthState.keyFile
+	}
+	return keyFile, ok
+}
+
+func generateKeyFile(path string) error {
+	if err := backend.GenerateKeyFile(path); err != nil {
+		return err
+	}
+	fmt.Println("Key file written to", path)
+	fmt.Println("Keep a copy of it somewhere safe, the vault of a user who sets it cannot be unlocked without it")
+	return nil
+}
+
+func setKeyFile(masterPassword string, keyFile string, currentKeyFile string) error {
+	if len(masterPassword) == 0 || len(keyFile) == 0 {
+		return fmt.Errorf("master password and key file cannot be empty")
+	}
+	//none removes the key file requirement
+	if keyFile == "none" {
+		keyFile = ""
+	}
+
+	user, err := backend.SetKeyFile(currAuthState.user, masterPassword, currentKeyFile, keyFile, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	currAuthState.user = user
+	currAuthState.keyFile = keyFile
+	if len(keyFile) == 0 {
+		fmt.Println("Key file removed, the master password alone unlocks the vault.")
+		return nil
+	}
+	fmt.Println("Key file set, log in with login <username> <password> --keyfile", keyFile)
+	return nil
+}
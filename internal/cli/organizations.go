@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+	"passwordManager/internal/userType"
+	"strings"
+)
+
+func createOrganization(organization string) error {
+	if len(organization) == 0 {
+		return fmt.Errorf("organization name cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+
+	name, err := backend.CreateOrganization(currAuthState.user, organization)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Organization %s created, you manage it.\n", name)
+	return nil
+}
+
+func getOrganizations() error {
+	organizations, err := backend.GetOrganizations(currAuthState.user)
+	if err != nil {
+		return err
+	}
+	if len(organizations) == 0 {
+		fmt.Println("You are not a member of any organization.")
+		return nil
+	}
+	fmt.Println("Organizations:")
+	for _, organization := range organizations {
+		fmt.Printf("- %s (%s)\n", organization.Name, organization.Role)
+	}
+	return nil
+}
+
+func addOrgMember(organization string, member string, role string) error {
+	if len(organization) == 0 || len(member) == 0 || len(role) == 0 {
+		return fmt.Errorf("organization, username and role cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+
+	fingerprint, err := backend.AddOrgMember(currAuthState.user, organization, member, strings.ToLower(role), currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s added to %s with the %s role.\n", member, organization, strings.ToLower(role))
+	fmt.Printf("Key fingerprint of %s: %s, check it with them before moving anything sensitive into the organization\n", member, fingerprint)
+	return nil
+}
+
+func setOrgMemberRole(organization string, member string, role string) error {
+	if len(organization) == 0 || len(member) == 0 || len(role) == 0 {
+		return fmt.Errorf("organization, username and role cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+
+	err := backend.SetOrgMemberRole(currAuthState.user, organization, member, strings.ToLower(role))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s now has the %s role in %s.\n", member, strings.ToLower(role), organization)
+	return nil
+}
+
+func removeOrgMember(organization string, member string) error {
+	if len(organization) == 0 || len(member) == 0 {
+		return fmt.Errorf("organization and username cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+
+	err := backend.RemoveOrgMember(currAuthState.user, organization, member, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s removed from %s, its collections have new keys.\n", member, organization)
+	return nil
+}
+
+func getOrgMembers(organization string) error {
+	if len(organization) == 0 {
+		return fmt.Errorf("organization name cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+
+	members, err := backend.GetOrgMembers(currAuthState.user, organization)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Members of %s:\n", organization)
+	for _, member := range members {
+		fmt.Printf("- %s (%s)\n", member.Username, member.Role)
+	}
+	return nil
+}
+
+func createCollection(organization string, collection string) error {
+	if len(organization) == 0 || len(collection) == 0 {
+		return fmt.Errorf("organization and collection name cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+	collection = strings.ToLower(collection)
+
+	name, err := backend.CreateCollection(currAuthState.user, organization, collection)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Collection %s created in %s.\n", name, organization)
+	return nil
+}
+
+func getCollections(organization string) error {
+	if len(organization) == 0 {
+		return fmt.Errorf("organization name cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+
+	collections, err := backend.GetCollections(currAuthState.user, organization)
+	if err != nil {
+		return err
+	}
+	if len(collections) == 0 {
+		fmt.Println("The organization has no collections.")
+		return nil
+	}
+	fmt.Printf("Collections of %s:\n", organization)
+	for _, collection := range collections {
+		fmt.Printf("- %s (%d accounts)\n", collection.Name, collection.Entries)
+	}
+	return nil
+}
+
+func moveAccountToCollection(accountName string, organization string, collection string) error {
+	if len(accountName) == 0 || len(organization) == 0 || len(collection) == 0 {
+		return fmt.Errorf("account name, organization and collection cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+	organization = strings.ToLower(organization)
+	collection = strings.ToLower(collection)
+
+	acc, err := backend.MoveAccountToCollection(currAuthState.user, accountName, organization, collection, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account %s moved to %s/%s.\n", acc, organization, collection)
+	return nil
+}
+
+func getCollectionAccounts(organization string, collection string) error {
+	if len(organization) == 0 || len(collection) == 0 {
+		return fmt.Errorf("organization and collection cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+	collection = strings.ToLower(collection)
+
+	entries, err := backend.GetCollectionAccounts(currAuthState.user, organization, collection, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("The collection has no accounts.")
+		return nil
+	}
+	fmt.Printf("Accounts in %s/%s:\n", organization, collection)
+	for _, entry := range entries {
+		fmt.Printf("- %s (username: %s)\n", entry.Name, entry.Username)
+	}
+	return nil
+}
+
+func getCollectionAccount(organization string, collection string, accountName string) error {
+	if len(organization) == 0 || len(collection) == 0 || len(accountName) == 0 {
+		return fmt.Errorf("organization, collection and account name cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+	collection = strings.ToLower(collection)
+	accountName = strings.ToLower(accountName)
+
+	entry, err := backend.GetCollectionAccount(currAuthState.user, organization, collection, accountName, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account %s in %s/%s\nUsername: %s\nPassword: %s\n", entry.Name, organization, collection, entry.Username, entry.Password)
+	if len(entry.Folder) != 0 {
+		fmt.Println("Folder:", entry.Folder)
+	}
+	if len(entry.Tags) != 0 {
+		fmt.Println("Tags:", strings.Join(entry.Tags, ", "))
+	}
+	if len(entry.OTP) != 0 {
+		fmt.Println("OTP secret:", entry.OTP)
+	}
+	for _, field := range entry.Fields {
+		value := field.Value
+		if field.Type == userType.FieldHidden {
+			value = HIDDEN_FIELD_MASK
+		}
+		fmt.Printf("- %s (%s): %s\n", field.Name, field.Type, value)
+	}
+	return nil
+}
+
+func removeCollectionAccount(organization string, collection string, accountName string) error {
+	if len(organization) == 0 || len(collection) == 0 || len(accountName) == 0 {
+		return fmt.Errorf("organization, collection and account name cannot be empty")
+	}
+
+	organization = strings.ToLower(organization)
+	collection = strings.ToLower(collection)
+	accountName = strings.ToLower(accountName)
+
+	acc, err := backend.RemoveCollectionAccount(currAuthState.user, organization, collection, accountName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account %s removed from %s/%s.\n", acc, organization, collection)
+	return nil
+}
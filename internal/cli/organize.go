@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+	"passwordManager/internal/userType"
+	"sort"
+	"strings"
+)
+
+type folderNode struct {
+	accounts []userType.AccountSummary
+	children map[string]*folderNode
+}
+
+func parseListingFlags(args []string) (string, []string, bool) {
+	//parses --folder <path> and any number of --tag <tag> flags
+	//returns the folder, the tags, and false if the flags are malformed
+	folderPath := ""
+	tagNames := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return "", nil, false
+		}
+		switch args[i] {
+		case "--folder":
+			folderPath = strings.ToLower(args[i+1])
+		case "--tag":
+			tagNames = append(tagNames, strings.ToLower(args[i+1]))
+		default:
+			return "", nil, false
+		}
+		i++
+	}
+	return folderPath, tagNames, true
+}
+
+func printAccountTree(accs []userType.AccountSummary) {
+	root := &folderNode{children: map[string]*folderNode{}}
+	for _, acc := range accs {
+		node := root
+		if len(acc.Folder) != 0 {
+			for _, segment := range strings.Split(acc.Folder, "/") {
+				child, ok := node.children[segment]
+				if !ok {
+					child = &folderNode{children: map[string]*folderNode{}}
+					node.children[segment] = child
+				}
+				node = child
+			}
+		}
+		node.accounts = append(node.accounts, acc)
+	}
+	printFolderNode(root, "")
+}
+
+func printFolderNode(node *folderNode, indent string) {
+	//accounts of a folder are printed before its subfolders
+	for _, acc := range node.accounts {
+		if len(acc.Tags) == 0 {
+			fmt.Printf("%s- %s\n", indent, acc.Name)
+		} else {
+			fmt.Printf("%s- %s [%s]\n", indent, acc.Name, strings.Join(acc.Tags, ", "))
+		}
+	}
+
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s%s/\n", indent, name)
+		printFolderNode(node.children[name], indent+"  ")
+	}
+}
+
+func moveUserAccount(accountName string, folderPath string) error {
+	if len(accountName) == 0 {
+		return fmt.Errorf("account name cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	folder, err := backend.MoveUserAccount(currAuthState.user, accountName, strings.ToLower(folderPath))
+	if err != nil {
+		return err
+	}
+	if len(folder) == 0 {
+		fmt.Printf("Account %s moved to the root.\n", accountName)
+	} else {
+		fmt.Printf("Account %s moved to %s.\n", accountName, folder)
+	}
+	return nil
+}
+
+func tagUserAccount(accountName string, tagName string) error {
+	if len(accountName) == 0 || len(tagName) == 0 {
+		return fmt.Errorf("account name and tag cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	tag, err := backend.TagUserAccount(currAuthState.user, accountName, strings.ToLower(tagName))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account %s tagged with %s.\n", accountName, tag)
+	return nil
+}
+
+func untagUserAccount(accountName string, tagName string) error {
+	if len(accountName) == 0 || len(tagName) == 0 {
+		return fmt.Errorf("account name and tag cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	tag, err := backend.UntagUserAccount(currAuthState.user, accountName, strings.ToLower(tagName))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Tag %s removed from account %s.\n", tag, accountName)
+	return nil
+}
+
+func getFolders() error {
+	folders, err := backend.GetFolders(currAuthState.user)
+	if err != nil {
+		return err
+	}
+
+	if len(folders) == 0 {
+		fmt.Println("No folders found for the user.")
+		return nil
+	}
+	fmt.Println("Folders:")
+	for _, folder := range folders {
+		depth := strings.Count(folder, "/")
+		fmt.Printf("%s%s/\n", strings.Repeat("  ", depth), folder[strings.LastIndex(folder, "/")+1:])
+	}
+	return nil
+}
+
+func createFolder(folderPath string) error {
+	if len(folderPath) == 0 {
+		return fmt.Errorf("folder path cannot be empty")
+	}
+
+	folder, err := backend.CreateFolder(currAuthState.user, strings.ToLower(folderPath))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Folder %s created.\n", folder)
+	return nil
+}
+
+func removeFolder(folderPath string) error {
+	if len(folderPath) == 0 {
+		return fmt.Errorf("folder path cannot be empty")
+	}
+
+	folder, err := backend.RemoveFolder(currAuthState.user, strings.ToLower(folderPath))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Folder removed successfully. Deleted folder: %s\n", folder)
+	return nil
+}
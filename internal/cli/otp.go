@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+	"strconv"
+	"strings"
+)
+
+func setEntryOTP(accountName string, secret string, flags []string) error {
+	if len(accountName) == 0 || len(secret) == 0 {
+		return fmt.Errorf("account name and secret cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	config, err := backend.ParseOTPSecret(secret)
+	if err != nil {
+		return err
+	}
+
+	//flags override whatever the otpauth uri specified
+	for i := 0; i < len(flags); i += 2 {
+		if i+1 >= len(flags) {
+			return fmt.Errorf("missing value for %s", flags[i])
+		}
+		switch flags[i] {
+		case "--type":
+			config.Kind = strings.ToLower(flags[i+1])
+		case "--counter":
+			if config.Counter, err = strconv.ParseUint(flags[i+1], 10, 64); err != nil {
+				return fmt.Errorf("counter must be a non-negative number")
+			}
+		case "--algorithm":
+			config.Algorithm = strings.ToUpper(flags[i+1])
+		case "--digits":
+			if config.Digits, err = strconv.Atoi(flags[i+1]); err != nil {
+				return fmt.Errorf("digits must be a number")
+			}
+		case "--period":
+			if config.Period, err = strconv.Atoi(flags[i+1]); err != nil {
+				return fmt.Errorf("period must be a number of seconds")
+			}
+		default:
+			return fmt.Errorf("unknown flag %s", flags[i])
+		}
+	}
+
+	acc, err := backend.SetEntryOTP(currAuthState.user, accountName, config, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s secret stored on account %s.\n", strings.ToUpper(config.Kind), acc)
+	return nil
+}
+
+func getEntryOTPCode(accountName string) error {
+	if len(accountName) == 0 {
+		return fmt.Errorf("account name cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	code, err := backend.GetEntryOTPCode(currAuthState.user, accountName, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	if code.Kind == backend.OTP_KIND_HOTP {
+		fmt.Printf("Code: %s (counter %d)\n", code.Code, code.Counter)
+	} else {
+		fmt.Printf("Code: %s (valid for %ds)\n", code.Code, code.Remaining)
+	}
+	return nil
+}
+
+func removeEntryOTP(accountName string) error {
+	if len(accountName) == 0 {
+		return fmt.Errorf("account name cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	acc, err := backend.RemoveEntryOTP(currAuthState.user, accountName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("OTP secret removed from account %s.\n", acc)
+	return nil
+}
@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+)
+
+func printRecoveryCode(code string) {
+	fmt.Println("Recovery code:", code)
+	fmt.Println("Write it down and keep it offline, it is shown only this once and resets your master password with recover")
+}
+
+func recoverUser(username string, recoveryCode string, newMasterPassword string) error {
+	if len(username) == 0 || len(recoveryCode) == 0 || len(newMasterPassword) == 0 {
+		return fmt.Errorf("username, recovery code and new master password cannot be empty")
+	}
+
+	newCode, err := backend.RecoverUser(username, recoveryCode, newMasterPassword)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Master password replaced, you can now log in with it. The used recovery code no longer works.")
+	fmt.Println("If a key file was set it is no longer needed, set one again with setkeyfile after logging in")
+	printRecoveryCode(newCode)
+	return nil
+}
+
+func newRecoveryCode(masterPassword string, keyFile string) error {
+	if len(masterPassword) == 0 {
+		return fmt.Errorf("master password cannot be empty")
+	}
+
+	code, err := backend.NewRecoveryCode(currAuthState.user, masterPassword, keyFile, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Println("New recovery code created, the previous one no longer works.")
+	printRecoveryCode(code)
+	return nil
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+)
+
+func searchUserAccounts(query string) error {
+	if len(query) == 0 {
+		return fmt.Errorf("search query cannot be empty")
+	}
+
+	results, err := backend.SearchUserAccounts(currAuthState.user, query, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No accounts matched the query.")
+		return nil
+	}
+	fmt.Println("Matching accounts:")
+	for _, result := range results {
+		location := result.Account.Name
+		if len(result.Account.Folder) != 0 {
+			location = result.Account.Folder + "/" + result.Account.Name
+		}
+		fmt.Printf("- %s (username: %s, matched on %s)\n", location, result.Account.Username, result.MatchedOn)
+	}
+	fmt.Println("Use getaccount <account_name> to retrieve credentials")
+	return nil
+}
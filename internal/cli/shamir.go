@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+	"strconv"
+)
+
+func splitVaultKey(masterPassword string, threshold string, shares string, keyFile string) error {
+	if len(masterPassword) == 0 {
+		return fmt.Errorf("master password cannot be empty")
+	}
+	thresholdCount, err := strconv.Atoi(threshold)
+	if err != nil {
+		return fmt.Errorf("threshold must be a number")
+	}
+	shareCount, err := strconv.Atoi(shares)
+	if err != nil {
+		return fmt.Errorf("number of shares must be a number")
+	}
+
+	printable, err := backend.SplitVaultKey(currAuthState.user, masterPassword, keyFile, thresholdCount, shareCount, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Vault key split into %d shares, any %d of them unlock the vault with loginshares.\n", shareCount, thresholdCount)
+	fmt.Println("Give each share to a different person, they stay valid for as long as the vault exists")
+	for i, share := range printable {
+		fmt.Printf("Share %d of %d: %s\n", i+1, shareCount, share)
+	}
+	return nil
+}
+
+func loginWithShares(username string, shares []string, currAuthState *authState) error {
+	if len(username) == 0 || len(shares) == 0 {
+		return fmt.Errorf("username and shares cannot be empty")
+	}
+
+	account, masterKey, err := backend.LogUserInWithShares(username, shares)
+	if err != nil {
+		return err
+	}
+
+	currAuthState.isAuthenticated = true
+	currAuthState.user = account
+	currAuthState.masterKey = masterKey
+	currAuthState.keyFile = ""
+	fmt.Println("Login successful.")
+	printEmergencyRequests()
+	return nil
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"passwordManager/internal/backend"
+	"passwordManager/internal/userType"
+	"strings"
+)
+
+const SHARED_AT_FORMAT = "2006-01-02 15:04"
+
+func shareUserAccount(accountName string, recipient string) error {
+	if len(accountName) == 0 || len(recipient) == 0 {
+		return fmt.Errorf("account name and recipient cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	fingerprint, err := backend.ShareUserAccount(currAuthState.user, accountName, recipient, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account %s shared with %s.\n", accountName, recipient)
+	fmt.Printf("Key fingerprint of %s: %s, check it with them and revoke the share with unshare if it does not match\n", recipient, fingerprint)
+	return nil
+}
+
+func revokeShare(accountName string, recipient string) error {
+	if len(accountName) == 0 || len(recipient) == 0 {
+		return fmt.Errorf("account name and recipient cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	err := backend.RevokeShare(currAuthState.user, accountName, recipient, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account %s is no longer shared with %s.\n", accountName, recipient)
+	fmt.Println("Anything they already read stays known to them, change the password if that matters")
+	return nil
+}
+
+func getSharedEntries() error {
+	received, granted, err := backend.GetSharedEntries(currAuthState.user, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := backend.GetKeyFingerprint(currAuthState.user.Name)
+	if err == nil {
+		fmt.Println("Your key fingerprint:", fingerprint)
+	}
+
+	if len(received) == 0 {
+		fmt.Println("No accounts are shared with you.")
+	} else {
+		fmt.Println("Shared with you:")
+		for _, entry := range received {
+			fmt.Printf("- %s/%s (username: %s, since %s)\n", entry.Owner, entry.Name, entry.Username, entry.SharedAt.Local().Format(SHARED_AT_FORMAT))
+		}
+	}
+
+	if len(granted) == 0 {
+		fmt.Println("You share no accounts.")
+	} else {
+		fmt.Println("Shared by you:")
+		for _, grant := range granted {
+			fmt.Printf("- %s with %s (since %s)\n", grant.Name, grant.Recipient, grant.SharedAt.Local().Format(SHARED_AT_FORMAT))
+		}
+	}
+	return nil
+}
+
+func getSharedEntry(owner string, accountName string) error {
+	if len(owner) == 0 || len(accountName) == 0 {
+		return fmt.Errorf("owner and account name cannot be empty")
+	}
+
+	accountName = strings.ToLower(accountName)
+
+	entry, err := backend.GetSharedEntry(currAuthState.user, owner, accountName, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account %s shared by %s\nUsername: %s\nPassword: %s\n", entry.Name, entry.Owner, entry.Username, entry.Password)
+	for _, field := range entry.Fields {
+		value := field.Value
+		if field.Type == userType.FieldHidden {
+			value = HIDDEN_FIELD_MASK
+		}
+		fmt.Printf("- %s (%s): %s\n", field.Name, field.Type, value)
+	}
+	return nil
+}
+
+func warnStaleShare(err error) {
+	//the change went through, only the copy its recipients see is out of date
+	if err != nil {
+		fmt.Println("Warning:", err)
+	}
+}
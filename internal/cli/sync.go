@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"passwordManager/internal/backend"
+	"strings"
+)
+
+func syncVault(path string, flags []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("vault path cannot be empty")
+	}
+
+	otherPassword, otherKeyFile := "", ""
+	for i := 0; i < len(flags); i += 2 {
+		if i+1 >= len(flags) {
+			return fmt.Errorf("missing value for %s", flags[i])
+		}
+		switch flags[i] {
+		case "--password":
+			otherPassword = flags[i+1]
+		case "--keyfile":
+			otherKeyFile = flags[i+1]
+		default:
+			return fmt.Errorf("unknown flag %s", flags[i])
+		}
+	}
+
+	report, err := backend.SyncUserAccounts(currAuthState.user, path, otherPassword, otherKeyFile, currAuthState.masterKey)
+	if err != nil && !errors.Is(err, backend.ErrShareNotRefreshed) {
+		return err
+	}
+	defer warnStaleShare(err)
+
+	fmt.Printf("Synced with %s: %d pulled, %d pushed, %d deleted here, %d deleted there, %d conflicts\n",
+		path, len(report.Pulled), len(report.Pushed), len(report.DeletedLocal), len(report.DeletedRemote), len(report.Conflicts))
+	if len(report.Pulled) != 0 {
+		fmt.Println("  pulled:", strings.Join(report.Pulled, ", "))
+	}
+	if len(report.Pushed) != 0 {
+		fmt.Println("  pushed:", strings.Join(report.Pushed, ", "))
+	}
+	if len(report.DeletedLocal) != 0 {
+		fmt.Println("  deleted here:", strings.Join(report.DeletedLocal, ", "))
+	}
+	if len(report.DeletedRemote) != 0 {
+		fmt.Println("  deleted there:", strings.Join(report.DeletedRemote, ", "))
+	}
+	for _, conflict := range report.Conflicts {
+		fmt.Printf("  conflict on %s: %s\n", conflict.Name, conflict.Resolution)
+	}
+	if len(report.Conflicts) != 0 {
+		fmt.Println("Use history <account_name> to see the versions that were replaced")
+	}
+	return nil
+}
+
+func getEntryHistory(accountName string) error {
+	if len(accountName) == 0 {
+		return fmt.Errorf("account name cannot be empty")
+	}
+	accountName = strings.ToLower(accountName)
+
+	versions, err := backend.GetEntryHistory(currAuthState.user, accountName, currAuthState.masterKey)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		fmt.Println("No earlier versions of", accountName)
+		return nil
+	}
+
+	fmt.Println("Earlier versions of " + accountName + ":")
+	for _, version := range versions {
+		fmt.Printf("- replaced %s, last changed %s\n", version.RecordedAt.Format("2006-01-02 15:04:05"), version.ModifiedAt.Format("2006-01-02 15:04:05"))
+		fmt.Println("  Name:", version.Entry.Name)
+		fmt.Println("  Username:", version.Entry.Username)
+		fmt.Println("  Password:", version.Entry.Password)
+		if len(version.Entry.URL) != 0 {
+			fmt.Println("  URL:", version.Entry.URL)
+		}
+		if len(version.Entry.Notes) != 0 {
+			fmt.Println("  Notes:", version.Entry.Notes)
+		}
+		for _, field := range version.Entry.Fields {
+			fmt.Printf("  %s: %s\n", field.Name, field.Value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"passwordManager/internal/backend"
+	"passwordManager/internal/userType"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The request and response bodies below are described by schema.json, served at /v1/schema.
+
+//go:embed schema.json
+var schemaDocument []byte
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	KeyFile  string `json:"key_file,omitempty"`
+}
+
+type loginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type entrySummary struct {
+	Name     string   `json:"name"`
+	Username string   `json:"username"`
+	Folder   string   `json:"folder,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+type entryResponse struct {
+	Name     string                `json:"name"`
+	Username string                `json:"username"`
+	Password string                `json:"password"`
+	Fields   []userType.EntryField `json:"fields"`
+}
+
+type addEntryRequest struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	// Password is generated when empty
+	Password string `json:"password,omitempty"`
+}
+
+type updateEntryRequest struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type passwordResponse struct {
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password"`
+	KeyFile  string `json:"key_file,omitempty"`
+}
+
+type resolveResponse struct {
+	Reference string `json:"reference"`
+	Value     string `json:"value"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(body)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	//the backend reports its own failures as internal errors and everything else as a problem with the request
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, ErrInvalidSession):
+		status = http.StatusUnauthorized
+	case errors.Is(err, backend.ErrAccountNotFound), errors.Is(err, backend.ErrReferenceNoEntry):
+		status = http.StatusNotFound
+	case errors.Is(err, backend.ErrAccountExists):
+		status = http.StatusConflict
+	case strings.HasPrefix(err.Error(), "internal error"), errors.Is(err, backend.ErrShareNotRefreshed):
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func decodeBody(r *http.Request, body any) error {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return fmt.Errorf("request body must be application/json")
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func bearerToken(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticatedHandler is served with the user of the session and the unwrapped master key,
+// which is cleared as soon as the handler returns.
+type authenticatedHandler func(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte)
+
+func (srv *apiServer) authenticated(handler authenticatedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, masterKey, err := srv.sessions.unwrap(bearerToken(r))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer clear(masterKey)
+		handler(w, r, user, masterKey)
+	}
+}
+
+func (srv *apiServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var request loginRequest
+	if err := decodeBody(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(request.Username) == 0 || len(request.Password) == 0 {
+		writeError(w, fmt.Errorf("username and password cannot be empty"))
+		return
+	}
+
+	//logins are serialized and a username failing again and again is slowed down
+	wait, err := srv.logins.enter(r.Context(), request.Username)
+	if err != nil {
+		if errors.Is(err, ErrLoginBackoff) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: err.Error()})
+		}
+		return
+	}
+	user, masterKey, err := backend.LogUserIn(request.Username, request.Password, request.KeyFile)
+	srv.logins.leave(request.Username, err == nil)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: err.Error()})
+		return
+	}
+	defer clear(masterKey)
+
+	token, expiresAt, err := srv.sessions.create(user, masterKey)
+	if err != nil {
+		writeError(w, fmt.Errorf("internal error, try again later"))
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{Token: token, ExpiresAt: expiresAt.UTC()})
+}
+
+func (srv *apiServer) handleLogout(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte) {
+	srv.sessions.remove(bearerToken(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *apiServer) handleListEntries(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte) {
+	query := r.URL.Query()
+	summaries, err := backend.GetUserAccountSummaries(user, query.Get("folder"), query["tag"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	entries := make([]entrySummary, 0, len(summaries))
+	for _, summary := range summaries {
+		entries = append(entries, entrySummary{Name: summary.Name, Username: summary.Username, Folder: summary.Folder, Tags: summary.Tags})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (srv *apiServer) handleGetEntry(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte) {
+	name := strings.ToLower(r.PathValue("name"))
+	username, password, err := backend.GetUserAccount(user, name, masterKey)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	fields, err := backend.GetEntryFields(user, name, masterKey)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entryResponse{Name: name, Username: username, Password: password, Fields: fields})
+}
+
+func (srv *apiServer) handleAddEntry(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte) {
+	var request addEntryRequest
+	if err := decodeBody(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	name := strings.ToLower(request.Name)
+	if len(name) == 0 || len(request.Username) == 0 {
+		writeError(w, fmt.Errorf("name and username cannot be empty"))
+		return
+	}
+	if _, _, err := backend.GetUserAccount(user, name, masterKey); err == nil {
+		writeError(w, backend.ErrAccountExists)
+		return
+	}
+
+	name, password, err := backend.AddUserAccount(user, name, request.Username, request.Password, masterKey)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	//the password is only echoed back when the server generated it
+	response := passwordResponse{Name: name}
+	if len(request.Password) == 0 {
+		response.Password = password
+	}
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (srv *apiServer) handleUpdateEntry(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte) {
+	var request updateEntryRequest
+	if err := decodeBody(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(request.Username) == 0 && len(request.Password) == 0 {
+		writeError(w, fmt.Errorf("nothing to update, give a username or a password"))
+		return
+	}
+
+	if _, err := backend.UpdateUserAccount(user, strings.ToLower(r.PathValue("name")), request.Username, request.Password, masterKey); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *apiServer) handleRemoveEntry(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte) {
+	name := strings.ToLower(r.PathValue("name"))
+	if _, _, err := backend.GetUserAccount(user, name, masterKey); err != nil {
+		writeError(w, err)
+		return
+	}
+	if _, err := backend.RemoveUserAccount(name, user); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *apiServer) handleGenerate(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte) {
+	length := backend.GEN_PASSWORD_LENGTH
+	if value := r.URL.Query().Get("length"); len(value) != 0 {
+		var err error
+		if length, err = strconv.Atoi(value); err != nil {
+			writeError(w, backend.ErrInvalidPasswordLength)
+			return
+		}
+	}
+
+	password, err := backend.GeneratePassword(length)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, passwordResponse{Password: password})
+}
+
+func (srv *apiServer) handleResolve(w http.ResponseWriter, r *http.Request, user userType.User, masterKey []byte) {
+	reference := r.URL.Query().Get("ref")
+	if len(reference) == 0 {
+		writeError(w, fmt.Errorf("missing ref query parameter"))
+		return
+	}
+	value, err := backend.ResolveSecretReference(user, reference, masterKey)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resolveResponse{Reference: reference, Value: value})
+}
+
+func handleSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(schemaDocument)
+}
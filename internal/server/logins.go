@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//failed logins of a username allowed before it has to wait between attempts
+	LOGIN_FREE_FAILURES = 3
+
+	//wait after the first failure past the free ones, doubled with every further failure
+	LOGIN_BASE_DELAY = time.Second
+	LOGIN_MAX_DELAY  = 5 * time.Minute
+
+	//failures of a username are forgotten once it has not failed for this long
+	LOGIN_FAILURE_MEMORY = time.Hour
+)
+
+var ErrLoginBackoff = errors.New("too many failed logins for this user, try again later")
+
+type loginFailures struct {
+	count    int
+	lastFail time.Time
+	retryAt  time.Time
+}
+
+// loginGate lets one login derive its key at a time, each derivation takes tens of megabytes of memory,
+// and makes a username wait longer after every failed login past the first few.
+type loginGate struct {
+	slot     chan struct{}
+	mutex    sync.Mutex
+	failures map[string]loginFailures
+}
+
+func newLoginGate() *loginGate {
+	return &loginGate{slot: make(chan struct{}, 1), failures: make(map[string]loginFailures)}
+}
+
+func (gate *loginGate) enter(ctx context.Context, username string) (time.Duration, error) {
+	//waits for the login slot, the caller has to leave once done
+	//returns how long the username still has to wait if it is backing off, the slot is not held then
+	select {
+	case gate.slot <- struct{}{}:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	gate.mutex.Lock()
+	current := gate.failures[strings.ToLower(username)]
+	gate.mutex.Unlock()
+	if wait := time.Until(current.retryAt); wait > 0 {
+		<-gate.slot
+		return wait, ErrLoginBackoff
+	}
+	return 0, nil
+}
+
+func (gate *loginGate) leave(username string, succeeded bool) {
+	//records the outcome of the login and frees the slot
+	username = strings.ToLower(username)
+	gate.mutex.Lock()
+	if succeeded {
+		delete(gate.failures, username)
+	} else {
+		current := gate.failures[username]
+		current.count++
+		current.lastFail = time.Now()
+		if current.count > LOGIN_FREE_FAILURES {
+			delay := LOGIN_MAX_DELAY
+			if shift := current.count - LOGIN_FREE_FAILURES - 1; shift < 16 {
+				delay = min(LOGIN_BASE_DELAY<<shift, LOGIN_MAX_DELAY)
+			}
+			current.retryAt = current.lastFail.Add(delay)
+		}
+		gate.failures[username] = current
+	}
+	gate.mutex.Unlock()
+	<-gate.slot
+}
+
+func (gate *loginGate) purgeForgotten() {
+	now := time.Now()
+	gate.mutex.Lock()
+	for username, current := range gate.failures {
+		if now.Sub(current.lastFail) > LOGIN_FAILURE_MEMORY && now.After(current.retryAt) {
+			delete(gate.failures, username)
+		}
+	}
+	gate.mutex.Unlock()
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	DEFAULT_LISTEN_ADDRESS = "127.0.0.1:8484"
+	DEFAULT_TOKEN_TTL      = 15 * time.Minute
+
+	//largest request body accepted, every request body is a single small entry
+	MAX_BODY_SIZE = 64 << 10
+
+	//how often expired sessions are dropped, they are refused on use regardless
+	PURGE_INTERVAL = time.Minute
+)
+
+var ErrNotLoopback = errors.New("the api only listens on loopback addresses, use --socket for a unix socket")
+
+type apiServer struct {
+	sessions *sessionStore
+	logins   *loginGate
+}
+
+func (srv *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/login", srv.handleLogin)
+	mux.HandleFunc("POST /v1/logout", srv.authenticated(srv.handleLogout))
+	mux.HandleFunc("GET /v1/entries", srv.authenticated(srv.handleListEntries))
+	mux.HandleFunc("POST /v1/entries", srv.authenticated(srv.handleAddEntry))
+	mux.HandleFunc("GET /v1/entries/{name}", srv.authenticated(srv.handleGetEntry))
+	mux.HandleFunc("PUT /v1/entries/{name}", srv.authenticated(srv.handleUpdateEntry))
+	mux.HandleFunc("DELETE /v1/entries/{name}", srv.authenticated(srv.handleRemoveEntry))
+	mux.HandleFunc("GET /v1/resolve", srv.authenticated(srv.handleResolve))
+	mux.HandleFunc("GET /v1/generate", srv.authenticated(srv.handleGenerate))
+	mux.HandleFunc("GET /v1/schema", handleSchema)
+	return guard(mux)
+}
+
+func guard(next http.Handler) http.Handler {
+	//browsers send an Origin header with cross site requests, no web page gets to talk to the vault
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Origin")) != 0 {
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: "cross origin requests are not allowed"})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func listen(address string, socketPath string) (net.Listener, error) {
+	if len(socketPath) == 0 {
+		if !isLoopback(address) {
+			return nil, ErrNotLoopback
+		}
+		return net.Listen("tcp", address)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	//only the owner of the vault can connect
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func Run(args []string) error {
+	//serves the api until interrupted, on a loopback address or on a unix socket
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	address := flags.String("listen", DEFAULT_LISTEN_ADDRESS, "loopback address to listen on")
+	socketPath := flags.String("socket", "", "unix socket to listen on instead of a tcp address")
+	ttl := flags.Duration("token-ttl", DEFAULT_TOKEN_TTL, "how long a session token stays valid")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *ttl <= 0 {
+		return fmt.Errorf("token ttl must be positive")
+	}
+
+	listener, err := listen(*address, *socketPath)
+	if err != nil {
+		return err
+	}
+
+	srv := &apiServer{sessions: newSessionStore(*ttl), logins: newLoginGate()}
+	httpServer := &http.Server{
+		Handler:           srv.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		ticker := time.NewTicker(PURGE_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				srv.sessions.purgeExpired()
+				srv.logins.purgeForgotten()
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Println("Serving the api on", listener.Addr().String())
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"passwordManager/internal/backend/crypto"
+	"passwordManager/internal/userType"
+	"sync"
+	"time"
+)
+
+const (
+	//length of the random part of a session token, in bytes
+	TOKEN_SIZE = 32
+
+	//domain separation between the two values derived from a token
+	TOKEN_ID_LABEL   = "passmngr-session-id"
+	TOKEN_WRAP_LABEL = "passmngr-session-wrap"
+)
+
+var ErrInvalidSession = errors.New("invalid or expired session token")
+
+// session is a logged in user. The master key is only held wrapped with a key derived from the token,
+// which the server never stores, so it can only be unwrapped while a request carrying the token is served.
+type session struct {
+	user       userType.User
+	wrappedKey []byte
+	expiresAt  time.Time
+}
+
+// sessionStore maps token ids to sessions. The id is a hash of the token, the token itself is not kept.
+type sessionStore struct {
+	mutex    sync.Mutex
+	sessions map[string]session
+	ttl      time.Duration
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{sessions: make(map[string]session), ttl: ttl}
+}
+
+func deriveFromToken(label string, token string) []byte {
+	sum := sha256.Sum256([]byte(label + "\x00" + token))
+	return sum[:]
+}
+
+func tokenId(token string) string {
+	return hex.EncodeToString(deriveFromToken(TOKEN_ID_LABEL, token))
+}
+
+func (store *sessionStore) create(user userType.User, masterKey []byte) (string, time.Time, error) {
+	//returns a new token for the user and when it expires
+	random := make([]byte, TOKEN_SIZE)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+
+	wrapKey := deriveFromToken(TOKEN_WRAP_LABEL, token)
+	defer clear(wrapKey)
+	wrappedKey, err := crypto.EncryptPassword(masterKey, wrapKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(store.ttl)
+	store.mutex.Lock()
+	store.sessions[tokenId(token)] = session{user: user, wrappedKey: wrappedKey, expiresAt: expiresAt}
+	store.mutex.Unlock()
+	return token, expiresAt, nil
+}
+
+func (store *sessionStore) unwrap(token string) (userType.User, []byte, error) {
+	//returns the user of the session and the unwrapped master key, the caller has to clear the key once done with it
+	id := tokenId(token)
+	store.mutex.Lock()
+	current, found := store.sessions[id]
+	if found && time.Now().After(current.expiresAt) {
+		delete(store.sessions, id)
+		found = false
+	}
+	store.mutex.Unlock()
+	if !found {
+		return userType.User{}, nil, ErrInvalidSession
+	}
+
+	wrapKey := deriveFromToken(TOKEN_WRAP_LABEL, token)
+	defer clear(wrapKey)
+	masterKey, err := crypto.DecryptPassword(current.wrappedKey, wrapKey)
+	if err != nil {
+		return userType.User{}, nil, ErrInvalidSession
+	}
+	return current.user, masterKey, nil
+}
+
+func (store *sessionStore) remove(token string) {
+	store.mutex.Lock()
+	delete(store.sessions, tokenId(token))
+	store.mutex.Unlock()
+}
+
+func (store *sessionStore) purgeExpired() {
+	now := time.Now()
+	store.mutex.Lock()
+	for id, current := range store.sessions {
+		if now.After(current.expiresAt) {
+			delete(store.sessions, id)
+		}
+	}
+	store.mutex.Unlock()
+}
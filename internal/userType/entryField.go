@@ -0,0 +1,16 @@
+package userType
+
+type FieldType string
+
+const (
+	FieldText   FieldType = "text"
+	FieldHidden FieldType = "hidden"
+	FieldURL    FieldType = "url"
+	FieldEmail  FieldType = "email"
+)
+
+type EntryField struct {
+	Name  string    `json:"name"`
+	Type  FieldType `json:"type"`
+	Value string    `json:"value"`
+}
@@ -0,0 +1,21 @@
+package userType
+
+type OTPConfig struct {
+	Kind      string
+	Secret    string
+	Algorithm string
+	Digits    int
+	Period    int
+	Counter   uint64
+	Issuer    string
+	Label     string
+}
+
+type OTPCode struct {
+	Code string
+	Kind string
+	// seconds until a time based code expires, 0 for counter based codes
+	Remaining int
+	// counter value the code was generated with, only set for counter based codes
+	Counter uint64
+}
@@ -0,0 +1,10 @@
+package userType
+
+// SecretReference points at one value of an entry, written as glk://<user>/<folder>/<entry>/<field>.
+// Folder is empty for entries at the root, and may span several segments for nested folders.
+type SecretReference struct {
+	User   string
+	Folder string
+	Entry  string
+	Field  string
+}
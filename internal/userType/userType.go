@@ -1,8 +1,134 @@
 package userType
 
+import "time"
+
 type User struct {
 	Uid           int64
 	Name          string
 	Salt          []byte
 	MasterKeyHash []byte
+	// WrappedVaultKey is the key of the vault encrypted with the master key, empty when the master key is the vault key
+	WrappedVaultKey []byte
+	// UsesKeyFile is set when the master key is derived from a key file along with the master password
+	UsesKeyFile bool
+}
+
+type AccountSummary struct {
+	Name     string
+	Username string
+	Folder   string
+	Tags     []string
+}
+
+type SearchResult struct {
+	Account   AccountSummary
+	MatchedOn string
+	Score     int
+}
+
+type OriginMatch struct {
+	Account  AccountSummary
+	Password string
+	// ExactHost is set when the entry was stored for the very host of the origin, not just the same site
+	ExactHost bool
+}
+
+type VaultEntry struct {
+	Name     string       `json:"name"`
+	Username string       `json:"username"`
+	Password string       `json:"password"`
+	URL      string       `json:"url,omitempty"`
+	Notes    string       `json:"notes,omitempty"`
+	Folder   string       `json:"folder,omitempty"`
+	TOTP     string       `json:"totp,omitempty"`
+	Tags     []string     `json:"tags,omitempty"`
+	Fields   []EntryField `json:"fields,omitempty"`
+}
+
+type ImportSummary struct {
+	Added       []string
+	Overwritten []string
+	Renamed     []ImportRename
+	Skipped     []string
+}
+
+type ImportRename struct {
+	From string
+	To   string
+}
+
+type BackupManifest struct {
+	Format        string    `json:"format"`
+	CreatedAt     time.Time `json:"created_at"`
+	SchemaVersion int       `json:"schema_version"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+}
+
+type SyncReport struct {
+	Pulled        []string
+	Pushed        []string
+	DeletedLocal  []string
+	DeletedRemote []string
+	Conflicts     []SyncConflict
+}
+
+type SyncConflict struct {
+	Name       string
+	Resolution string
+}
+
+type EntryVersion struct {
+	Entry      VaultEntry
+	ModifiedAt time.Time
+	RecordedAt time.Time
+}
+
+type SharedEntry struct {
+	Owner    string       `json:"owner"`
+	Name     string       `json:"name"`
+	Username string       `json:"username"`
+	Password string       `json:"password"`
+	Fields   []EntryField `json:"fields,omitempty"`
+	SharedAt time.Time    `json:"shared_at"`
+}
+
+type ShareGrant struct {
+	Name      string
+	Recipient string
+	SharedAt  time.Time
+}
+
+type OrganizationMembership struct {
+	Name string
+	Role string
+}
+
+type OrgMember struct {
+	Username string
+	Role     string
+}
+
+type CollectionSummary struct {
+	Name    string
+	Entries int
+}
+
+type CollectionEntry struct {
+	Name     string       `json:"name"`
+	Username string       `json:"username"`
+	Password string       `json:"password"`
+	Fields   []EntryField `json:"fields,omitempty"`
+	OTP      string       `json:"otp,omitempty"`
+	Folder   string       `json:"folder,omitempty"`
+	Tags     []string     `json:"tags,omitempty"`
+}
+
+type EmergencyContact struct {
+	Owner   string
+	Contact string
+	Wait    time.Duration
+	// RequestedAt is zero while no access is requested, AvailableAt is when a pending request is granted
+	RequestedAt time.Time
+	AvailableAt time.Time
 }